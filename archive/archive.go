@@ -0,0 +1,206 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var ErrUnsafeEntry = errors.New("archive entry escapes the target directory")
+
+// Write writes source as a zstd compressed tar
+func Write(source string, target io.Writer) error {
+
+	zstdWriter, err := zstd.NewWriter(target)
+
+	if err != nil {
+		return err
+	}
+
+	tarWriter := tar.NewWriter(zstdWriter)
+
+	err = filepath.Walk(source, func(filePath string, info os.FileInfo, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(source, filePath)
+
+		if err != nil || name == "." {
+			return err
+		}
+
+		link := ""
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(filePath)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+
+		if err != nil {
+			return err
+		}
+
+		header.Name = filepath.ToSlash(name)
+
+		err = tarWriter.WriteHeader(header)
+
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		data, err := os.Open(filePath)
+
+		if err != nil {
+			return err
+		}
+
+		defer data.Close()
+
+		_, err = io.Copy(tarWriter, data)
+
+		return err
+	})
+
+	if err != nil {
+		zstdWriter.Close()
+		return err
+	}
+
+	err = tarWriter.Close()
+
+	if err != nil {
+		zstdWriter.Close()
+		return err
+	}
+
+	return zstdWriter.Close()
+}
+
+// WriteFile archives source to the file target, which only appears once complete
+func WriteFile(source string, target string) error {
+
+	err := os.MkdirAll(filepath.Dir(target), os.ModePerm)
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(target), ".archive-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	err = Write(source, file)
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), target)
+}
+
+// Extract unpacks an archive written by Write into target. Entries
+// pointing outside of target, including through symlinks, are refused.
+func Extract(source io.Reader, target string) error {
+
+	zstdReader, err := zstd.NewReader(source)
+
+	if err != nil {
+		return err
+	}
+
+	defer zstdReader.Close()
+
+	tarReader := tar.NewReader(zstdReader)
+	root := filepath.Clean(target) + string(os.PathSeparator)
+
+	for {
+		header, err := tarReader.Next()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		destination := filepath.Join(target, filepath.FromSlash(header.Name))
+
+		if !strings.HasPrefix(destination, root) {
+			return ErrUnsafeEntry
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(destination, os.FileMode(header.Mode)|0700)
+		case tar.TypeReg:
+			err = extractFile(tarReader, destination, os.FileMode(header.Mode))
+		case tar.TypeSymlink:
+			linkTarget := header.Linkname
+
+			if !filepath.IsAbs(linkTarget) {
+				linkTarget = filepath.Join(filepath.Dir(destination), linkTarget)
+			}
+
+			if !strings.HasPrefix(filepath.Clean(linkTarget), root) {
+				return ErrUnsafeEntry
+			}
+
+			err = os.Symlink(header.Linkname, destination)
+		default:
+			// Devices, fifos and hard links don't belong in a world backup
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(data io.Reader, destination string, mode os.FileMode) error {
+
+	err := os.MkdirAll(filepath.Dir(destination), os.ModePerm)
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, data)
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestRoundTrip(t *testing.T) {
+
+	source := t.TempDir()
+
+	os.MkdirAll(filepath.Join(source, "world", "region"), os.ModePerm)
+	os.WriteFile(filepath.Join(source, "world", "level.dat"), []byte("level"), 0644)
+	os.WriteFile(filepath.Join(source, "server.properties"), []byte("motd=hi\n"), 0600)
+	os.Symlink("world/level.dat", filepath.Join(source, "link"))
+
+	var data bytes.Buffer
+
+	err := Write(source, &data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := t.TempDir()
+
+	err = Extract(&data, target)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"world/level.dat": "level", "server.properties": "motd=hi\n", "link": "level"} {
+		got, err := os.ReadFile(filepath.Join(target, name))
+
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(target, "world", "region")); err != nil || !info.IsDir() {
+		t.Errorf("empty directory wasn't restored: %v", err)
+	}
+}
+
+func TestExtractRefusesEscapes(t *testing.T) {
+
+	tests := []tar.Header{
+		{Name: "../outside", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../outside"},
+	}
+
+	for _, header := range tests {
+		var data bytes.Buffer
+
+		zstdWriter, _ := zstd.NewWriter(&data)
+		tarWriter := tar.NewWriter(zstdWriter)
+		tarWriter.WriteHeader(&header)
+		tarWriter.Close()
+		zstdWriter.Close()
+
+		err := Extract(&data, t.TempDir())
+
+		if err != ErrUnsafeEntry {
+			t.Errorf("Extract of %s -> %q returned %v", header.Name, header.Linkname, err)
+		}
+	}
+}
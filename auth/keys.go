@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+)
+
+const (
+	SCOPE_SERVERS_READ  = "servers:read"
+	SCOPE_SERVERS_WRITE = "servers:write"
+	SCOPE_CONSOLE       = "console"
+	SCOPE_PLAYERS_READ  = "players:read"
+	SCOPE_PLAYERS_WRITE = "players:write"
+	SCOPE_FILES         = "files"
+	// What a server's own container may do beyond reading, e.g. creating link codes
+	SCOPE_SERVER = "server"
+	// Grants every other scope
+	SCOPE_ADMIN = "admin"
+)
+
+var Scopes = []string{SCOPE_SERVERS_READ, SCOPE_SERVERS_WRITE, SCOPE_CONSOLE, SCOPE_PLAYERS_READ, SCOPE_PLAYERS_WRITE, SCOPE_FILES, SCOPE_SERVER, SCOPE_ADMIN}
+
+// Scopes of the keys injected into server containers, deliberately without servers:write
+// so a compromised server can't change or delete itself
+var ServerKeyScopes = []string{SCOPE_SERVERS_READ, SCOPE_SERVER}
+
+const KEY_PREFIX = "lk_"
+
+// LastUsedAt is only written when older than this, so every request doesn't cost an update
+const LAST_USED_RESOLUTION = time.Minute
+
+var ErrInvalidKey = errors.New("invalid api key")
+var ErrExpiredKey = errors.New("api key expired or revoked")
+
+func IsValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func HashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateKey stores a new key and returns it together with the plain key
+func CreateKey(name string, scopes []string, serverId uint, expiresAt *time.Time) (db.ApiKey, string, error) {
+
+	buffer := make([]byte, 24)
+
+	_, err := rand.Read(buffer)
+
+	if err != nil {
+		return db.ApiKey{}, "", err
+	}
+
+	plain := KEY_PREFIX + hex.EncodeToString(buffer)
+
+	key := db.ApiKey{
+		Name:      name,
+		Prefix:    plain[:len(KEY_PREFIX)+8],
+		Hash:      HashKey(plain),
+		Scopes:    scopes,
+		ServerID:  serverId,
+		ExpiresAt: expiresAt,
+	}
+
+	err = db.OpenedConnection.Create(&key).Error
+
+	return key, plain, err
+}
+
+// Authenticate resolves a presented key. The configured Secret still works as an
+// admin key so the first real keys can be created.
+func Authenticate(token string) (db.ApiKey, error) {
+
+	if token == "" {
+		return db.ApiKey{}, ErrInvalidKey
+	}
+
+	if secret := config.LoadedConfiguration.Secret; secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1 {
+		return db.ApiKey{Name: "config secret", Scopes: []string{SCOPE_ADMIN}}, nil
+	}
+
+	key := db.ApiKey{}
+	db.OpenedConnection.Where("hash = ?", HashKey(token)).First(&key)
+
+	if key.ID == 0 {
+		return db.ApiKey{}, ErrInvalidKey
+	}
+
+	if key.Revoked || (key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now())) {
+		return db.ApiKey{}, ErrExpiredKey
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > LAST_USED_RESOLUTION {
+		now := time.Now()
+		key.LastUsedAt = &now
+		db.OpenedConnection.Model(&key).Update("last_used_at", now)
+	}
+
+	return key, nil
+}
+
+func HasScope(key db.ApiKey, scope string) bool {
+	for _, s := range key.Scopes {
+		if s == scope || s == SCOPE_ADMIN {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IssueServerKey revokes the previous container keys of the server and creates a new one
+func IssueServerKey(serverId uint) (string, error) {
+
+	err := db.OpenedConnection.Model(&db.ApiKey{}).
+		Where("server_id = ? AND name = ?", serverId, "container").
+		Update("revoked", true).Error
+
+	if err != nil {
+		return "", err
+	}
+
+	_, plain, err := CreateKey("container", ServerKeyScopes, serverId, nil)
+
+	return plain, err
+}
+
+// HasCurrentServerKey is false for servers whose container still carries the config
+// Secret or a key issued with other scopes than ServerKeyScopes
+func HasCurrentServerKey(serverId uint) bool {
+
+	keys := []db.ApiKey{}
+	db.OpenedConnection.Where("server_id = ? AND name = ? AND revoked = ?", serverId, "container", false).Find(&keys)
+
+	for _, key := range keys {
+		if sameScopes(key.Scopes, ServerKeyScopes) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sameScopes(a []string, b []string) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, scope := range b {
+		found := false
+
+		for _, s := range a {
+			if s == scope {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
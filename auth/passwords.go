@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters for new hashes. They are encoded into every hash, so raising
+// them later doesn't break existing passwords.
+const (
+	ARGON_TIME    = 3
+	ARGON_MEMORY  = 64 * 1024
+	ARGON_THREADS = 2
+	ARGON_KEY_LEN = 32
+	ARGON_SALT    = 16
+
+	MIN_PASSWORD_LENGTH = 6
+	MAX_PASSWORD_LENGTH = 128
+)
+
+var ErrMalformedHash = errors.New("malformed password hash")
+var ErrWeakPassword = fmt.Errorf("password must be between %d and %d characters", MIN_PASSWORD_LENGTH, MAX_PASSWORD_LENGTH)
+
+func ValidatePassword(password string) error {
+	if len(password) < MIN_PASSWORD_LENGTH || len(password) > MAX_PASSWORD_LENGTH {
+		return ErrWeakPassword
+	}
+
+	return nil
+}
+
+// HashPassword returns the hash in the PHC string format,
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+
+	salt := make([]byte, ARGON_SALT)
+
+	_, err := rand.Read(salt)
+
+	if err != nil {
+		return "", err
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, ARGON_TIME, ARGON_MEMORY, ARGON_THREADS, ARGON_KEY_LEN)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, ARGON_MEMORY, ARGON_TIME, ARGON_THREADS,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
+}
+
+func VerifyPassword(password string, encoded string) (bool, error) {
+
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrMalformedHash
+	}
+
+	var version int
+	var memory, iterations uint32
+	var threads uint8
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+
+	if err != nil || version != argon2.Version {
+		return false, ErrMalformedHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads)
+
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(expected)))
+
+	return subtle.ConstantTimeCompare(hash, expected) == 1, nil
+}
@@ -0,0 +1,362 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/logger"
+	"github.com/go-redis/redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	AUTH_METHOD_REGISTER = "register"
+	AUTH_METHOD_PASSWORD = "password"
+	AUTH_METHOD_SESSION  = "session"
+)
+
+var ErrAlreadyRegistered = errors.New("player is already registered")
+var ErrNotRegistered = errors.New("player is not registered")
+var ErrWrongPassword = errors.New("wrong password")
+var ErrInvalidSession = errors.New("session is invalid, expired or from another ip")
+
+// LockoutError is returned while a username or ip has too many failed attempts
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return "too many failed attempts, retry in " + e.RetryAfter.Round(time.Second).String()
+}
+
+// Published on players:authenticated, the proxy releases the player from limbo after
+// checking the signature with the events key (see channels.SignEvent)
+type PlayerAuthEvent struct {
+	UUID     string `json:"uuid"`
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+	Method   string `json:"method"`
+	channels.EventSignature
+}
+
+func sessionTTL() time.Duration {
+	if config.LoadedConfiguration.PlayerAuth.SessionTTL <= 0 {
+		return 12 * time.Hour
+	}
+
+	return time.Duration(config.LoadedConfiguration.PlayerAuth.SessionTTL) * time.Hour
+}
+
+func maxLoginAttempts() int64 {
+	if config.LoadedConfiguration.PlayerAuth.MaxAttempts <= 0 {
+		return 5
+	}
+
+	return int64(config.LoadedConfiguration.PlayerAuth.MaxAttempts)
+}
+
+func lockoutTime() time.Duration {
+	if config.LoadedConfiguration.PlayerAuth.LockoutTime <= 0 {
+		return 15 * time.Minute
+	}
+
+	return time.Duration(config.LoadedConfiguration.PlayerAuth.LockoutTime) * time.Second
+}
+
+// Failures are counted per username and per ip, so guessing one account from many ips
+// and many accounts from one ip are both limited
+func failureKeys(user db.User, ip string) []string {
+	return []string{"auth:failures:name:" + user.SafeUsername(), "auth:failures:ip:" + ip}
+}
+
+// Counts the attempt on every key before the password is checked, so concurrent guesses
+// can't all pass a check made before any of them was counted. The window starts with the
+// first attempt and going over the limit locks for the full time. Returns the milliseconds
+// until the lock ends, 0 when the attempt is allowed.
+var attemptScript = redis.NewScript(`
+local locked = 0
+for _, key in ipairs(KEYS) do
+	local count = redis.call("INCR", key)
+	if count == 1 or count == tonumber(ARGV[2]) + 1 then
+		redis.call("PEXPIRE", key, ARGV[1])
+	end
+	if count > tonumber(ARGV[2]) then
+		locked = math.max(locked, redis.call("PTTL", key))
+	end
+end
+return locked
+`)
+
+// Gives the attempt back without touching the window, for keys that still exist
+var refundScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("DECR", KEYS[1])
+end
+return 0
+`)
+
+func reserveAttempt(ctx context.Context, user db.User, ip string) error {
+
+	window := lockoutTime()
+
+	locked, err := attemptScript.Run(ctx, channels.RedisConnection, failureKeys(user, ip), window.Milliseconds(), maxLoginAttempts()).Int64()
+
+	if err != nil {
+		return err
+	}
+
+	if locked == 0 {
+		return nil
+	}
+
+	// PTTL is negative for a key without expiry, which the script never leaves behind
+	if locked < 0 {
+		locked = window.Milliseconds()
+	}
+
+	return &LockoutError{RetryAfter: time.Duration(locked) * time.Millisecond}
+}
+
+// A valid login clears the username counter and gives the ip its attempt back, but
+// mustn't unlock an ip that guesses other accounts
+func settleAttempt(ctx context.Context, user db.User, ip string) {
+
+	keys := failureKeys(user, ip)
+
+	err := channels.RedisConnection.Del(ctx, keys[0]).Err()
+
+	if err == nil {
+		err = refundScript.Run(ctx, channels.RedisConnection, keys[1:]).Err()
+	}
+
+	if err != nil {
+		logger.Error("Error clearing login attempts: " + err.Error())
+	}
+}
+
+func createSession(user db.User, ip string, serverId uint) (string, db.PlayerSession, error) {
+
+	buffer := make([]byte, 32)
+
+	_, err := rand.Read(buffer)
+
+	if err != nil {
+		return "", db.PlayerSession{}, err
+	}
+
+	token := hex.EncodeToString(buffer)
+
+	session := db.PlayerSession{
+		UserID:    user.ID,
+		TokenHash: HashKey(token),
+		IP:        ip,
+		ServerID:  serverId,
+		ExpiresAt: time.Now().Add(sessionTTL()),
+	}
+
+	err = db.OpenedConnection.Create(&session).Error
+
+	return token, session, err
+}
+
+func authenticated(user db.User, ip string, method string) {
+
+	err := db.OpenedConnection.Table("users").Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"last_ip_address": ip,
+		"last_login_at":   time.Now(),
+		"logins":          gorm.Expr("logins + 1"),
+	}).Error
+
+	if err != nil {
+		logger.Error("Error updating last login of " + user.Username + ": " + err.Error())
+	}
+
+	signature, err := channels.SignEvent("players:authenticated", user.UUID, user.Username, ip, method)
+
+	if err != nil {
+		logger.Error("Error signing auth event: " + err.Error())
+		return
+	}
+
+	body, err := json.Marshal(PlayerAuthEvent{
+		UUID:           user.UUID,
+		Username:       user.Username,
+		IP:             ip,
+		Method:         method,
+		EventSignature: signature,
+	})
+
+	if err != nil {
+		logger.Error("Error marshalling auth event: " + err.Error())
+		return
+	}
+
+	err = channels.PublishEvent("players:authenticated", body)
+
+	if err != nil {
+		logger.Error("Error publishing auth event: " + err.Error())
+	}
+}
+
+// RegisterPlayer sets the first password of the player and logs them in on serverId
+func RegisterPlayer(user db.User, password string, ip string, serverId uint) (string, db.PlayerSession, error) {
+
+	if user.PasswordHash != "" {
+		return "", db.PlayerSession{}, ErrAlreadyRegistered
+	}
+
+	err := ValidatePassword(password)
+
+	if err != nil {
+		return "", db.PlayerSession{}, err
+	}
+
+	hash, err := HashPassword(password)
+
+	if err != nil {
+		return "", db.PlayerSession{}, err
+	}
+
+	// Guarded on the empty hash so two concurrent registrations can't both win
+	result := db.OpenedConnection.Table("users").
+		Where("id = ? AND (password_hash = '' OR password_hash IS NULL)", user.ID).
+		Updates(map[string]interface{}{"password_hash": hash, "registred": true})
+
+	if result.Error != nil {
+		return "", db.PlayerSession{}, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return "", db.PlayerSession{}, ErrAlreadyRegistered
+	}
+
+	token, session, err := createSession(user, ip, serverId)
+
+	if err != nil {
+		return "", session, err
+	}
+
+	authenticated(user, ip, AUTH_METHOD_REGISTER)
+
+	return token, session, nil
+}
+
+func verifyPlayerPassword(ctx context.Context, user db.User, password string, ip string) error {
+
+	if user.PasswordHash == "" {
+		return ErrNotRegistered
+	}
+
+	err := reserveAttempt(ctx, user, ip)
+
+	if err != nil {
+		return err
+	}
+
+	ok, err := VerifyPassword(password, user.PasswordHash)
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrWrongPassword
+	}
+
+	settleAttempt(ctx, user, ip)
+
+	return nil
+}
+
+func LoginPlayer(ctx context.Context, user db.User, password string, ip string, serverId uint) (string, db.PlayerSession, error) {
+
+	err := verifyPlayerPassword(ctx, user, password, ip)
+
+	if err != nil {
+		return "", db.PlayerSession{}, err
+	}
+
+	token, session, err := createSession(user, ip, serverId)
+
+	if err != nil {
+		return "", session, err
+	}
+
+	authenticated(user, ip, AUTH_METHOD_PASSWORD)
+
+	return token, session, nil
+}
+
+// ResumeSession logs a rejoining player in without a password, from the ip the session was created on
+func ResumeSession(user db.User, token string, ip string, serverId uint) (db.PlayerSession, error) {
+
+	session := db.PlayerSession{}
+	db.OpenedConnection.Where("token_hash = ? AND user_id = ?", HashKey(token), user.ID).First(&session)
+
+	if session.ID == 0 || session.Revoked || session.ExpiresAt.Before(time.Now()) || session.IP != ip {
+		return db.PlayerSession{}, ErrInvalidSession
+	}
+
+	if serverId != 0 && serverId != session.ServerID {
+		err := db.OpenedConnection.Model(&session).Update("server_id", serverId).Error
+
+		if err != nil {
+			return db.PlayerSession{}, err
+		}
+	}
+
+	authenticated(user, ip, AUTH_METHOD_SESSION)
+
+	return session, nil
+}
+
+// ConnectPlayer moves the player's active sessions onto the server the proxy connected them to.
+// Servers can't do this themselves, a session's server decides where link codes may be issued.
+func ConnectPlayer(user db.User, serverId uint) error {
+	return db.OpenedConnection.Model(&db.PlayerSession{}).
+		Where("user_id = ? AND revoked = ? AND expires_at > ?", user.ID, false, time.Now()).
+		Update("server_id", serverId).Error
+}
+
+// ChangePlayerPassword also ends every session of the player
+func ChangePlayerPassword(ctx context.Context, user db.User, oldPassword string, newPassword string, ip string) error {
+
+	err := verifyPlayerPassword(ctx, user, oldPassword, ip)
+
+	if err != nil {
+		return err
+	}
+
+	err = ValidatePassword(newPassword)
+
+	if err != nil {
+		return err
+	}
+
+	hash, err := HashPassword(newPassword)
+
+	if err != nil {
+		return err
+	}
+
+	err = db.OpenedConnection.Table("users").Where("id = ?", user.ID).Update("password_hash", hash).Error
+
+	if err != nil {
+		return err
+	}
+
+	return RevokePlayerSessions(user)
+}
+
+func RevokePlayerSessions(user db.User) error {
+	return db.OpenedConnection.Model(&db.PlayerSession{}).
+		Where("user_id = ? AND revoked = ?", user.ID, false).
+		Update("revoked", true).Error
+}
@@ -0,0 +1,502 @@
+package backups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/archive"
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/docker"
+	"github.com/Lisek-World-Reborn/lisek-api/logger"
+)
+
+// Longest a backup or restore may hold the server's lock
+const OPERATION_TIMEOUT = time.Hour
+
+var ErrOperationRunning = errors.New("a backup or restore of this server is already running")
+var ErrServerRunning = errors.New("the server has to be stopped before restoring")
+var ErrBackupNotReady = errors.New("backup is not ready")
+
+func ObjectName(server db.Server, at time.Time) string {
+	return fmt.Sprintf("servers/%d/%s.tar.zst", server.ID, at.UTC().Format("20060102-150405"))
+}
+
+// Only one backup or restore runs per server, across api replicas as well
+func lockKey(serverId uint) string {
+	return "backups:lock:" + strconv.Itoa(int(serverId))
+}
+
+func acquireLock(serverId uint) error {
+
+	acquired, err := channels.RedisConnection.SetNX(context.Background(), lockKey(serverId), "1", OPERATION_TIMEOUT).Result()
+
+	if err != nil {
+		return err
+	}
+
+	if !acquired {
+		return ErrOperationRunning
+	}
+
+	return nil
+}
+
+func releaseLock(serverId uint) {
+	channels.RedisConnection.Del(context.Background(), lockKey(serverId))
+}
+
+func isRunning(ctx context.Context, server db.Server) (bool, error) {
+
+	container, err := docker.ContainerRuntime.InspectContainer(ctx, server.ContainerName)
+
+	if err == docker.ErrContainerNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return container.State == "running", nil
+}
+
+// StartBackup records the backup and creates it in the background, the job tracks its progress
+func StartBackup(server db.Server) (db.Backup, *db.Job, error) {
+
+	err := acquireLock(server.ID)
+
+	if err != nil {
+		return db.Backup{}, nil, err
+	}
+
+	now := time.Now()
+
+	backup := db.Backup{
+		ServerID:  server.ID,
+		Object:    ObjectName(server, now),
+		Storage:   BackupStorage.Name(),
+		Status:    db.BACKUP_CREATING,
+		CreatedAt: now,
+	}
+
+	err = db.OpenedConnection.Create(&backup).Error
+
+	if err != nil {
+		releaseLock(server.ID)
+		return backup, nil, err
+	}
+
+	job, err := db.CreateJob("backup", server.ID)
+
+	if err != nil {
+		releaseLock(server.ID)
+		return backup, nil, err
+	}
+
+	// runBackup updates the job while the caller writes its response
+	response := *job
+
+	go runBackup(server, backup, job)
+
+	return backup, &response, nil
+}
+
+func runBackup(server db.Server, backup db.Backup, job *db.Job) {
+
+	defer releaseLock(server.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), OPERATION_TIMEOUT)
+	defer cancel()
+
+	job.SetPhase(db.JOB_CREATING)
+
+	err := createSnapshot(ctx, server, &backup)
+
+	now := time.Now()
+	backup.FinishedAt = &now
+
+	if err != nil {
+		logger.Error("Error backing up server " + server.Name + ": " + err.Error())
+
+		backup.Status = db.BACKUP_FAILED
+		backup.Error = err.Error()
+		db.OpenedConnection.Save(&backup)
+
+		// Whatever made it to the storage is incomplete
+		BackupStorage.Delete(context.Background(), backup.Object)
+
+		job.Fail(err)
+		return
+	}
+
+	backup.Status = db.BACKUP_READY
+	db.OpenedConnection.Save(&backup)
+
+	job.SetPhase(db.JOB_READY)
+
+	logger.Info("Backed up server " + server.Name + " to " + backup.Object)
+
+	err = ApplyRetention(ctx, server.ID)
+
+	if err != nil {
+		logger.Error("Error applying backup retention of server " + server.Name + ": " + err.Error())
+	}
+}
+
+// createSnapshot stops the running server from writing the world while it's archived.
+// Saving is turned back on as soon as the archive exists, before the upload.
+func createSnapshot(ctx context.Context, server db.Server, backup *db.Backup) error {
+
+	running, err := isRunning(ctx, server)
+
+	if err != nil {
+		return err
+	}
+
+	savingOff := false
+
+	resumeSaving := func() {
+		if !savingOff {
+			return
+		}
+
+		savingOff = false
+
+		_, err := docker.ExecConsoleCommand(ctx, server, "save-on")
+
+		if err != nil {
+			logger.Error("Error turning saving back on for server " + server.Name + ": " + err.Error())
+		}
+	}
+
+	defer resumeSaving()
+
+	if running {
+		_, err = docker.ExecConsoleCommand(ctx, server, "save-off")
+
+		if err != nil {
+			return fmt.Errorf("turning saving off: %w", err)
+		}
+
+		savingOff = true
+
+		_, err = docker.ExecConsoleCommand(ctx, server, "save-all flush")
+
+		if err != nil {
+			return fmt.Errorf("saving the world: %w", err)
+		}
+	}
+
+	serverDir, err := docker.LocalServerDir(server.ContainerName)
+
+	if err != nil {
+		return err
+	}
+
+	archiveFile, err := os.CreateTemp("", "backup-*.tar.zst")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(archiveFile.Name())
+	defer archiveFile.Close()
+
+	err = archive.Write(serverDir, archiveFile)
+
+	if err != nil {
+		return fmt.Errorf("archiving: %w", err)
+	}
+
+	resumeSaving()
+
+	info, err := archiveFile.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = archiveFile.Seek(0, 0)
+
+	if err != nil {
+		return err
+	}
+
+	err = BackupStorage.Put(ctx, backup.Object, archiveFile, info.Size())
+
+	if err != nil {
+		return fmt.Errorf("uploading: %w", err)
+	}
+
+	backup.Size = info.Size()
+
+	return nil
+}
+
+// StartRestore replaces the data of a stopped server with the backup in the background
+func StartRestore(server db.Server, backup db.Backup) (*db.Job, error) {
+
+	if backup.Status != db.BACKUP_READY {
+		return nil, ErrBackupNotReady
+	}
+
+	running, err := isRunning(context.Background(), server)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if running {
+		return nil, ErrServerRunning
+	}
+
+	err = acquireLock(server.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := db.CreateJob("restore", server.ID)
+
+	if err != nil {
+		releaseLock(server.ID)
+		return nil, err
+	}
+
+	// runRestore updates the job while the caller writes its response
+	response := *job
+
+	go runRestore(server, backup, job)
+
+	return &response, nil
+}
+
+func runRestore(server db.Server, backup db.Backup, job *db.Job) {
+
+	defer releaseLock(server.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), OPERATION_TIMEOUT)
+	defer cancel()
+
+	job.SetPhase(db.JOB_CREATING)
+
+	err := restoreData(ctx, server, backup)
+
+	if err != nil {
+		logger.Error("Error restoring server " + server.Name + ": " + err.Error())
+		job.Fail(err)
+		return
+	}
+
+	job.SetPhase(db.JOB_READY)
+
+	logger.Info("Restored server " + server.Name + " from " + backup.Object)
+}
+
+// The backup is extracted next to the data directory and swapped in once complete,
+// a failed download or extraction leaves the current data untouched
+func restoreData(ctx context.Context, server db.Server, backup db.Backup) error {
+
+	serverDir, err := docker.LocalServerDir(server.ContainerName)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := BackupStorage.Get(ctx, backup.Object)
+
+	if err != nil {
+		return fmt.Errorf("downloading: %w", err)
+	}
+
+	defer data.Close()
+
+	suffix := strconv.Itoa(int(time.Now().Unix()))
+
+	err = os.MkdirAll(filepath.Dir(serverDir), os.ModePerm)
+
+	if err != nil {
+		return err
+	}
+
+	restoreDir, err := os.MkdirTemp(filepath.Dir(serverDir), server.ContainerName+".restore-")
+
+	if err != nil {
+		return err
+	}
+
+	err = archive.Extract(data, restoreDir)
+
+	if err != nil {
+		os.RemoveAll(restoreDir)
+		return fmt.Errorf("extracting: %w", err)
+	}
+
+	previousDir := serverDir + ".before-restore-" + suffix
+
+	err = os.Rename(serverDir, previousDir)
+
+	if err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(restoreDir)
+		return err
+	}
+
+	err = os.Rename(restoreDir, serverDir)
+
+	if err != nil {
+		os.Rename(previousDir, serverDir)
+		os.RemoveAll(restoreDir)
+		return err
+	}
+
+	return os.RemoveAll(previousDir)
+}
+
+func DeleteBackup(ctx context.Context, backup db.Backup) error {
+
+	err := BackupStorage.Delete(ctx, backup.Object)
+
+	if err != nil {
+		return err
+	}
+
+	return db.OpenedConnection.Delete(&backup).Error
+}
+
+// expiredBackups picks what retention deletes from a server's ready backups, newest first
+func expiredBackups(backups []db.Backup, keep int, maxAge time.Duration, now time.Time) []db.Backup {
+
+	expired := []db.Backup{}
+
+	for i, backup := range backups {
+		tooMany := keep > 0 && i >= keep
+		tooOld := maxAge > 0 && now.Sub(backup.CreatedAt) > maxAge
+
+		if tooMany || tooOld {
+			expired = append(expired, backup)
+		}
+	}
+
+	return expired
+}
+
+// orphanedObjects returns the stored objects no backup row refers to anymore
+func orphanedObjects(objects []string, backups []db.Backup) []string {
+
+	known := map[string]bool{}
+
+	for _, backup := range backups {
+		known[backup.Object] = true
+	}
+
+	orphaned := []string{}
+
+	for _, object := range objects {
+		if !known[object] {
+			orphaned = append(orphaned, object)
+		}
+	}
+
+	return orphaned
+}
+
+// ApplyRetention deletes the server's backups beyond the configured count and age
+func ApplyRetention(ctx context.Context, serverId uint) error {
+
+	keep := config.LoadedConfiguration.Backups.Keep
+	maxAge := time.Duration(config.LoadedConfiguration.Backups.MaxAge) * 24 * time.Hour
+
+	backups := []db.Backup{}
+
+	err := db.OpenedConnection.
+		Where("server_id = ? AND status = ?", serverId, db.BACKUP_READY).
+		Order("created_at DESC").
+		Find(&backups).Error
+
+	if err != nil {
+		return err
+	}
+
+	for _, backup := range expiredBackups(backups, keep, maxAge, time.Now()) {
+		err = DeleteBackup(ctx, backup)
+
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Deleted backup " + backup.Object + " by retention")
+	}
+
+	return nil
+}
+
+// removeOrphans deletes objects of the server that no backup row refers to, e.g. left
+// behind when deleting the row failed after the upload
+func removeOrphans(ctx context.Context, serverId uint) error {
+
+	objects, err := BackupStorage.List(ctx, fmt.Sprintf("servers/%d/", serverId))
+
+	if err != nil {
+		return err
+	}
+
+	backups := []db.Backup{}
+
+	err = db.OpenedConnection.Where("server_id = ?", serverId).Find(&backups).Error
+
+	if err != nil {
+		return err
+	}
+
+	for _, object := range orphanedObjects(objects, backups) {
+		err = BackupStorage.Delete(ctx, object)
+
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Deleted orphaned backup object " + object)
+	}
+
+	return nil
+}
+
+// StartRetentionMonitor applies the age limit to servers that aren't backed up anymore
+// and cleans up objects without a backup row
+func StartRetentionMonitor(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		serverIds := []uint{}
+		db.OpenedConnection.Model(&db.Backup{}).Distinct().Pluck("server_id", &serverIds)
+
+		for _, serverId := range serverIds {
+			err := ApplyRetention(ctx, serverId)
+
+			if err != nil {
+				logger.Error("Error applying backup retention of server " + strconv.Itoa(int(serverId)) + ": " + err.Error())
+			}
+
+			err = removeOrphans(ctx, serverId)
+
+			if err != nil {
+				logger.Error("Error removing orphaned backups of server " + strconv.Itoa(int(serverId)) + ": " + err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package backups
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+)
+
+func TestExpiredBackups(t *testing.T) {
+
+	now := time.Date(2022, 10, 10, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	// Newest first, like ApplyRetention loads them
+	backups := []db.Backup{
+		{Object: "a", CreatedAt: now.Add(-time.Hour)},
+		{Object: "b", CreatedAt: now.Add(-2 * day)},
+		{Object: "c", CreatedAt: now.Add(-10 * day)},
+		{Object: "d", CreatedAt: now.Add(-40 * day)},
+	}
+
+	tests := []struct {
+		name   string
+		keep   int
+		maxAge time.Duration
+		want   string
+	}{
+		{name: "no limits", want: ""},
+		{name: "count", keep: 2, want: "c,d"},
+		{name: "age", maxAge: 30 * day, want: "d"},
+		{name: "both", keep: 3, maxAge: 5 * day, want: "c,d"},
+		{name: "keep more than exist", keep: 10, want: ""},
+	}
+
+	for _, test := range tests {
+		objects := []string{}
+
+		for _, backup := range expiredBackups(backups, test.keep, test.maxAge, now) {
+			objects = append(objects, backup.Object)
+		}
+
+		if got := strings.Join(objects, ","); got != test.want {
+			t.Errorf("%s: expired %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOrphanedObjects(t *testing.T) {
+
+	backups := []db.Backup{
+		{Object: "servers/1/a.tar.zst", Status: db.BACKUP_READY},
+		{Object: "servers/1/b.tar.zst", Status: db.BACKUP_CREATING},
+	}
+
+	objects := []string{"servers/1/a.tar.zst", "servers/1/b.tar.zst", "servers/1/c.tar.zst"}
+
+	got := orphanedObjects(objects, backups)
+
+	if strings.Join(got, ",") != "servers/1/c.tar.zst" {
+		t.Errorf("orphaned %v, want only c", got)
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+
+	storage := NewLocalStorage(t.TempDir())
+	ctx := context.Background()
+
+	for _, object := range []string{"servers/1/a.tar.zst", "servers/1/b.tar.zst", "servers/2/a.tar.zst"} {
+		err := storage.Put(ctx, object, strings.NewReader(object), int64(len(object)))
+
+		if err != nil {
+			t.Fatalf("Put(%q): %v", object, err)
+		}
+	}
+
+	// Leftover of an interrupted upload
+	os.WriteFile(filepath.Join(storage.Directory, "servers", "1", ".upload-123"), []byte("x"), 0644)
+
+	listed, err := storage.List(ctx, "servers/1/")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(listed, ",") != "servers/1/a.tar.zst,servers/1/b.tar.zst" {
+		t.Errorf("List = %v", listed)
+	}
+
+	err = storage.Delete(ctx, "servers/1/a.tar.zst")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = storage.Get(ctx, "servers/1/a.tar.zst")
+
+	if err != ErrObjectNotFound {
+		t.Errorf("Get of a deleted object returned %v", err)
+	}
+
+	_, err = storage.Get(ctx, "../outside")
+
+	if err != ErrObjectNotFound {
+		t.Errorf("Get outside of the directory returned %v", err)
+	}
+
+	empty, err := NewLocalStorage(filepath.Join(storage.Directory, "missing")).List(ctx, "")
+
+	if err != nil || len(empty) != 0 {
+		t.Errorf("List of a missing directory = %v, %v", empty, err)
+	}
+}
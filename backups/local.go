@@ -0,0 +1,140 @@
+package backups
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type LocalStorage struct {
+	Directory string
+}
+
+func NewLocalStorage(directory string) *LocalStorage {
+	return &LocalStorage{Directory: directory}
+}
+
+func (s *LocalStorage) Name() string {
+	return STORAGE_LOCAL
+}
+
+func (s *LocalStorage) objectPath(object string) (string, error) {
+
+	target := filepath.Join(s.Directory, filepath.FromSlash(object))
+
+	if !strings.HasPrefix(target, filepath.Clean(s.Directory)+string(os.PathSeparator)) {
+		return "", ErrObjectNotFound
+	}
+
+	return target, nil
+}
+
+// Put writes to a temporary file first so a failed upload never leaves a truncated archive
+func (s *LocalStorage) Put(ctx context.Context, object string, data io.Reader, size int64) error {
+
+	target, err := s.objectPath(object)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), os.ModePerm)
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, data)
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), target)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, object string) (io.ReadCloser, error) {
+
+	target, err := s.objectPath(object)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+
+	return file, err
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, object string) error {
+
+	target, err := s.objectPath(object)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(target)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]string, error) {
+
+	objects := []string{}
+
+	err := filepath.Walk(s.Directory, func(filePath string, info os.FileInfo, err error) error {
+
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		object, err := filepath.Rel(s.Directory, filePath)
+
+		if err != nil {
+			return err
+		}
+
+		object = filepath.ToSlash(object)
+
+		// Unfinished uploads aren't objects yet
+		if strings.HasPrefix(info.Name(), ".upload-") || !strings.HasPrefix(object, prefix) {
+			return nil
+		}
+
+		objects = append(objects, object)
+
+		return nil
+	})
+
+	return objects, err
+}
@@ -0,0 +1,343 @@
+package backups
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Storage talks to S3 compatible storage (aws, minio, r2, ...) with plain
+// http requests signed with AWS signature version 4
+type S3Storage struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+	Client    *http.Client
+}
+
+// Bodies are streamed, so their hash isn't part of the signature
+const UNSIGNED_PAYLOAD = "UNSIGNED-PAYLOAD"
+
+var emptyPayloadHash = hex.EncodeToString(sha256Sum(nil))
+
+func sha256Sum(data []byte) []byte {
+	hash := sha256.Sum256(data)
+
+	return hash[:]
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// s3Escape is the uri encoding of the signing spec, every byte but the unreserved ones
+func s3Escape(value string, keepSlash bool) string {
+
+	var builder strings.Builder
+
+	for _, b := range []byte(value) {
+		unreserved := (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '.' || b == '_' || b == '~'
+
+		if unreserved || (keepSlash && b == '/') {
+			builder.WriteByte(b)
+			continue
+		}
+
+		fmt.Fprintf(&builder, "%%%02X", b)
+	}
+
+	return builder.String()
+}
+
+// canonicalQuery sorts and escapes the query the way it's signed, the request is sent
+// with exactly this query so both always match
+func canonicalQuery(query url.Values) string {
+
+	keys := []string{}
+
+	for key := range query {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	pairs := []string{}
+
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func (s *S3Storage) Name() string {
+	return STORAGE_S3
+}
+
+func (s *S3Storage) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (s *S3Storage) region() string {
+	if s.Region == "" {
+		return "us-east-1"
+	}
+
+	return s.Region
+}
+
+func (s *S3Storage) objectURL(object string) (*url.URL, error) {
+
+	endpoint := s.Endpoint
+
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	base, err := url.Parse(endpoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	objectPath := "/" + strings.TrimPrefix(object, "/")
+
+	if s.PathStyle {
+		objectPath = "/" + s.Bucket + objectPath
+	} else {
+		base.Host = s.Bucket + "." + base.Host
+	}
+
+	base.Path = objectPath
+	base.RawPath = s3Escape(objectPath, true)
+
+	return base, nil
+}
+
+func (s *S3Storage) newRequest(ctx context.Context, method string, object string, query url.Values, body io.Reader, payloadHash string) (*http.Request, error) {
+
+	target, err := s.objectURL(object)
+
+	if err != nil {
+		return nil, err
+	}
+
+	target.RawQuery = canonicalQuery(query)
+
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.sign(request, payloadHash, time.Now().UTC())
+
+	return request, nil
+}
+
+func (s *S3Storage) sign(request *http.Request, payloadHash string, now time.Time) {
+
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	request.Header.Set("x-amz-date", amzDate)
+	request.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		"host:" + request.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region() + "/s3/aws4_request"
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSha256(key, s.region())
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func responseError(response *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+
+	return fmt.Errorf("s3 responded %s: %s", response.Status, strings.TrimSpace(string(body)))
+}
+
+func (s *S3Storage) Put(ctx context.Context, object string, data io.Reader, size int64) error {
+
+	request, err := s.newRequest(ctx, http.MethodPut, object, nil, data, UNSIGNED_PAYLOAD)
+
+	if err != nil {
+		return err
+	}
+
+	request.ContentLength = size
+
+	response, err := s.client().Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return responseError(response)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, object string) (io.ReadCloser, error) {
+
+	request, err := s.newRequest(ctx, http.MethodGet, object, nil, nil, emptyPayloadHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.client().Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, ErrObjectNotFound
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return nil, responseError(response)
+	}
+
+	return response.Body, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, object string) error {
+
+	request, err := s.newRequest(ctx, http.MethodDelete, object, nil, nil, emptyPayloadHash)
+
+	if err != nil {
+		return err
+	}
+
+	response, err := s.client().Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	// Deleting a missing object succeeds on s3 as well
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotFound {
+		return responseError(response)
+	}
+
+	return nil
+}
+
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+}
+
+// List pages through ListObjectsV2 until the listing isn't truncated anymore
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]string, error) {
+
+	objects := []string{}
+	token := ""
+
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		request, err := s.newRequest(ctx, http.MethodGet, "", query, nil, emptyPayloadHash)
+
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := s.client().Do(request)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if response.StatusCode != http.StatusOK {
+			defer response.Body.Close()
+			return nil, responseError(response)
+		}
+
+		result := listBucketResult{}
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, content := range result.Contents {
+			objects = append(objects, content.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+
+		token = result.NextContinuationToken
+	}
+}
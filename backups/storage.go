@@ -0,0 +1,63 @@
+package backups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+)
+
+const (
+	STORAGE_LOCAL = "local"
+	STORAGE_S3    = "s3"
+)
+
+var ErrObjectNotFound = errors.New("backup object not found")
+
+// Storage keeps the archives. Objects are addressed by name and tracked in the backups
+// table, List is only used to find objects the table lost track of.
+type Storage interface {
+	Name() string
+	Put(ctx context.Context, object string, data io.Reader, size int64) error
+	Get(ctx context.Context, object string) (io.ReadCloser, error)
+	Delete(ctx context.Context, object string) error
+	// List returns the names of all objects starting with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+var BackupStorage Storage
+
+func Init() error {
+
+	cfg := config.LoadedConfiguration.Backups
+
+	switch cfg.Storage {
+	case "", STORAGE_LOCAL:
+		directory := cfg.Directory
+
+		if directory == "" {
+			directory = "/data/backups"
+		}
+
+		BackupStorage = NewLocalStorage(directory)
+	case STORAGE_S3:
+		if cfg.S3.Endpoint == "" || cfg.S3.Bucket == "" {
+			return errors.New("s3 backup storage needs an endpoint and a bucket")
+		}
+
+		BackupStorage = &S3Storage{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			PathStyle: cfg.S3.PathStyle,
+		}
+	default:
+		return fmt.Errorf("unknown backup storage %q", cfg.Storage)
+	}
+
+	return nil
+}
@@ -0,0 +1,447 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/logger"
+	"github.com/go-redis/redis/v9"
+)
+
+// Requests published by the api itself carry this source and are skipped by the dispatcher
+const SOURCE_API = "api"
+
+const DEFAULT_WORKERS = 4
+
+// How often the streams consumer picks up new servers and reclaims stale entries
+const STREAM_REFRESH = 30 * time.Second
+
+var ErrUnknownTarget = errors.New("no handler for target")
+
+// HandlerFunc handles one verified request, the result is sent back as the response data
+type HandlerFunc func(ctx context.Context, serverId uint, request MinecraftRequest) (interface{}, error)
+
+type HandlerStats struct {
+	Handled   int64     `json:"handled"`
+	Failed    int64     `json:"failed"`
+	LastError string    `json:"last_error,omitempty"`
+	LastRun   time.Time `json:"last_run"`
+}
+
+type dispatchedRequest struct {
+	serverId uint
+	request  MinecraftRequest
+	// Stream entry acknowledged once handled, empty in pub/sub mode
+	entryId string
+}
+
+type Dispatcher struct {
+	Workers  int
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	stats    map[string]*HandlerStats
+	queue    chan dispatchedRequest
+	pubsub   *redis.PubSub
+	cancel   context.CancelFunc
+	workers  sync.WaitGroup
+	running  bool
+}
+
+var RequestDispatcher = NewDispatcher(DEFAULT_WORKERS)
+
+func NewDispatcher(workers int) *Dispatcher {
+	return &Dispatcher{
+		Workers:  workers,
+		handlers: map[string]HandlerFunc{},
+		stats:    map[string]*HandlerStats{},
+	}
+}
+
+func (d *Dispatcher) Handle(target string, handler HandlerFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.handlers[target] = handler
+	d.stats[target] = &HandlerStats{}
+}
+
+func (d *Dispatcher) Stats() map[string]HandlerStats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	stats := map[string]HandlerStats{}
+
+	for target, s := range d.stats {
+		stats[target] = *s
+	}
+
+	return stats
+}
+
+// Start feeds verified requests to the worker pool, from servers:*:request or in streams
+// mode from the servers:<id>:to-api streams
+func (d *Dispatcher) Start() error {
+
+	ctx := context.Background()
+
+	var pubsub *redis.PubSub
+
+	if !UseStreams() {
+		pubsub = RedisConnection.PSubscribe(ctx, "servers:*:request")
+
+		_, err := pubsub.Receive(ctx)
+
+		if err != nil {
+			pubsub.Close()
+			return err
+		}
+	}
+
+	workers := d.Workers
+
+	if workers <= 0 {
+		workers = DEFAULT_WORKERS
+	}
+
+	d.pubsub = pubsub
+	d.queue = make(chan dispatchedRequest, workers*16)
+	d.running = true
+
+	for i := 0; i < workers; i++ {
+		d.workers.Add(1)
+		go d.work()
+	}
+
+	if pubsub != nil {
+		go d.receive(pubsub.Channel())
+	} else {
+		consumeCtx, cancel := context.WithCancel(ctx)
+		d.cancel = cancel
+		go d.consume(consumeCtx)
+	}
+
+	logger.Info("Request dispatcher started with " + strconv.Itoa(workers) + " workers")
+
+	return nil
+}
+
+// Shutdown stops receiving and waits for queued requests to finish, or for ctx to expire
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+
+	if !d.running {
+		return nil
+	}
+
+	d.running = false
+
+	// Ending the subscription or the consumer closes the queue, which ends the workers
+	if d.pubsub != nil {
+		d.pubsub.Close()
+	}
+
+	if d.cancel != nil {
+		d.cancel()
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		d.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Info("Request dispatcher stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) receive(messages <-chan *redis.Message) {
+
+	defer close(d.queue)
+
+	for msg := range messages {
+
+		parts := strings.Split(msg.Channel, ":")
+
+		if len(parts) != 3 {
+			logger.Error("Invalid request channel " + msg.Channel)
+			continue
+		}
+
+		serverId, err := strconv.Atoi(parts[1])
+
+		if err != nil {
+			logger.Error("Invalid request channel " + msg.Channel)
+			continue
+		}
+
+		request, ok := decodeRequest(uint(serverId), msg.Channel, msg.Payload)
+
+		if ok {
+			d.queue <- dispatchedRequest{serverId: uint(serverId), request: request}
+		}
+	}
+}
+
+// decodeRequest parses and verifies a request, false for anything that must not be handled
+func decodeRequest(serverId uint, source string, payload string) (MinecraftRequest, bool) {
+
+	var m MinecraftRequest
+
+	err := json.Unmarshal([]byte(payload), &m)
+
+	if err != nil {
+		logger.Error("Invalid request on " + source + ": " + err.Error())
+		return m, false
+	}
+
+	if m.Source == SOURCE_API {
+		return m, false
+	}
+
+	err = m.Verify(serverId)
+
+	if err != nil {
+		logger.Error("Rejected request from " + source + ": " + err.Error())
+		return m, false
+	}
+
+	return m, true
+}
+
+// Each replica reads under its own consumer name, so entries are split between replicas
+func consumerName() string {
+
+	hostname, err := os.Hostname()
+
+	if err != nil {
+		hostname = "api"
+	}
+
+	return hostname + "-" + strconv.Itoa(os.Getpid())
+}
+
+func (d *Dispatcher) consume(ctx context.Context) {
+
+	defer close(d.queue)
+
+	consumer := consumerName()
+	servers := map[string]uint{}
+	refreshed := time.Time{}
+
+	for ctx.Err() == nil {
+
+		if time.Since(refreshed) > STREAM_REFRESH {
+			servers = d.refreshStreams(ctx, consumer)
+			refreshed = time.Now()
+		}
+
+		if len(servers) == 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+
+			continue
+		}
+
+		streams := []string{}
+		ids := []string{}
+
+		for stream := range servers {
+			streams = append(streams, stream)
+			ids = append(ids, ">")
+		}
+
+		result, err := RedisConnection.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    API_GROUP,
+			Consumer: consumer,
+			Streams:  append(streams, ids...),
+			Count:    16,
+			Block:    2 * time.Second,
+		}).Result()
+
+		if err == redis.Nil || ctx.Err() != nil {
+			continue
+		}
+
+		if err != nil {
+			logger.Error("Error reading request streams: " + err.Error())
+			// A removed stream or group is recreated on the next refresh
+			refreshed = time.Time{}
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, stream := range result {
+			for _, message := range stream.Messages {
+				d.enqueue(servers[stream.Stream], stream.Stream, message)
+			}
+		}
+	}
+}
+
+// refreshStreams makes sure every server's stream has the api group and takes over entries
+// another consumer read but never acknowledged, e.g. because its replica stopped
+func (d *Dispatcher) refreshStreams(ctx context.Context, consumer string) map[string]uint {
+
+	serverIds := []uint{}
+	db.OpenedConnection.Model(&db.Server{}).Pluck("id", &serverIds)
+
+	servers := map[string]uint{}
+
+	for _, serverId := range serverIds {
+		stream := ApiStream(serverId)
+
+		err := ensureGroup(ctx, stream, API_GROUP)
+
+		if err != nil {
+			logger.Error("Error creating consumer group for " + stream + ": " + err.Error())
+			continue
+		}
+
+		servers[stream] = serverId
+
+		claimed, _, err := RedisConnection.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    API_GROUP,
+			MinIdle:  STREAM_CLAIM_IDLE,
+			Start:    "0-0",
+			Count:    16,
+			Consumer: consumer,
+		}).Result()
+
+		if err != nil {
+			logger.Error("Error claiming stale requests of " + stream + ": " + err.Error())
+			continue
+		}
+
+		for _, message := range claimed {
+			d.enqueue(serverId, stream, message)
+		}
+	}
+
+	return servers
+}
+
+func (d *Dispatcher) enqueue(serverId uint, stream string, message redis.XMessage) {
+
+	payload, _ := message.Values["payload"].(string)
+
+	request, ok := decodeRequest(serverId, stream, payload)
+
+	// Entries that can never be handled are acknowledged right away
+	if !ok {
+		RedisConnection.XAck(context.Background(), stream, API_GROUP, message.ID)
+		return
+	}
+
+	d.queue <- dispatchedRequest{serverId: serverId, request: request, entryId: message.ID}
+}
+
+func (d *Dispatcher) work() {
+
+	defer d.workers.Done()
+
+	for item := range d.queue {
+		d.dispatch(item.serverId, item.request)
+
+		if item.entryId != "" {
+			err := RedisConnection.XAck(context.Background(), ApiStream(item.serverId), API_GROUP, item.entryId).Err()
+
+			if err != nil {
+				logger.Error("Error acknowledging request " + item.entryId + ": " + err.Error())
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(serverId uint, request MinecraftRequest) {
+
+	d.mu.RLock()
+	handler, ok := d.handlers[request.Target]
+	d.mu.RUnlock()
+
+	if !ok {
+		logger.Warning("No handler for target " + request.Target + " from server " + strconv.Itoa(int(serverId)))
+		d.reply(serverId, request, nil, ErrUnknownTarget)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	result, err := d.run(ctx, handler, serverId, request)
+
+	d.mu.Lock()
+	stats := d.stats[request.Target]
+	stats.Handled++
+	stats.LastRun = time.Now()
+
+	if err != nil {
+		stats.Failed++
+		stats.LastError = err.Error()
+	}
+	d.mu.Unlock()
+
+	if err != nil {
+		logger.Error("Handler " + request.Target + " failed for server " + strconv.Itoa(int(serverId)) + ": " + err.Error())
+	}
+
+	d.reply(serverId, request, result, err)
+}
+
+// A panicking handler is reported like any other error instead of killing the worker
+func (d *Dispatcher) run(ctx context.Context, handler HandlerFunc, serverId uint, request MinecraftRequest) (result interface{}, err error) {
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("handler panic: %v", recovered)
+		}
+	}()
+
+	return handler(ctx, serverId, request)
+}
+
+func (d *Dispatcher) reply(serverId uint, request MinecraftRequest, result interface{}, err error) {
+
+	response := MinecraftResponse{
+		ID:      request.ID,
+		Success: err == nil,
+	}
+
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	if result != nil {
+		data, marshalErr := json.Marshal(result)
+
+		if marshalErr != nil {
+			logger.Error("Error marshalling handler result: " + marshalErr.Error())
+		} else {
+			response.Data = data
+		}
+	}
+
+	body, marshalErr := json.Marshal(response)
+
+	if marshalErr != nil {
+		logger.Error("Error marshalling response: " + marshalErr.Error())
+		return
+	}
+
+	RedisConnection.Publish(context.Background(), fmt.Sprintf("servers:%d:response", serverId), body)
+}
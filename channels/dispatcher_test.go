@@ -0,0 +1,118 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/go-redis/redis/v9"
+)
+
+func TestDispatcherConsumesStreams(t *testing.T) {
+
+	setupMessaging(t, MESSAGING_STREAMS)
+	db.OpenedConnection.AutoMigrate(&db.Server{})
+	db.OpenedConnection.Create(&db.Server{ID: 1, Name: "lobby", ContainerName: "lobby"})
+
+	key, err := RotateSigningKey(1, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	responses := RedisConnection.Subscribe(ctx, "servers:1:response")
+	defer responses.Close()
+
+	_, err = responses.Receive(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(request MinecraftRequest) {
+
+		payload, _ := json.Marshal(request)
+
+		err := RedisConnection.XAdd(ctx, &redis.XAddArgs{Stream: ApiStream(1), Values: map[string]interface{}{"payload": payload}}).Err()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	signed := func(id string, target string) MinecraftRequest {
+		m := MinecraftRequest{ID: id, Target: target, Arguments: []string{"Notch"}}
+		m.Sign(key)
+		return m
+	}
+
+	// Sent before the dispatcher starts, the api group still gets them
+	send(signed("echo", "echo"))
+	send(MinecraftRequest{ID: "unsigned", Target: "echo"})
+	send(signed("failing", "fail"))
+	send(signed("unknown", "missing"))
+
+	dispatcher := NewDispatcher(2)
+	dispatcher.Handle("echo", func(ctx context.Context, serverId uint, request MinecraftRequest) (interface{}, error) {
+		return map[string]interface{}{"server": serverId, "name": request.Arguments[0]}, nil
+	})
+	dispatcher.Handle("fail", func(ctx context.Context, serverId uint, request MinecraftRequest) (interface{}, error) {
+		return nil, errors.New("no such player")
+	})
+
+	err = dispatcher.Start()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]MinecraftResponse{
+		"echo":    {ID: "echo", Success: true, Data: json.RawMessage(`{"name":"Notch","server":1}`)},
+		"failing": {ID: "failing", Error: "no such player"},
+		"unknown": {ID: "unknown", Error: ErrUnknownTarget.Error()},
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	for range expected {
+		msg, err := responses.ReceiveMessage(timeout)
+
+		if err != nil {
+			t.Fatalf("missing responses: %v", err)
+		}
+
+		var response MinecraftResponse
+		json.Unmarshal([]byte(msg.Payload), &response)
+
+		want, ok := expected[response.ID]
+
+		if !ok || response.Success != want.Success || response.Error != want.Error || string(response.Data) != string(want.Data) {
+			t.Errorf("response %+v, want %+v", response, want)
+		}
+	}
+
+	err = dispatcher.Shutdown(timeout)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Handled entries and the unsigned one are acknowledged
+	pending, err := RedisConnection.XPending(ctx, ApiStream(1), API_GROUP).Result()
+
+	if err != nil || pending.Count != 0 {
+		t.Errorf("%+v entries still pending (%v)", pending, err)
+	}
+
+	stats := dispatcher.Stats()
+
+	if stats["echo"].Handled != 1 || stats["fail"].Failed != 1 || stats["fail"].LastError != "no such player" {
+		t.Errorf("stats %+v", stats)
+	}
+}
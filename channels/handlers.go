@@ -0,0 +1,77 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+)
+
+func RegisterDefaultHandlers(d *Dispatcher) {
+	d.Handle("register_player", handleRegisterPlayer)
+	d.Handle("report_state", handleReportState)
+}
+
+// Arguments: username. Sent by a server when a player joins it. Sessions aren't moved here,
+// any server could claim any player, only the proxy's login and connect calls set their server.
+func handleRegisterPlayer(ctx context.Context, serverId uint, request MinecraftRequest) (interface{}, error) {
+
+	if request.UUID == "" || len(request.Arguments) < 1 || request.Arguments[0] == "" {
+		return nil, errors.New("register_player needs a uuid and a username")
+	}
+
+	uuid, err := db.NormalizeUUID(request.UUID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	user := db.User{}
+	db.OpenedConnection.WithContext(ctx).Table("users").Where("uuid = ?", uuid).First(&user)
+
+	if user.ID != 0 {
+		return user, nil
+	}
+
+	user = db.User{
+		UUID:      uuid,
+		Username:  request.Arguments[0],
+		CreatedAt: time.Now(),
+	}
+
+	err = db.OpenedConnection.WithContext(ctx).Table("users").Create(&user).Error
+
+	// The player joined two servers at once and the other registration won
+	if db.IsUniqueViolation(err) {
+		existing := db.User{}
+		err = db.OpenedConnection.WithContext(ctx).Table("users").Where("uuid = ?", uuid).First(&existing).Error
+
+		return existing, err
+	}
+
+	return user, err
+}
+
+// Arguments: state (e.g. starting, running, stopping)
+func handleReportState(ctx context.Context, serverId uint, request MinecraftRequest) (interface{}, error) {
+
+	if len(request.Arguments) < 1 || request.Arguments[0] == "" {
+		return nil, errors.New("report_state needs a state")
+	}
+
+	result := db.OpenedConnection.WithContext(ctx).Model(&db.Server{}).Where("id = ?", serverId).Updates(map[string]interface{}{
+		"state":            request.Arguments[0],
+		"state_updated_at": time.Now(),
+	})
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, errors.New("server not found")
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,34 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/db/dbtest"
+)
+
+func TestRegisterPlayerKeepsSessions(t *testing.T) {
+
+	dbtest.Open(t, &db.User{}, &db.PlayerSession{})
+
+	user := db.User{UUID: "069a79f4-44e9-4726-a5be-fca90e38aaf5", Username: "Notch"}
+	db.OpenedConnection.Table("users").Create(&user)
+	db.OpenedConnection.Create(&db.PlayerSession{UserID: user.ID, TokenHash: "hash", ServerID: 1, ExpiresAt: time.Now().Add(time.Hour)})
+
+	request := MinecraftRequest{UUID: user.UUID, Arguments: []string{"Notch"}}
+
+	_, err := handleRegisterPlayer(context.Background(), 2, request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := db.PlayerSession{}
+	db.OpenedConnection.First(&session)
+
+	if session.ServerID != 1 {
+		t.Fatalf("register_player from server 2 moved the session to server %d", session.ServerID)
+	}
+}
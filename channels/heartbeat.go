@@ -0,0 +1,229 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/logger"
+)
+
+// Published by servers on servers:<id>:heartbeat, signed with the server's signing key
+type HeartbeatMessage struct {
+	Players    int     `json:"players"`
+	MaxPlayers int     `json:"max_players"`
+	TPS        float64 `json:"tps"`
+	MemoryUsed int64   `json:"memory_used"`
+	MemoryMax  int64   `json:"memory_max"`
+	EventSignature
+}
+
+// SignedFields are the signed values in order, tps with two decimals
+func (m HeartbeatMessage) SignedFields() []string {
+	return []string{
+		strconv.Itoa(m.Players),
+		strconv.Itoa(m.MaxPlayers),
+		strconv.FormatFloat(m.TPS, 'f', 2, 64),
+		strconv.FormatInt(m.MemoryUsed, 10),
+		strconv.FormatInt(m.MemoryMax, 10),
+	}
+}
+
+type LivenessEvent struct {
+	ServerId int       `json:"server_id"`
+	Liveness string    `json:"liveness"`
+	LastPing time.Time `json:"last_ping"`
+}
+
+func HeartbeatTimeout() time.Duration {
+	if config.LoadedConfiguration.Heartbeat.Timeout <= 0 {
+		return time.Minute
+	}
+
+	return time.Duration(config.LoadedConfiguration.Heartbeat.Timeout) * time.Second
+}
+
+func heartbeatRetention() time.Duration {
+	if config.LoadedConfiguration.Heartbeat.Retention <= 0 {
+		return 24 * time.Hour
+	}
+
+	return time.Duration(config.LoadedConfiguration.Heartbeat.Retention) * time.Hour
+}
+
+// Liveness derives the state from LastPing, for servers the monitor hasn't looked at yet
+func Liveness(server db.Server) string {
+
+	if server.LastPing.IsZero() {
+		return db.LIVENESS_UNKNOWN
+	}
+
+	if time.Since(server.LastPing) > HeartbeatTimeout() {
+		return db.LIVENESS_UNRESPONSIVE
+	}
+
+	return db.LIVENESS_ALIVE
+}
+
+func StartHeartbeatListener(ctx context.Context) error {
+
+	pubsub := RedisConnection.PSubscribe(ctx, "servers:*:heartbeat")
+
+	_, err := pubsub.Receive(ctx)
+
+	if err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go func() {
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				err := recordHeartbeat(msg.Channel, msg.Payload)
+
+				if err != nil {
+					logger.Error("Error recording heartbeat from " + msg.Channel + ": " + err.Error())
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func recordHeartbeat(channel string, payload string) error {
+
+	parts := strings.Split(channel, ":")
+
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid heartbeat channel")
+	}
+
+	serverId, err := strconv.Atoi(parts[1])
+
+	if err != nil {
+		return err
+	}
+
+	var message HeartbeatMessage
+
+	err = json.Unmarshal([]byte(payload), &message)
+
+	if err != nil {
+		return err
+	}
+
+	server := db.Server{}
+	db.OpenedConnection.First(&server, serverId)
+
+	if server.ID == 0 {
+		return fmt.Errorf("unknown server %d", serverId)
+	}
+
+	// Anyone on redis could otherwise keep a crashed server looking alive
+	err = message.Verify(server.ID, channel, message.SignedFields()...)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	err = db.OpenedConnection.Create(&db.Heartbeat{
+		ServerID:   server.ID,
+		Players:    message.Players,
+		MaxPlayers: message.MaxPlayers,
+		TPS:        message.TPS,
+		MemoryUsed: message.MemoryUsed,
+		MemoryMax:  message.MemoryMax,
+		CreatedAt:  now,
+	}).Error
+
+	if err != nil {
+		return err
+	}
+
+	err = db.OpenedConnection.Model(&server).Updates(map[string]interface{}{
+		"last_ping": now,
+		"liveness":  db.LIVENESS_ALIVE,
+	}).Error
+
+	if err != nil {
+		return err
+	}
+
+	if server.Liveness == db.LIVENESS_UNRESPONSIVE {
+		logger.Info("Server " + server.Name + " is responsive again")
+		publishLiveness(server.ID, db.LIVENESS_ALIVE, now)
+	}
+
+	return nil
+}
+
+// StartHeartbeatMonitor marks servers unresponsive once their heartbeats stop and prunes old history
+func StartHeartbeatMonitor(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deadline := time.Now().Add(-HeartbeatTimeout())
+
+		stale := []db.Server{}
+		db.OpenedConnection.Where("liveness = ? AND last_ping < ?", db.LIVENESS_ALIVE, deadline).Find(&stale)
+
+		for _, server := range stale {
+			result := db.OpenedConnection.Model(&db.Server{}).
+				Where("id = ? AND liveness = ? AND last_ping < ?", server.ID, db.LIVENESS_ALIVE, deadline).
+				Update("liveness", db.LIVENESS_UNRESPONSIVE)
+
+			// Another replica or a fresh heartbeat got there first
+			if result.Error != nil || result.RowsAffected == 0 {
+				continue
+			}
+
+			logger.Warning("Server " + server.Name + " stopped sending heartbeats")
+			publishLiveness(server.ID, db.LIVENESS_UNRESPONSIVE, server.LastPing)
+		}
+
+		db.OpenedConnection.Where("created_at < ?", time.Now().Add(-heartbeatRetention())).Delete(&db.Heartbeat{})
+	}
+}
+
+func publishLiveness(serverId uint, liveness string, lastPing time.Time) {
+
+	body, err := json.Marshal(LivenessEvent{
+		ServerId: int(serverId),
+		Liveness: liveness,
+		LastPing: lastPing,
+	})
+
+	if err != nil {
+		logger.Error("Error marshalling liveness event: " + err.Error())
+		return
+	}
+
+	PublishEvent("servers:"+liveness, body)
+}
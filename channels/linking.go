@@ -0,0 +1,129 @@
+package channels
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/logger"
+	"github.com/go-redis/redis/v9"
+)
+
+// Codes are typed into discord by hand, so they are short and leave out 0/O and 1/I
+const (
+	LINK_CODE_ALPHABET = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	LINK_CODE_LENGTH   = 6
+	LINK_CODE_TTL      = 5 * time.Minute
+)
+
+var ErrInvalidLinkCode = errors.New("link code is invalid, expired or already used")
+
+// Published on players:linked and players:unlinked
+type LinkEvent struct {
+	UUID      string `json:"uuid"`
+	Username  string `json:"username"`
+	DiscordID uint64 `json:"discord_id,string"`
+}
+
+func linkCodeKey(code string) string {
+	return "link:code:" + code
+}
+
+// Only the latest code of a player is valid
+func playerLinkKey(uuid string) string {
+	return "link:player:" + uuid
+}
+
+func generateLinkCode() (string, error) {
+
+	code := make([]byte, LINK_CODE_LENGTH)
+	max := big.NewInt(int64(len(LINK_CODE_ALPHABET)))
+
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+
+		if err != nil {
+			return "", err
+		}
+
+		code[i] = LINK_CODE_ALPHABET[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// CreateLinkCode stores a new single use code for the player, replacing the previous one
+func CreateLinkCode(ctx context.Context, uuid string) (string, error) {
+
+	previous, err := RedisConnection.Get(ctx, playerLinkKey(uuid)).Result()
+
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+
+	if previous != "" {
+		RedisConnection.Del(ctx, linkCodeKey(previous))
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := generateLinkCode()
+
+		if err != nil {
+			return "", err
+		}
+
+		// SetNX so a colliding code of another player is never overwritten
+		created, err := RedisConnection.SetNX(ctx, linkCodeKey(code), uuid, LINK_CODE_TTL).Result()
+
+		if err != nil {
+			return "", err
+		}
+
+		if !created {
+			continue
+		}
+
+		err = RedisConnection.Set(ctx, playerLinkKey(uuid), code, LINK_CODE_TTL).Err()
+
+		return code, err
+	}
+
+	return "", errors.New("couldn't generate a free link code")
+}
+
+// RedeemLinkCode consumes the code and returns the uuid it was issued for
+func RedeemLinkCode(ctx context.Context, code string) (string, error) {
+
+	uuid, err := RedisConnection.GetDel(ctx, linkCodeKey(code)).Result()
+
+	if err == redis.Nil {
+		return "", ErrInvalidLinkCode
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	RedisConnection.Del(ctx, playerLinkKey(uuid))
+
+	return uuid, nil
+}
+
+func PublishLinkEvent(channel string, event LinkEvent) {
+
+	body, err := json.Marshal(event)
+
+	if err != nil {
+		logger.Error("Error marshalling link event: " + err.Error())
+		return
+	}
+
+	err = PublishEvent(channel, body)
+
+	if err != nil {
+		logger.Error("Error publishing " + channel + ": " + err.Error())
+	}
+}
@@ -2,89 +2,156 @@ package channels
 
 import (
 	"context"
-	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/Lisek-World-Reborn/lisek-api/logger"
 )
 
 type MinecraftRequest struct {
+	ID        string   `json:"id"`
 	UUID      string   `json:"uuid"`
 	Target    string   `json:"target"`
 	Arguments []string `json:"arguments"`
-	Hash      string   `json:"hash"`
+	Timestamp int64    `json:"timestamp"`
+	Nonce     string   `json:"nonce"`
+	KeyID     string   `json:"key_id"`
+	Signature string   `json:"signature"`
+	Source    string   `json:"source,omitempty"`
 }
 
-type ServerAddedRequest struct {
-	ServerId int `json:"server_id"`
+// Published by plugins on servers:<id>:response, ID matches the request being answered
+type MinecraftResponse struct {
+	ID      string          `json:"id"`
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
 }
 
-func (m MinecraftRequest) IsValid() bool {
-	stringToHash := m.UUID + m.Target + strings.Join(m.Arguments, " ")
+var ErrResponseTimeout = errors.New("timed out waiting for server response")
 
-	return m.Hash == GenerateHash(stringToHash)
+type ServerAddedRequest struct {
+	ServerId int `json:"server_id"`
 }
 
-func GenerateHash(stringToHash string) string {
-	md5hash := md5.New()
+type ServerRemovedRequest struct {
+	ServerId int    `json:"server_id"`
+	Data     string `json:"data"`
+}
 
-	md5hash.Write([]byte(stringToHash))
+func GenerateRequestId() string {
+	buffer := make([]byte, 16)
+	rand.Read(buffer)
 
-	return fmt.Sprintf("%x", md5hash.Sum(nil))
+	return hex.EncodeToString(buffer)
 }
 
-func (m MinecraftRequest) SendToServer(serverId string) (bool, error) {
+func (m MinecraftRequest) SendToServer(serverId uint) (bool, error) {
 
-	if !m.IsValid() {
-		return false, fmt.Errorf("invalid request (hash mismatch)")
+	if m.ID == "" {
+		m.ID = GenerateRequestId()
 	}
-	ctx := context.Background()
 
-	body, err := json.Marshal(m)
+	m.Source = SOURCE_API
+
+	key, err := ActiveSigningKey(serverId)
 
 	if err != nil {
 		return false, err
 	}
 
-	cmd := RedisConnection.Publish(ctx, fmt.Sprintf("servers:%s:request", serverId), body)
+	m.Sign(key)
+
+	err = m.publish(context.Background(), serverId)
 
-	if cmd.Err() != nil {
-		return false, cmd.Err()
+	if err != nil {
+		return false, err
 	}
 
 	return true, nil
 }
 
-func StartAcceptingRequests() {
-	ctx := context.Background()
+// SendToServerAndWait publishes the request and blocks until the plugin answers on
+// servers:<id>:response with the same ID, or the timeout passes
+func (m MinecraftRequest) SendToServerAndWait(serverId uint, timeout time.Duration) (*MinecraftResponse, error) {
 
-	pubsub := RedisConnection.Subscribe(ctx, "servers:*:request")
+	if m.ID == "" {
+		m.ID = GenerateRequestId()
+	}
+
+	m.Source = SOURCE_API
+
+	key, err := ActiveSigningKey(serverId)
 
+	if err != nil {
+		return nil, err
+	}
+
+	m.Sign(key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	pubsub := RedisConnection.Subscribe(ctx, fmt.Sprintf("servers:%d:response", serverId))
 	defer pubsub.Close()
-	for {
 
-		msg, err := pubsub.ReceiveMessage(ctx)
+	// Wait for the subscription to be confirmed, otherwise a fast reply could be missed
+	_, err = pubsub.Receive(ctx)
 
-		if err != nil {
-			logger.Error(err.Error() + " - Channel listening ")
-			continue
-		}
+	if err != nil {
+		return nil, err
+	}
 
-		var m MinecraftRequest
+	err = m.publish(ctx, serverId)
 
-		err = json.Unmarshal([]byte(msg.Payload), &m)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			logger.Error(err.Error())
-			continue
-		}
+	messages := pubsub.Channel()
 
-		if !m.IsValid() {
-			logger.Error("invalid request (hash mismatch)")
-			continue
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return nil, ErrResponseTimeout
+			}
+
+			var response MinecraftResponse
+
+			err := json.Unmarshal([]byte(msg.Payload), &response)
+
+			if err != nil {
+				logger.Error("Invalid response on " + msg.Channel + ": " + err.Error())
+				continue
+			}
+
+			if response.ID == m.ID {
+				return &response, nil
+			}
+		case <-ctx.Done():
+			return nil, ErrResponseTimeout
 		}
-		logger.Info(fmt.Sprintf("received request from %s: %s", msg.Channel, msg.Payload))
 	}
 }
+
+func (m MinecraftRequest) publish(ctx context.Context, serverId uint) error {
+
+	body, err := json.Marshal(m)
+
+	if err != nil {
+		return err
+	}
+
+	return publishRequest(ctx, serverId, body)
+}
+
+func StartAcceptingRequests() error {
+	RegisterDefaultHandlers(RequestDispatcher)
+
+	return RequestDispatcher.Start()
+}
@@ -0,0 +1,177 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/db/dbtest"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+)
+
+func setupMessaging(t *testing.T, mode string) {
+
+	dbtest.Open(t, &db.SigningKey{})
+
+	previousRedis, previousMode := RedisConnection, config.LoadedConfiguration.Messaging.Mode
+
+	RedisConnection = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	config.LoadedConfiguration.Messaging.Mode = mode
+
+	t.Cleanup(func() {
+		RedisConnection.Close()
+		RedisConnection, config.LoadedConfiguration.Messaging.Mode = previousRedis, previousMode
+	})
+}
+
+// fakeServer plays the plugin: it takes the first request sent to serverId and publishes
+// the responses on replyTo's response channel, "{{id}}" stands for a successful answer
+func fakeServer(t *testing.T, serverId uint, replyTo uint, responses ...string) <-chan MinecraftRequest {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	var pubsub *redis.PubSub
+
+	// Subscribed before the api publishes, pub/sub doesn't keep messages
+	if !UseStreams() {
+		pubsub = RedisConnection.Subscribe(ctx, fmt.Sprintf("servers:%d:request", serverId))
+
+		_, err := pubsub.Receive(ctx)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := make(chan MinecraftRequest, 1)
+
+	go func() {
+
+		defer cancel()
+		defer close(received)
+
+		var payload string
+
+		if pubsub != nil {
+			defer pubsub.Close()
+
+			msg, err := pubsub.ReceiveMessage(ctx)
+
+			if err != nil {
+				t.Errorf("plugin didn't get the request: %v", err)
+				return
+			}
+
+			payload = msg.Payload
+		} else {
+			result, err := RedisConnection.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{RequestStream(serverId), "0-0"},
+				Count:   1,
+				Block:   time.Second,
+			}).Result()
+
+			if err != nil {
+				t.Errorf("plugin didn't get the request: %v", err)
+				return
+			}
+
+			payload, _ = result[0].Messages[0].Values["payload"].(string)
+		}
+
+		var request MinecraftRequest
+		json.Unmarshal([]byte(payload), &request)
+
+		for _, response := range responses {
+			if response == "{{id}}" {
+				response = fmt.Sprintf(`{"id": %q, "success": true, "data": {"online": 3}}`, request.ID)
+			}
+
+			RedisConnection.Publish(ctx, fmt.Sprintf("servers:%d:response", replyTo), response)
+		}
+
+		received <- request
+	}()
+
+	return received
+}
+
+func TestSendToServerAndWait(t *testing.T) {
+
+	for _, mode := range []string{MESSAGING_PUBSUB, MESSAGING_STREAMS} {
+		t.Run(mode, func(t *testing.T) {
+
+			setupMessaging(t, mode)
+
+			received := fakeServer(t, 1, 1,
+				`not json`,
+				`{"id": "someone-else", "success": false, "error": "wrong request"}`,
+				"{{id}}",
+			)
+
+			response, err := MinecraftRequest{Target: "players", Arguments: []string{"online"}}.SendToServerAndWait(1, 2*time.Second)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			request := <-received
+
+			if response.ID != request.ID || !response.Success || string(response.Data) != `{"online": 3}` {
+				t.Errorf("got response %+v to request %s", response, request.ID)
+			}
+
+			if request.Source != SOURCE_API || request.Target != "players" {
+				t.Errorf("server received %+v", request)
+			}
+
+			// The plugin checks the api's requests with the server's signing key
+			err = request.Verify(1)
+
+			if err != nil {
+				t.Errorf("request signature: %v", err)
+			}
+		})
+	}
+}
+
+func TestSendToServerAndWaitTimeout(t *testing.T) {
+
+	setupMessaging(t, MESSAGING_PUBSUB)
+
+	// Only answers meant for other requests arrive
+	received := fakeServer(t, 1, 1, `{"id": "someone-else", "success": true}`)
+
+	started := time.Now()
+	_, err := MinecraftRequest{Target: "players"}.SendToServerAndWait(1, 300*time.Millisecond)
+
+	if err != ErrResponseTimeout {
+		t.Errorf("SendToServerAndWait returned %v", err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("timing out took %s", elapsed)
+	}
+
+	<-received
+}
+
+func TestSendToServerAndWaitIgnoresOtherServers(t *testing.T) {
+
+	setupMessaging(t, MESSAGING_PUBSUB)
+
+	// The right id, but answered on another server's channel
+	received := fakeServer(t, 1, 2, "{{id}}")
+
+	_, err := MinecraftRequest{Target: "players"}.SendToServerAndWait(1, 300*time.Millisecond)
+
+	if err != ErrResponseTimeout {
+		t.Errorf("SendToServerAndWait returned %v", err)
+	}
+
+	<-received
+}
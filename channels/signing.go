@@ -0,0 +1,207 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+)
+
+// Api events aren't addressed to one server, they're signed with the api's own key which is
+// handed to consumers like the proxy but never to server containers
+const EVENTS_SERVER_ID = 0
+
+// Embedded into signed events, both the api's own and those servers publish
+type EventSignature struct {
+	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce"`
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"`
+}
+
+var ErrUnknownKey = errors.New("unknown or expired signing key")
+var ErrBadSignature = errors.New("invalid request signature")
+var ErrExpiredRequest = errors.New("request timestamp outside of the replay window")
+var ErrReplayedRequest = errors.New("request nonce was already used")
+
+func replayWindow() time.Duration {
+	if config.LoadedConfiguration.ReplayWindow <= 0 {
+		return time.Minute
+	}
+
+	return time.Duration(config.LoadedConfiguration.ReplayWindow) * time.Second
+}
+
+// SigningPayload is what gets signed: every field but the signature, one per line,
+// arguments separated by the unit separator so they can't be shifted between each other.
+// Both directions share the server's key, the source keeps a request the api sent from
+// being reflected back at the dispatcher.
+func (m MinecraftRequest) SigningPayload() string {
+	return strings.Join([]string{
+		m.Source,
+		m.ID,
+		m.UUID,
+		m.Target,
+		strings.Join(m.Arguments, "\x1f"),
+		strconv.FormatInt(m.Timestamp, 10),
+		m.Nonce,
+		m.KeyID,
+	}, "\n")
+}
+
+func ComputeSignature(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (m *MinecraftRequest) Sign(key db.SigningKey) {
+	m.KeyID = key.KeyID
+	m.Timestamp = time.Now().Unix()
+	m.Nonce = GenerateRequestId()
+	m.Signature = ComputeSignature(key.Secret, m.SigningPayload())
+}
+
+// SignEvent signs the channel and the event fields in order, laid out like SigningPayload
+func SignEvent(channel string, fields ...string) (EventSignature, error) {
+
+	key, err := ActiveSigningKey(EVENTS_SERVER_ID)
+
+	if err != nil {
+		return EventSignature{}, err
+	}
+
+	signature := EventSignature{
+		Timestamp: time.Now().Unix(),
+		Nonce:     GenerateRequestId(),
+		KeyID:     key.KeyID,
+	}
+
+	signature.Signature = ComputeSignature(key.Secret, signature.payload(channel, fields))
+
+	return signature, nil
+}
+
+func (s EventSignature) payload(channel string, fields []string) string {
+	return strings.Join([]string{
+		channel,
+		strings.Join(fields, "\x1f"),
+		strconv.FormatInt(s.Timestamp, 10),
+		s.Nonce,
+		s.KeyID,
+	}, "\n")
+}
+
+// Verify checks the signature against a key valid for the server, the timestamp against
+// the replay window and remembers the nonce in redis so the same request can't be replayed
+func (m MinecraftRequest) Verify(serverId uint) error {
+	return verifySigned(serverId, m.KeyID, m.SigningPayload(), m.Signature, m.Timestamp, m.Nonce)
+}
+
+// Verify checks an event published by a server, like a heartbeat, the same way as requests
+func (s EventSignature) Verify(serverId uint, channel string, fields ...string) error {
+	return verifySigned(serverId, s.KeyID, s.payload(channel, fields), s.Signature, s.Timestamp, s.Nonce)
+}
+
+func verifySigned(serverId uint, keyId string, payload string, signature string, timestamp int64, nonce string) error {
+
+	key, err := FindSigningKey(keyId, serverId)
+
+	if err != nil {
+		return err
+	}
+
+	expected := ComputeSignature(key.Secret, payload)
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrBadSignature
+	}
+
+	window := replayWindow()
+	age := time.Since(time.Unix(timestamp, 0))
+
+	if age > window || age < -window {
+		return ErrExpiredRequest
+	}
+
+	if nonce == "" {
+		return ErrReplayedRequest
+	}
+
+	fresh, err := RedisConnection.SetNX(context.Background(), "nonces:"+keyId+":"+nonce, 1, window*2).Result()
+
+	if err != nil {
+		return err
+	}
+
+	if !fresh {
+		return ErrReplayedRequest
+	}
+
+	return nil
+}
+
+// FindSigningKey only knows keys stored for the server. Neither the api Secret nor the
+// events key verify requests, so a server can't sign as another one with them.
+func FindSigningKey(keyId string, serverId uint) (db.SigningKey, error) {
+
+	if keyId == "" || serverId == EVENTS_SERVER_ID {
+		return db.SigningKey{}, ErrUnknownKey
+	}
+
+	key := db.SigningKey{}
+	db.OpenedConnection.Where("key_id = ? AND server_id = ?", keyId, serverId).First(&key)
+
+	if key.ID == 0 || !key.IsActive() {
+		return db.SigningKey{}, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// ActiveSigningKey is the newest key of the server, servers without one get a key issued
+func ActiveSigningKey(serverId uint) (db.SigningKey, error) {
+
+	keys := []db.SigningKey{}
+	db.OpenedConnection.Where("server_id = ?", serverId).Order("created_at desc").Find(&keys)
+
+	for _, key := range keys {
+		if key.IsActive() {
+			return key, nil
+		}
+	}
+
+	return RotateSigningKey(serverId, 0)
+}
+
+// RotateSigningKey issues a new key for the server, the previous ones keep working for grace
+func RotateSigningKey(serverId uint, grace time.Duration) (db.SigningKey, error) {
+
+	expiresAt := time.Now().Add(grace)
+
+	err := db.OpenedConnection.Model(&db.SigningKey{}).
+		Where("server_id = ? AND (expires_at IS NULL OR expires_at > ?)", serverId, expiresAt).
+		Update("expires_at", expiresAt).Error
+
+	if err != nil {
+		return db.SigningKey{}, err
+	}
+
+	key := db.SigningKey{
+		KeyID:    "srv" + strconv.Itoa(int(serverId)) + "-" + GenerateRequestId()[:8],
+		ServerID: serverId,
+		Secret:   GenerateRequestId() + GenerateRequestId(),
+	}
+
+	err = db.OpenedConnection.Create(&key).Error
+
+	return key, err
+}
@@ -0,0 +1,60 @@
+package channels
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeRequest(t *testing.T) {
+
+	setupMessaging(t, "pubsub")
+
+	key, err := RotateSigningKey(1, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := func(source string) MinecraftRequest {
+		m := MinecraftRequest{ID: GenerateRequestId(), Target: "players", Arguments: []string{"list"}, Source: source}
+		m.Sign(key)
+		return m
+	}
+
+	// An api request captured from servers:1:request and published again without its source
+	reflected := signed(SOURCE_API)
+	reflected.Source = ""
+
+	tampered := signed("")
+	tampered.Arguments = []string{"kick", "Notch"}
+
+	replayed := signed("")
+
+	tests := []struct {
+		name     string
+		serverId uint
+		request  MinecraftRequest
+		expected bool
+	}{
+		{"server request", 1, signed(""), true},
+		{"api request", 1, signed(SOURCE_API), false},
+		{"reflected api request", 1, reflected, false},
+		{"tampered arguments", 1, tampered, false},
+		{"first delivery", 1, replayed, true},
+		{"replayed", 1, replayed, false},
+		{"signed for another server", 2, signed(""), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			payload, _ := json.Marshal(test.request)
+
+			_, ok := decodeRequest(test.serverId, "servers:request", string(payload))
+
+			if ok != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/logger"
+	"github.com/go-redis/redis/v9"
+)
+
+// In streams mode every server reads servers:<id>:to-server through the consumer group
+// server-<id> (XREADGROUP, reclaiming stale entries with XAUTOCLAIM) and acknowledges
+// what it handled. Servers send their requests to servers:<id>:to-api, which the api
+// replicas read through the group api the same way. Stream names deliberately differ
+// from the pub/sub channels (servers:<id>:request). Entries delivered MaxAttempts times
+// are moved to servers:<id>:dead. Events (servers:added, servers:removed) go to streams
+// named like their channels, their consumers create their own groups.
+const (
+	MESSAGING_PUBSUB  = "pubsub"
+	MESSAGING_STREAMS = "streams"
+
+	DEFAULT_MAX_ATTEMPTS = 5
+
+	API_GROUP = "api"
+	// Entries a consumer read but didn't acknowledge for this long are claimed by another
+	STREAM_CLAIM_IDLE = time.Minute
+)
+
+type PendingMessage struct {
+	ID         string        `json:"id"`
+	Consumer   string        `json:"consumer"`
+	Idle       time.Duration `json:"idle"`
+	RetryCount int64         `json:"retry_count"`
+}
+
+type PendingReport struct {
+	Stream     string           `json:"stream"`
+	Group      string           `json:"group"`
+	Pending    int64            `json:"pending"`
+	Consumers  map[string]int64 `json:"consumers"`
+	Messages   []PendingMessage `json:"messages"`
+	DeadLetter int64            `json:"dead_letter"`
+}
+
+func UseStreams() bool {
+	return config.LoadedConfiguration.Messaging.Mode == MESSAGING_STREAMS
+}
+
+func maxAttempts() int64 {
+	if config.LoadedConfiguration.Messaging.MaxAttempts <= 0 {
+		return DEFAULT_MAX_ATTEMPTS
+	}
+
+	return int64(config.LoadedConfiguration.Messaging.MaxAttempts)
+}
+
+// RequestStream carries requests from the api to the server
+func RequestStream(serverId uint) string {
+	return fmt.Sprintf("servers:%d:to-server", serverId)
+}
+
+// ApiStream carries requests from the server to the api
+func ApiStream(serverId uint) string {
+	return fmt.Sprintf("servers:%d:to-api", serverId)
+}
+
+func DeadLetterStream(serverId uint) string {
+	return fmt.Sprintf("servers:%d:dead", serverId)
+}
+
+func ServerGroup(serverId uint) string {
+	return fmt.Sprintf("server-%d", serverId)
+}
+
+// The group starts at the beginning of the stream, so entries added before the
+// server first connects are still delivered to it
+func ensureGroup(ctx context.Context, stream string, group string) error {
+
+	err := RedisConnection.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	return nil
+}
+
+func addToStream(ctx context.Context, stream string, payload []byte) error {
+	return RedisConnection.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: config.LoadedConfiguration.Messaging.StreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"payload": payload},
+	}).Err()
+}
+
+func publishRequest(ctx context.Context, serverId uint, payload []byte) error {
+
+	if !UseStreams() {
+		return RedisConnection.Publish(ctx, fmt.Sprintf("servers:%d:request", serverId), payload).Err()
+	}
+
+	err := ensureGroup(ctx, RequestStream(serverId), ServerGroup(serverId))
+
+	if err != nil {
+		return err
+	}
+
+	return addToStream(ctx, RequestStream(serverId), payload)
+}
+
+// PublishEvent sends api events like servers:added through pub/sub or a stream of the same name
+func PublishEvent(channel string, payload []byte) error {
+
+	if UseStreams() {
+		return addToStream(context.Background(), channel, payload)
+	}
+
+	return RedisConnection.Publish(context.Background(), channel, payload).Err()
+}
+
+func GetPendingReport(ctx context.Context, serverId uint) (PendingReport, error) {
+
+	report := PendingReport{
+		Stream:    RequestStream(serverId),
+		Group:     ServerGroup(serverId),
+		Consumers: map[string]int64{},
+		Messages:  []PendingMessage{},
+	}
+
+	err := ensureGroup(ctx, report.Stream, report.Group)
+
+	if err != nil {
+		return report, err
+	}
+
+	summary, err := RedisConnection.XPending(ctx, report.Stream, report.Group).Result()
+
+	if err != nil {
+		return report, err
+	}
+
+	report.Pending = summary.Count
+
+	if summary.Consumers != nil {
+		report.Consumers = summary.Consumers
+	}
+
+	pending, err := RedisConnection.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: report.Stream,
+		Group:  report.Group,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+
+	if err != nil {
+		return report, err
+	}
+
+	for _, p := range pending {
+		report.Messages = append(report.Messages, PendingMessage{
+			ID:         p.ID,
+			Consumer:   p.Consumer,
+			Idle:       p.Idle,
+			RetryCount: p.RetryCount,
+		})
+	}
+
+	report.DeadLetter, err = RedisConnection.XLen(ctx, DeadLetterStream(serverId)).Result()
+
+	return report, err
+}
+
+// deadLetter moves entries that were delivered too often out of the pending lists of the
+// server's streams in both directions
+func deadLetter(ctx context.Context, serverId uint) error {
+
+	err := deadLetterStream(ctx, serverId, RequestStream(serverId), ServerGroup(serverId))
+
+	if err != nil {
+		return err
+	}
+
+	return deadLetterStream(ctx, serverId, ApiStream(serverId), API_GROUP)
+}
+
+func deadLetterStream(ctx context.Context, serverId uint, stream string, group string) error {
+
+	pending, err := RedisConnection.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  group,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+
+	if err != nil {
+		// The group doesn't exist until the first request was sent
+		if strings.HasPrefix(err.Error(), "NOGROUP") {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, p := range pending {
+
+		if p.RetryCount < maxAttempts() {
+			continue
+		}
+
+		messages, err := RedisConnection.XRange(ctx, stream, p.ID, p.ID).Result()
+
+		if err != nil {
+			return err
+		}
+
+		for _, message := range messages {
+			err = RedisConnection.XAdd(ctx, &redis.XAddArgs{
+				Stream: DeadLetterStream(serverId),
+				Values: map[string]interface{}{
+					"payload":     message.Values["payload"],
+					"stream":      stream,
+					"original_id": p.ID,
+					"consumer":    p.Consumer,
+					"attempts":    p.RetryCount,
+				},
+			}).Err()
+
+			if err != nil {
+				return err
+			}
+		}
+
+		err = RedisConnection.XAck(ctx, stream, group, p.ID).Err()
+
+		if err != nil {
+			return err
+		}
+
+		logger.Warning("Moved request " + p.ID + " of " + stream + " to the dead letter stream")
+	}
+
+	return nil
+}
+
+// StartStreamMonitor dead-letters exhausted requests of every server until ctx is done
+func StartStreamMonitor(ctx context.Context, interval time.Duration) {
+
+	if !UseStreams() {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		serverIds := []uint{}
+		db.OpenedConnection.Model(&db.Server{}).Pluck("id", &serverIds)
+
+		for _, serverId := range serverIds {
+			err := deadLetter(ctx, serverId)
+
+			if err != nil {
+				logger.Error("Error checking pending requests of server " + fmt.Sprint(serverId) + ": " + err.Error())
+			}
+		}
+	}
+}
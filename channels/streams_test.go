@@ -0,0 +1,157 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+	"github.com/go-redis/redis/v9"
+)
+
+func TestPublishRequest(t *testing.T) {
+
+	t.Run(MESSAGING_PUBSUB, func(t *testing.T) {
+
+		setupMessaging(t, MESSAGING_PUBSUB)
+		ctx := context.Background()
+
+		pubsub := RedisConnection.Subscribe(ctx, "servers:1:request")
+		defer pubsub.Close()
+
+		_, err := pubsub.Receive(ctx)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = publishRequest(ctx, 1, []byte(`{"id": "a"}`))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		timeout, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		msg, err := pubsub.ReceiveMessage(timeout)
+
+		if err != nil || msg.Payload != `{"id": "a"}` {
+			t.Fatalf("got %+v (%v)", msg, err)
+		}
+
+		if n, _ := RedisConnection.Exists(ctx, RequestStream(1)).Result(); n != 0 {
+			t.Error("pub/sub mode created the request stream")
+		}
+	})
+
+	t.Run(MESSAGING_STREAMS, func(t *testing.T) {
+
+		setupMessaging(t, MESSAGING_STREAMS)
+		ctx := context.Background()
+
+		for _, id := range []string{"a", "b"} {
+			err := publishRequest(ctx, 1, []byte(`{"id": "`+id+`"}`))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// The server's group starts at the beginning, so it gets entries added before it connected
+		result, err := RedisConnection.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    ServerGroup(1),
+			Consumer: "plugin",
+			Streams:  []string{RequestStream(1), ">"},
+			Count:    10,
+			Block:    -1,
+		}).Result()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		messages := result[0].Messages
+
+		if len(messages) != 2 || messages[0].Values["payload"] != `{"id": "a"}` || messages[1].Values["payload"] != `{"id": "b"}` {
+			t.Errorf("server read %+v", messages)
+		}
+	})
+}
+
+func TestDeadLetter(t *testing.T) {
+
+	setupMessaging(t, MESSAGING_STREAMS)
+
+	previousAttempts := config.LoadedConfiguration.Messaging.MaxAttempts
+	config.LoadedConfiguration.Messaging.MaxAttempts = 2
+	t.Cleanup(func() { config.LoadedConfiguration.Messaging.MaxAttempts = previousAttempts })
+
+	ctx := context.Background()
+
+	for _, payload := range []string{"exhausted", "retried once"} {
+		err := publishRequest(ctx, 1, []byte(payload))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := RedisConnection.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    ServerGroup(1),
+		Consumer: "crashed",
+		Streams:  []string{RequestStream(1), ">"},
+		Block:    -1,
+	}).Result()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exhausted := result[0].Messages[0].ID
+
+	// A second consumer claims the first entry, its second delivery
+	err = RedisConnection.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   RequestStream(1),
+		Group:    ServerGroup(1),
+		Consumer: "plugin",
+		Messages: []string{exhausted},
+	}).Err()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The api stream has no group yet, that's not an error
+	err = deadLetter(ctx, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dead, err := RedisConnection.XRange(ctx, DeadLetterStream(1), "-", "+").Result()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dead) != 1 {
+		t.Fatalf("%d dead letters, want 1", len(dead))
+	}
+
+	values := dead[0].Values
+
+	if values["payload"] != "exhausted" || values["original_id"] != exhausted || values["stream"] != RequestStream(1) || values["consumer"] != "plugin" || values["attempts"] != "2" {
+		t.Errorf("dead letter %v", values)
+	}
+
+	report, err := GetPendingReport(ctx, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Pending != 1 || report.DeadLetter != 1 || len(report.Messages) != 1 || report.Messages[0].Consumer != "crashed" {
+		t.Errorf("pending report %+v", report)
+	}
+}
@@ -12,10 +12,59 @@ type ApiConfiguration struct {
 	Port    int    `yaml:"port"`
 	Dsn     string `yaml:"dsn"`
 	Secret  string `yaml:"secret"`
-	Redis   struct {
+	// Seconds a signed request stays valid, nonces are remembered for twice as long
+	ReplayWindow int `yaml:"replay_window"`
+	// Workers handling server requests, 0 uses the default
+	DispatcherWorkers int `yaml:"dispatcher_workers"`
+	Redis             struct {
 		Address  string `yaml:"address"`
 		Password string `yaml:"password"`
 	} `yaml:"redis"`
+	Ports struct {
+		Start    int   `yaml:"start"`
+		End      int   `yaml:"end"`
+		Reserved []int `yaml:"reserved"`
+	} `yaml:"ports"`
+	// Mode is "pubsub" (default) or "streams" for durable delivery through redis streams
+	Messaging struct {
+		Mode         string `yaml:"mode"`
+		MaxAttempts  int    `yaml:"max_attempts"`
+		StreamMaxLen int64  `yaml:"stream_max_len"`
+	} `yaml:"messaging"`
+	// Seconds without a heartbeat before a server is unresponsive, hours of history kept
+	Heartbeat struct {
+		Timeout   int `yaml:"timeout"`
+		Retention int `yaml:"retention"`
+	} `yaml:"heartbeat"`
+	// Offline mode logins: session length in hours, failed attempts allowed per
+	// username and ip before they are locked out for lockout_time seconds
+	PlayerAuth struct {
+		SessionTTL  int `yaml:"session_ttl"`
+		MaxAttempts int `yaml:"max_attempts"`
+		LockoutTime int `yaml:"lockout_time"`
+	} `yaml:"player_auth"`
+	// Storage is "local" (Directory) or "s3". Keep is the number of backups kept per
+	// server and MaxAge their age in days, 0 disables either rule.
+	Backups struct {
+		Storage   string `yaml:"storage"`
+		Directory string `yaml:"directory"`
+		Keep      int    `yaml:"keep"`
+		MaxAge    int    `yaml:"max_age"`
+		S3        struct {
+			Endpoint  string `yaml:"endpoint"`
+			Region    string `yaml:"region"`
+			Bucket    string `yaml:"bucket"`
+			AccessKey string `yaml:"access_key"`
+			SecretKey string `yaml:"secret_key"`
+			// Path style addressing (endpoint/bucket/key) for minio and other stand-ins
+			PathStyle bool `yaml:"path_style"`
+		} `yaml:"s3"`
+	} `yaml:"backups"`
+	// Plugin catalogs, the fixture catalog is only registered when its directory is set
+	Plugins struct {
+		ModrinthUrl string `yaml:"modrinth_url"`
+		FixtureDir  string `yaml:"fixture_dir"`
+	} `yaml:"plugins"`
 }
 
 var LoadedConfiguration ApiConfiguration
@@ -52,10 +101,12 @@ func GetConfiguration(filepath string) (*ApiConfiguration, error) {
 
 func GenerateDefaultConfiguration(filepath string) error {
 	cfg := ApiConfiguration{
-		Version: 1,
-		Port:    8080,
-		Dsn:     "host=localhost user=lisek password=lisek dbname=lisek port=5432 sslmode=disable TimeZone=Europe/Kiev",
-		Secret:  "secret",
+		Version:           1,
+		Port:              8080,
+		Dsn:               "host=localhost user=lisek password=lisek dbname=lisek port=5432 sslmode=disable TimeZone=Europe/Kiev",
+		Secret:            "secret",
+		ReplayWindow:      60,
+		DispatcherWorkers: 4,
 		Redis: struct {
 			Address  string `yaml:"address"`
 			Password string `yaml:"password"`
@@ -63,8 +114,50 @@ func GenerateDefaultConfiguration(filepath string) error {
 			Address:  "localhost:6379",
 			Password: "",
 		},
+		Ports: struct {
+			Start    int   `yaml:"start"`
+			End      int   `yaml:"end"`
+			Reserved []int `yaml:"reserved"`
+		}{
+			Start: 25565,
+			End:   25665,
+			// RCON and the velocity proxy
+			Reserved: []int{25575, 25577},
+		},
+		Messaging: struct {
+			Mode         string `yaml:"mode"`
+			MaxAttempts  int    `yaml:"max_attempts"`
+			StreamMaxLen int64  `yaml:"stream_max_len"`
+		}{
+			Mode:         "pubsub",
+			MaxAttempts:  5,
+			StreamMaxLen: 10000,
+		},
+		Heartbeat: struct {
+			Timeout   int `yaml:"timeout"`
+			Retention int `yaml:"retention"`
+		}{
+			Timeout:   60,
+			Retention: 24,
+		},
+		PlayerAuth: struct {
+			SessionTTL  int `yaml:"session_ttl"`
+			MaxAttempts int `yaml:"max_attempts"`
+			LockoutTime int `yaml:"lockout_time"`
+		}{
+			SessionTTL:  12,
+			MaxAttempts: 5,
+			LockoutTime: 900,
+		},
 	}
 
+	cfg.Backups.Storage = "local"
+	cfg.Backups.Directory = "/data/backups"
+	cfg.Backups.Keep = 10
+	cfg.Backups.MaxAge = 30
+	cfg.Backups.S3.Region = "us-east-1"
+	cfg.Plugins.ModrinthUrl = "https://api.modrinth.com/v2"
+
 	cfgBytes, err := yaml.Marshal(cfg)
 
 	if err != nil {
@@ -0,0 +1,17 @@
+package db
+
+import "time"
+
+// Only the sha256 of the key is stored, the plain key is shown once on creation
+type ApiKey struct {
+	ID         uint       `gorm:"primary_key" json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `gorm:"uniqueIndex" json:"-"`
+	Scopes     []string   `gorm:"serializer:json" json:"scopes"`
+	ServerID   uint       `gorm:"index" json:"server_id"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Revoked    bool       `json:"revoked"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,35 @@
+package db
+
+import "time"
+
+const (
+	BACKUP_CREATING = "creating"
+	BACKUP_READY    = "ready"
+	BACKUP_FAILED   = "failed"
+)
+
+// Object is the archive's name in the backup storage
+type Backup struct {
+	ID         uint       `gorm:"primary_key" json:"id"`
+	ServerID   uint       `gorm:"index" json:"server_id"`
+	Object     string     `json:"object"`
+	Storage    string     `json:"storage"`
+	Size       int64      `json:"size"`
+	Status     string     `gorm:"index" json:"status"`
+	Error      string     `json:"error"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// Like jobs, backups still being created at startup were interrupted by a restart
+func FailInterruptedBackups() error {
+	now := time.Now()
+
+	return OpenedConnection.Model(&Backup{}).
+		Where("status = ?", BACKUP_CREATING).
+		Updates(map[string]interface{}{
+			"status":      BACKUP_FAILED,
+			"error":       "interrupted by api restart",
+			"finished_at": &now,
+		}).Error
+}
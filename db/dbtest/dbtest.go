@@ -0,0 +1,46 @@
+// Package dbtest replaces the database connection with an in-memory sqlite one for tests
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Open points db.OpenedConnection at a fresh database with the given tables until the test ends
+func Open(t *testing.T, models ...interface{}) *gorm.DB {
+
+	database, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every connection to :memory: is a database of its own
+	sqlDb, err := database.DB()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlDb.SetMaxOpenConns(1)
+
+	err = database.AutoMigrate(models...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := db.OpenedConnection
+	db.OpenedConnection = database
+
+	t.Cleanup(func() {
+		db.OpenedConnection = previous
+		sqlDb.Close()
+	})
+
+	return database
+}
@@ -0,0 +1,18 @@
+package db
+
+import "time"
+
+// FileChange is the audit entry of a change made through the file manager
+type FileChange struct {
+	ID       uint   `gorm:"primary_key" json:"id"`
+	ServerID uint   `gorm:"index" json:"server_id"`
+	Action   string `json:"action"`
+	Path     string `json:"path"`
+	// New path of renames
+	Target    string    `json:"target,omitempty"`
+	Size      int64     `json:"size"`
+	ApiKeyID  uint      `json:"api_key_id"`
+	ApiKey    string    `json:"api_key"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+}
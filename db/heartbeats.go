@@ -0,0 +1,20 @@
+package db
+
+import "time"
+
+const (
+	LIVENESS_UNKNOWN      = ""
+	LIVENESS_ALIVE        = "alive"
+	LIVENESS_UNRESPONSIVE = "unresponsive"
+)
+
+type Heartbeat struct {
+	ID         uint      `gorm:"primary_key" json:"id"`
+	ServerID   uint      `gorm:"index" json:"server_id"`
+	Players    int       `json:"players"`
+	MaxPlayers int       `json:"max_players"`
+	TPS        float64   `json:"tps"`
+	MemoryUsed int64     `json:"memory_used"`
+	MemoryMax  int64     `json:"memory_max"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,73 @@
+package db
+
+import "time"
+
+const (
+	JOB_PENDING  = "pending"
+	JOB_PULLING  = "pulling"
+	JOB_CREATING = "creating"
+	JOB_STARTING = "starting"
+	JOB_READY    = "ready"
+	JOB_FAILED   = "failed"
+)
+
+type Job struct {
+	ID         uint       `gorm:"primary_key" json:"id"`
+	Kind       string     `json:"kind"`
+	ServerID   uint       `gorm:"index" json:"server_id"`
+	Phase      string     `gorm:"index" json:"phase"`
+	Error      string     `json:"error"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func CreateJob(kind string, serverId uint) (*Job, error) {
+	job := Job{
+		Kind:     kind,
+		ServerID: serverId,
+		Phase:    JOB_PENDING,
+	}
+
+	err := OpenedConnection.Create(&job).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (j *Job) IsFinished() bool {
+	return j.Phase == JOB_READY || j.Phase == JOB_FAILED
+}
+
+func (j *Job) SetPhase(phase string) error {
+	j.Phase = phase
+
+	if j.IsFinished() {
+		now := time.Now()
+		j.FinishedAt = &now
+	}
+
+	return OpenedConnection.Save(j).Error
+}
+
+func (j *Job) Fail(err error) error {
+	j.Error = err.Error()
+
+	return j.SetPhase(JOB_FAILED)
+}
+
+// Jobs are run by goroutines, so anything unfinished at startup was interrupted by a restart
+func FailInterruptedJobs() error {
+	now := time.Now()
+
+	return OpenedConnection.Model(&Job{}).
+		Where("phase NOT IN ?", []string{JOB_READY, JOB_FAILED}).
+		Updates(map[string]interface{}{
+			"phase":       JOB_FAILED,
+			"error":       "interrupted by api restart",
+			"finished_at": &now,
+		}).Error
+}
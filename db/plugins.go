@@ -0,0 +1,21 @@
+package db
+
+import "time"
+
+// InstalledPlugin is a plugin or mod jar the api put into a server's data directory.
+// Catalog and ProjectID are empty for plugins installed from a plain url.
+type InstalledPlugin struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	ServerID  uint      `gorm:"index" json:"server_id"`
+	Catalog   string    `json:"catalog"`
+	ProjectID string    `json:"project_id"`
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	VersionID string    `json:"version_id"`
+	Path      string    `json:"path"`
+	URL       string    `json:"url"`
+	Sha256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
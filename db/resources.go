@@ -0,0 +1,31 @@
+package db
+
+// Zero values mean "not limited" (or, for memory, derived from MAX_MEMORY)
+type ResourceLimits struct {
+	CpuShares   int64   `json:"cpu_shares"`
+	Cpus        float64 `json:"cpus"`
+	MemoryMB    int64   `json:"memory_mb"`
+	PidsLimit   int64   `json:"pids_limit"`
+	StorageSize string  `json:"storage_size"`
+}
+
+// Merge returns l with every non-zero field of o applied on top
+func (l ResourceLimits) Merge(o ResourceLimits) ResourceLimits {
+	if o.CpuShares != 0 {
+		l.CpuShares = o.CpuShares
+	}
+	if o.Cpus != 0 {
+		l.Cpus = o.Cpus
+	}
+	if o.MemoryMB != 0 {
+		l.MemoryMB = o.MemoryMB
+	}
+	if o.PidsLimit != 0 {
+		l.PidsLimit = o.PidsLimit
+	}
+	if o.StorageSize != "" {
+		l.StorageSize = o.StorageSize
+	}
+
+	return l
+}
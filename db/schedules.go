@@ -0,0 +1,60 @@
+package db
+
+import "time"
+
+const (
+	TASK_RESTART   = "restart"
+	TASK_BACKUP    = "backup"
+	TASK_COMMAND   = "command"
+	TASK_BROADCAST = "broadcast"
+
+	RUN_SUCCEEDED = "succeeded"
+	RUN_FAILED    = "failed"
+)
+
+// ScheduledTask runs on a cron expression (minute hour day month weekday, in the api's
+// timezone). Payload is the console command or broadcast message. Warnings are seconds
+// before a restart at which players are told about it, the restart itself stays on time.
+type ScheduledTask struct {
+	ID        uint       `gorm:"primary_key" json:"id"`
+	ServerID  uint       `gorm:"index" json:"server_id"`
+	Name      string     `json:"name"`
+	Cron      string     `json:"cron"`
+	Type      string     `json:"type"`
+	Payload   string     `json:"payload"`
+	Warnings  []int      `gorm:"serializer:json" json:"warnings"`
+	Enabled   bool       `json:"enabled"`
+	NextRunAt time.Time  `gorm:"index" json:"next_run_at"`
+	LastRunAt *time.Time `json:"last_run_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type TaskRun struct {
+	ID         uint       `gorm:"primary_key" json:"id"`
+	TaskID     uint       `gorm:"index" json:"task_id"`
+	ServerID   uint       `gorm:"index" json:"server_id"`
+	Status     string     `json:"status"`
+	Output     string     `json:"output"`
+	Error      string     `json:"error"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// LeadTime is how long before NextRunAt the task has to start, for the restart warnings
+func (t ScheduledTask) LeadTime() time.Duration {
+
+	if t.Type != TASK_RESTART {
+		return 0
+	}
+
+	longest := 0
+
+	for _, warning := range t.Warnings {
+		if warning > longest {
+			longest = warning
+		}
+	}
+
+	return time.Duration(longest) * time.Second
+}
@@ -0,0 +1,17 @@
+package db
+
+import "time"
+
+// Login session of an offline mode player, lets them rejoin from the same ip without
+// typing /login again. Only the sha256 of the token is stored.
+type PlayerSession struct {
+	ID        uint   `gorm:"primary_key" json:"id"`
+	UserID    uint   `gorm:"index" json:"user_id"`
+	TokenHash string `gorm:"uniqueIndex" json:"-"`
+	IP        string `json:"ip"`
+	// Server the player is currently on, set by the proxy on login and when it connects the player
+	ServerID  uint      `gorm:"index" json:"server_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Revoked   bool      `json:"revoked"`
+	CreatedAt time.Time `json:"created_at"`
+}
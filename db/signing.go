@@ -0,0 +1,18 @@
+package db
+
+import "time"
+
+// Secret used to sign MinecraftRequests for one server, ServerID 0 is the key of api events.
+// Rotation creates a new key and lets the old ones expire, so both verify in between.
+type SigningKey struct {
+	ID        uint       `gorm:"primary_key" json:"-"`
+	KeyID     string     `gorm:"uniqueIndex" json:"key_id"`
+	ServerID  uint       `gorm:"index" json:"server_id"`
+	Secret    string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (k SigningKey) IsActive() bool {
+	return k.ExpiresAt == nil || k.ExpiresAt.After(time.Now())
+}
@@ -5,36 +5,47 @@ import (
 	"time"
 )
 
+type Server struct {
+	ID             uint              `gorm:"primary_key" json:"id"`
+	Name           string            `json:"name"`
+	IP             string            `json:"ip"`
+	Port           int               `json:"port"`
+	Region         string            `json:"region"`
+	CreatedAt      time.Time         `json:"created_at"`
+	LastPing       time.Time         `json:"last_ping"`
+	ContainerName  string            `json:"container_name"`
+	State          string            `json:"state"`
+	StateUpdatedAt time.Time         `json:"state_updated_at"`
+	TemplateID     uint              `json:"template_id"`
+	Overrides      TemplateOverrides `gorm:"serializer:json" json:"overrides"`
+	Limits         ResourceLimits    `gorm:"embedded;embeddedPrefix:limit_" json:"limits"`
+	RconPassword   string            `json:"-"`
+	Liveness       string            `json:"liveness"`
+}
+
 type User struct {
-	ID        uint `gorm:"primary_key"`
-	Username  string
-	UUID      string
-	DiscordID uint64
-	CreatedAt time.Time
+	ID       uint   `gorm:"primary_key" json:"id"`
+	Username string `gorm:"index" json:"username"`
+	UUID     string `gorm:"uniqueIndex:idx_users_uuid_unique" json:"uuid"`
+	// Snowflakes don't fit in a javascript number. 0 means unlinked, so only linked
+	// accounts have to be unique.
+	DiscordID     uint64     `gorm:"uniqueIndex:idx_users_discord_id_linked,where:discord_id <> 0" json:"discord_id,string"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Gender        string     `json:"gender"`
+	Registred     bool       `json:"registred"`
+	LastIpAddress string     `json:"last_ip_address"`
+	LastLoginAt   *time.Time `json:"last_login_at"`
+	Logins        int        `json:"logins"`
+	// Argon2id hash for offline mode /register and /login
+	PasswordHash string `json:"-"`
 }
 
 func (u *User) SafeUsername() string {
 	return strings.ToLower(strings.Replace(u.Username, " ", "_", -1))
 }
 
-type Server struct {
-	ID            uint      `gorm:"primary_key" json:"id"`
-	Name          string    `json:"name"`
-	IP            string    `json:"ip"`
-	Port          int       `json:"port"`
-	Region        string    `json:"region"`
-	CreatedAt     time.Time `json:"created_at"`
-	LastPing      time.Time `json:"last_ping"`
-	ContainerName string    `json:"container_name"`
-}
-
-type User struct {
-	ID            uint `gorm:"primary_key"`
-	Username      string
-	UUID          string
-	DiscordID     uint64
-	CreatedAt     time.Time
-	Gender        string
-	Registred     bool
-	LastIpAddress string
+type PortLease struct {
+	Port      int       `gorm:"primary_key;autoIncrement:false" json:"port"`
+	ServerID  uint      `gorm:"index" json:"server_id"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"sort"
+	"time"
+)
+
+type TemplateMount struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+type ServerTemplate struct {
+	ID         uint              `gorm:"primary_key" json:"id"`
+	Name       string            `gorm:"uniqueIndex" json:"name"`
+	Image      string            `json:"image"`
+	Version    string            `json:"version"`
+	ServerType string            `json:"server_type"`
+	Memory     string            `json:"memory"`
+	JvmFlags   string            `json:"jvm_flags"`
+	Env        map[string]string `gorm:"serializer:json" json:"env"`
+	Mounts     []TemplateMount   `gorm:"serializer:json" json:"mounts"`
+	Limits     ResourceLimits    `gorm:"embedded;embeddedPrefix:limit_" json:"limits"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// Per-server values taking precedence over the template, empty fields are ignored
+type TemplateOverrides struct {
+	Image      string            `json:"image,omitempty"`
+	Version    string            `json:"version,omitempty"`
+	ServerType string            `json:"server_type,omitempty"`
+	Memory     string            `json:"memory,omitempty"`
+	JvmFlags   string            `json:"jvm_flags,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+}
+
+// Used for servers without a template, matches what every server got before templates existed
+func DefaultServerTemplate() ServerTemplate {
+	return ServerTemplate{
+		Name:       "default",
+		Image:      "docker.io/itzg/minecraft-server",
+		Version:    "1.12.2",
+		ServerType: "PAPER",
+		Memory:     "2048M",
+		Env: map[string]string{
+			"TZ":              "Europe/Kiev",
+			"USE_AIKAR_FLAGS": "true",
+			"ONLINE_MODE":     "false",
+		},
+	}
+}
+
+func (t ServerTemplate) WithOverrides(o TemplateOverrides) ServerTemplate {
+	if o.Image != "" {
+		t.Image = o.Image
+	}
+	if o.Version != "" {
+		t.Version = o.Version
+	}
+	if o.ServerType != "" {
+		t.ServerType = o.ServerType
+	}
+	if o.Memory != "" {
+		t.Memory = o.Memory
+	}
+	if o.JvmFlags != "" {
+		t.JvmFlags = o.JvmFlags
+	}
+
+	env := map[string]string{}
+
+	for key, value := range t.Env {
+		env[key] = value
+	}
+
+	for key, value := range o.Env {
+		env[key] = value
+	}
+
+	t.Env = env
+
+	return t
+}
+
+// Environment understood by the itzg/minecraft-server image
+func (t ServerTemplate) EnvVariables() []string {
+	envs := []string{"EULA=TRUE"}
+
+	if t.Version != "" {
+		envs = append(envs, "VERSION="+t.Version)
+	}
+	if t.ServerType != "" {
+		envs = append(envs, "TYPE="+t.ServerType)
+	}
+	if t.Memory != "" {
+		envs = append(envs, "MAX_MEMORY="+t.Memory)
+	}
+	if t.JvmFlags != "" {
+		envs = append(envs, "JVM_OPTS="+t.JvmFlags)
+	}
+
+	keys := []string{}
+
+	for key := range t.Env {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		envs = append(envs, key+"="+t.Env[key])
+	}
+
+	return envs
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgconn"
+)
+
+var ErrInvalidUUID = errors.New("invalid uuid")
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// NormalizeUUID accepts mojang's undashed form as well and returns the dashed lowercase one
+func NormalizeUUID(uuid string) (string, error) {
+
+	plain := strings.ToLower(strings.ReplaceAll(uuid, "-", ""))
+
+	if !uuidPattern.MatchString(plain) {
+		return "", ErrInvalidUUID
+	}
+
+	return plain[0:8] + "-" + plain[8:12] + "-" + plain[12:16] + "-" + plain[16:20] + "-" + plain[20:], nil
+}
+
+func FindUserByUUID(uuid string) (User, error) {
+
+	user := User{}
+
+	uuid, err := NormalizeUUID(uuid)
+
+	if err != nil {
+		return user, err
+	}
+
+	err = OpenedConnection.Table("users").Where("uuid = ?", uuid).First(&user).Error
+
+	return user, err
+}
+
+// MigrateUsers replaces the plain discord_id and uuid indexes of older databases. The unique
+// ones can only be created when no two users share a linked account or a uuid.
+func MigrateUsers() error {
+
+	migrator := OpenedConnection.Table("users").Migrator()
+
+	for _, index := range []string{"idx_users_discord_id", "idx_users_uuid"} {
+		if !migrator.HasIndex(&User{}, index) {
+			continue
+		}
+
+		err := migrator.DropIndex(&User{}, index)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return OpenedConnection.Table("users").AutoMigrate(&User{})
+}
+
+// IsUniqueViolation tells a unique index conflict apart from other database errors
+func IsUniqueViolation(err error) bool {
+
+	var pgErr *pgconn.PgError
+
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
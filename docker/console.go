@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"context"
+	"io"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+)
+
+func ServerLogs(ctx context.Context, server db.Server, options LogOptions) (io.ReadCloser, error) {
+
+	container, err := ContainerRuntime.InspectContainer(ctx, server.ContainerName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ContainerRuntime.Logs(ctx, container.ID, options)
+}
+
+// ExecConsoleCommand runs a console command over rcon, servers created before
+// rcon credentials existed fall back to the rcon-cli bundled with the itzg image
+func ExecConsoleCommand(ctx context.Context, server db.Server, command string) (string, error) {
+
+	if server.RconPassword != "" {
+		return RconCommand(server, command)
+	}
+
+	container, err := ContainerRuntime.InspectContainer(ctx, server.ContainerName)
+
+	if err != nil {
+		return "", err
+	}
+
+	return ContainerRuntime.Exec(ctx, container.ID, []string{"rcon-cli", command})
+}
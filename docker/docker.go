@@ -3,32 +3,32 @@ package docker
 import (
 	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"os"
 	"path"
 	"strconv"
 	"time"
 
+	"github.com/Lisek-World-Reborn/lisek-api/auth"
 	"github.com/Lisek-World-Reborn/lisek-api/channels"
-	"github.com/Lisek-World-Reborn/lisek-api/config"
 	"github.com/Lisek-World-Reborn/lisek-api/db"
 	"github.com/Lisek-World-Reborn/lisek-api/logger"
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/api/types/network"
+	"github.com/Lisek-World-Reborn/lisek-api/rcon"
 	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/nat"
-	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
-var DockerClient *client.Client
-
 const SERVER_IMAGE = "docker.io/itzg/minecraft-server"
 
 var DATA_DIR = os.Getenv("DATA_DIR")
 var PRELOADED_DIR = os.Getenv("PRELOADED_DIR")
 
+// DATA_DIR is the host path used for bind mounts, the api itself sees the same directory at
+// LOCAL_DATA_DIR. Tests point it at a temporary directory.
+var LOCAL_DATA_DIR = "/data"
+
+// Every directory in it with an info.json is a preloaded server, see PreloadServers
+var PRELOADED_SERVERS_DIR = "preloaded"
+
 type PreloadedServer struct {
 	Mounts  []interface{}     `json:"mounts,omitempty"`
 	Env     map[string]string `json:"env,omitempty"`
@@ -48,84 +48,169 @@ func Init() {
 		return
 	}
 
-	DockerClient = cli
+	ContainerRuntime = NewDockerRuntime(cli)
 
 	logger.Info("Docker initialized")
 }
 
-func CreateServer(server db.Server) {
+func CreateServer(server db.Server, job *db.Job) {
 
-	logger.Info("Creating container for server " + server.Name + "(" + server.ContainerName + ")")
+	err := provisionServer(server, job)
 
-	ctx, _ := context.WithTimeout(context.TODO(), time.Minute*5)
+	if err != nil {
+		logger.Error("Error provisioning server " + server.Name + ": " + err.Error())
+		job.Fail(err)
+		return
+	}
 
-	logger.Info("Pulling container image")
+	job.SetPhase(db.JOB_READY)
 
-	_, err := DockerClient.ImagePull(ctx, SERVER_IMAGE, types.ImagePullOptions{})
+	addedServerRequest := channels.ServerAddedRequest{
+		ServerId: int(server.ID),
+	}
+
+	addedServerRequestJson, err := json.Marshal(addedServerRequest)
 
 	if err != nil {
-		logger.Info("Error pulling container image: " + err.Error())
-		os.Exit(0)
+		logger.Error("Error marshalling server added request: " + err.Error())
 		return
 	}
 
+	channels.PublishEvent("servers:added", addedServerRequestJson)
+
+}
+
+func provisionServer(server db.Server, job *db.Job) error {
+
+	logger.Info("Creating container for server " + server.Name + "(" + server.ContainerName + ")")
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Minute*5)
+	defer cancel()
+
+	template, err := ResolveTemplate(server)
+
+	if err != nil {
+		return fmt.Errorf("resolving template: %w", err)
+	}
+
+	logger.Info("Pulling container image " + template.Image)
+
+	job.SetPhase(db.JOB_PULLING)
+
+	err = ContainerRuntime.PullImage(ctx, template.Image)
+
+	if err != nil {
+		return fmt.Errorf("pulling container image: %w", err)
+	}
+
+	job.SetPhase(db.JOB_CREATING)
+
+	localDir, err := LocalServerDir(server.ContainerName)
+
+	if err != nil {
+		return err
+	}
+
 	serverBind := path.Join(DATA_DIR, "servers", server.ContainerName)
 
-	os.MkdirAll(path.Join("/data", "servers", server.ContainerName), os.ModePerm)
+	err = os.MkdirAll(localDir, os.ModePerm)
 
-	resp, err := DockerClient.ContainerCreate(ctx, &container.Config{
-		Image: SERVER_IMAGE,
-		Env: []string{
-			"VERSION=1.12.2",
-			"EULA=TRUE",
-			"TYPE=PAPER",
-			"MAX_MEMORY=2048M",
-			"TZ=Europe/Kiev",
-			"USE_AIKAR_FLAGS=true",
-			"ONLINE_MODE=false",
-		},
-	},
-		&container.HostConfig{
-			Mounts: []mount.Mount{
-				{
-					Type:     mount.TypeBind,
-					Source:   serverBind,
-					Target:   "/data",
-					ReadOnly: false,
-				},
-			},
+	if err != nil {
+		return fmt.Errorf("creating data directory: %w", err)
+	}
+
+	mounts := []Mount{
+		{
+			Source: serverBind,
+			Target: "/data",
 		},
-		&network.NetworkingConfig{}, &v1.Platform{}, server.ContainerName)
+	}
+
+	for _, m := range template.Mounts {
+
+		// Templates stored before mounts were restricted are checked again here
+		err = ValidateMountSource(m.Source)
+
+		if err != nil {
+			return fmt.Errorf("mount %s: %w", m.Source, err)
+		}
+
+		mounts = append(mounts, Mount{
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
+
+	apiKey, err := auth.IssueServerKey(server.ID)
 
 	if err != nil {
-		logger.Error("Error creating container: " + err.Error())
-		return
+		return fmt.Errorf("issuing api key: %w", err)
 	}
 
-	logger.Info("Container created: " + resp.ID)
+	signingKey, err := channels.ActiveSigningKey(server.ID)
 
-	err = DockerClient.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
+	if err != nil {
+		return fmt.Errorf("issuing signing key: %w", err)
+	}
+
+	serverEnv := template.EnvVariables()
+	serverEnv = append(serverEnv, GetPreparedEnvVariables(server, apiKey)...)
+	serverEnv = append(serverEnv, RconEnvVariables(server.RconPassword)...)
+	serverEnv = append(serverEnv, SigningEnvVariables(signingKey)...)
+
+	containerId, err := ContainerRuntime.CreateContainer(ctx, ContainerSpec{
+		Name:   server.ContainerName,
+		Image:  template.Image,
+		Env:    serverEnv,
+		Mounts: mounts,
+		Ports: map[string]string{
+			"25565/tcp": strconv.Itoa(server.Port),
+		},
+		Resources: BuildResources(template.Limits.Merge(server.Limits), template.Memory),
+	})
 
 	if err != nil {
-		logger.Error("Error starting container: " + err.Error())
-		return
+		return fmt.Errorf("creating container: %w", err)
 	}
 
-	logger.Info("Container started: " + resp.ID)
+	logger.Info("Container created: " + containerId)
 
-	addedServerRequest := channels.ServerAddedRequest{
-		ServerId: int(server.ID),
+	// The api reaches rcon through the compose network
+	if networkName := os.Getenv("NETWORK_NAME"); networkName != "" {
+		err = ContainerRuntime.ConnectNetwork(ctx, networkName, containerId)
+
+		if err != nil {
+			return fmt.Errorf("connecting container to network: %w", err)
+		}
 	}
 
-	addedServerRequestJson, err := json.Marshal(addedServerRequest)
+	job.SetPhase(db.JOB_STARTING)
+
+	err = ContainerRuntime.StartContainer(ctx, containerId)
 
 	if err != nil {
-		logger.Error("Error marshalling server added request: " + err.Error())
-		return
+		return fmt.Errorf("starting container: %w", err)
 	}
 
-	channels.RedisConnection.Publish(context.Background(), "servers:added", addedServerRequestJson)
+	logger.Info("Container started: " + containerId)
 
+	return RecordServerState(ctx, &server)
+}
+
+func ResolveTemplate(server db.Server) (db.ServerTemplate, error) {
+
+	template := db.DefaultServerTemplate()
+
+	if server.TemplateID != 0 {
+		err := db.OpenedConnection.First(&template, server.TemplateID).Error
+
+		if err != nil {
+			return template, err
+		}
+	}
+
+	return template.WithOverrides(server.Overrides), nil
 }
 
 func serverExistsInDb(containerName string) bool {
@@ -139,29 +224,41 @@ func serverExistsInDb(containerName string) bool {
 
 func serverExists(name string) bool {
 
-	containerList, err := DockerClient.ContainerList(context.Background(), types.ContainerListOptions{
-		All: true,
-	})
+	_, err := ContainerRuntime.InspectContainer(context.Background(), name)
 
-	if err != nil {
-		logger.Error("Error listing containers: " + err.Error())
-		return false
+	if err != nil && err != ErrContainerNotFound {
+		logger.Error("Error inspecting container: " + err.Error())
 	}
 
-	for _, container := range containerList {
-		if container.Names[0] == "/"+name {
-			return true
-		}
+	return err == nil
+}
+
+func RconEnvVariables(password string) []string {
+	if password == "" {
+		return []string{}
 	}
 
-	return false
+	return []string{
+		"ENABLE_RCON=true",
+		"RCON_PORT=" + strconv.Itoa(rcon.DEFAULT_PORT),
+		"RCON_PASSWORD=" + password,
+	}
 }
 
-func GetPreparedEnvVariables(server db.Server) []string {
+// Key the plugin uses to verify requests from the api and sign its own
+func SigningEnvVariables(key db.SigningKey) []string {
+	return []string{
+		"SIGNING_KEY_ID=" + key.KeyID,
+		"SIGNING_KEY=" + key.Secret,
+	}
+}
+
+// apiKey is the server's own key (see auth.IssueServerKey), never the admin secret
+func GetPreparedEnvVariables(server db.Server, apiKey string) []string {
 	return []string{
 		"API_HOST=web",
 		"API_PORT=80",
-		"API_KEY=" + config.LoadedConfiguration.Secret,
+		"API_KEY=" + apiKey,
 		"SERVER_ID=" + strconv.Itoa(int(server.ID)),
 		"DB_HOST=db",
 		"DB_PORT=5432",
@@ -170,6 +267,9 @@ func GetPreparedEnvVariables(server db.Server) []string {
 		"DB_NAME=postgres",
 		"REDIS_HOST=redis",
 		"REDIS_PORT=6379",
+		// The image writes server.properties from the env only when creating it, otherwise
+		// every start would undo the changes made through the properties editor
+		"OVERRIDE_SERVER_PROPERTIES=false",
 	}
 }
 
@@ -177,7 +277,7 @@ func createPreloadContainer(name string) {
 
 	server := db.Server{}
 
-	db.OpenedConnection.First("container_name = ?", name).First(&server)
+	db.OpenedConnection.Where("container_name = ?", name).First(&server)
 
 	if server.ID == 0 {
 		logger.Error("Server not found")
@@ -202,29 +302,46 @@ func createPreloadContainer(name string) {
 
 	logger.Info("Creating container for server " + server.Name + "(" + server.ContainerName + ")")
 
-	ctx, _ := context.WithTimeout(context.TODO(), time.Minute*5)
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Minute*5)
+	defer cancel()
 
 	logger.Info("Pulling container image")
 
-	_, err = DockerClient.ImagePull(ctx, SERVER_IMAGE, types.ImagePullOptions{})
+	err = ContainerRuntime.PullImage(ctx, SERVER_IMAGE)
 
 	if err != nil {
-		logger.Info("Error pulling container image: " + err.Error())
-		os.Exit(0)
+		logger.Error("Error pulling container image: " + err.Error())
+		return
+	}
+
+	localDir, err := LocalServerDir(server.ContainerName)
+
+	if err != nil {
+		logger.Error("Error creating container for server " + server.Name + ": " + err.Error())
 		return
 	}
 
 	serverBind := path.Join(DATA_DIR, "servers", server.ContainerName)
 
-	os.MkdirAll(path.Join("/data", "servers", server.ContainerName), os.ModePerm)
+	os.MkdirAll(localDir, os.ModePerm)
 
-	mounts := []mount.Mount{
-		{
-			Type:     mount.TypeBind,
-			Source:   serverBind,
-			Target:   "/data",
-			ReadOnly: false,
-		},
+	if server.RconPassword == "" {
+		server.RconPassword = rcon.GeneratePassword()
+		db.OpenedConnection.Model(&server).Update("rcon_password", server.RconPassword)
+	}
+
+	apiKey, err := auth.IssueServerKey(server.ID)
+
+	if err != nil {
+		logger.Error("Error issuing api key: " + err.Error())
+		return
+	}
+
+	signingKey, err := channels.ActiveSigningKey(server.ID)
+
+	if err != nil {
+		logger.Error("Error issuing signing key: " + err.Error())
+		return
 	}
 
 	envs := []string{}
@@ -232,98 +349,89 @@ func createPreloadContainer(name string) {
 	for key, value := range preloadedServer.Env {
 		envs = append(envs, key+"="+value)
 	}
-	envs = append(envs, GetPreparedEnvVariables(server)...)
+	envs = append(envs, GetPreparedEnvVariables(server, apiKey)...)
+	envs = append(envs, RconEnvVariables(server.RconPassword)...)
+	envs = append(envs, SigningEnvVariables(signingKey)...)
 
-	serverPort := strconv.Itoa(server.Port)
-
-	container, err := DockerClient.ContainerCreate(context.Background(), &container.Config{
+	containerId, err := ContainerRuntime.CreateContainer(context.Background(), ContainerSpec{
+		Name:  server.ContainerName,
 		Image: SERVER_IMAGE,
 		Env:   envs,
-	}, &container.HostConfig{
-		Mounts: mounts,
-		PortBindings: nat.PortMap{
-			"25565/tcp": []nat.PortBinding{
-				{
-					HostIP:   "0.0.0.0",
-					HostPort: serverPort,
-				},
+		Mounts: []Mount{
+			{
+				Source: serverBind,
+				Target: "/data",
 			},
 		},
-	}, nil, nil, server.ContainerName)
+		Ports: map[string]string{
+			"25565/tcp": strconv.Itoa(server.Port),
+		},
+		Resources: BuildResources(server.Limits, preloadedServer.Env["MAX_MEMORY"]),
+	})
 
 	if err != nil {
 		logger.Error("Error creating container: " + err.Error())
 		return
 	}
 
-	logger.Info("Container created: " + container.ID)
+	logger.Info("Container created: " + containerId)
 
-	network, err := GetNetworkByName(os.Getenv("NETWORK_NAME"))
+	startPreloadedContainer(server.ContainerName)
+}
 
-	if err != nil {
-		logger.Error("Error getting network: " + err.Error())
+func startPreloadedContainer(name string) {
+
+	container, err := ContainerRuntime.InspectContainer(context.Background(), name)
+
+	if err == ErrContainerNotFound {
+		createPreloadContainer(name)
 		return
 	}
 
-	err = DockerClient.NetworkConnect(context.Background(), network.ID, container.ID, nil)
-
 	if err != nil {
-		logger.Error("Error connecting container to network: " + err.Error())
+		logger.Error("Error inspecting container: " + err.Error())
 		return
 	}
 
-	startPreloadedContainer(server.ContainerName)
-}
+	networkName := os.Getenv("NETWORK_NAME")
 
-func startPreloadedContainer(name string) {
-
-	container, err := DockerClient.ContainerList(context.Background(), types.ContainerListOptions{
-		All: true,
-	})
+	err = ContainerRuntime.ConnectNetwork(context.Background(), networkName, container.ID)
 
 	if err != nil {
-		logger.Error("Error listing containers: " + err.Error())
+		logger.Error("Error connecting container to network: " + err.Error())
 		return
 	}
 
-	for _, container := range container {
-		if container.Names[0] == "/"+name {
+	logger.Info("Container " + container.ID + " connected to network " + networkName)
+	err = ContainerRuntime.StartContainer(context.Background(), container.ID)
 
-			network, err := GetNetworkByName(os.Getenv("NETWORK_NAME"))
-
-			if err != nil {
-				logger.Error("Error getting network: " + err.Error())
-				return
-			}
-
-			err = DockerClient.NetworkConnect(context.Background(), network.ID, container.ID, nil)
+	if err != nil {
+		logger.Error("Error starting container: " + err.Error())
+		return
+	}
 
-			if err != nil {
-				logger.Error("Error connecting container to network: " + err.Error())
-				return
-			}
+	logger.Info("Container started: " + container.ID)
+}
+func readPreloadedServer(name string) (PreloadedServer, error) {
 
-			logger.Info("Container " + container.ID + " connected to network " + network.Name + " (" + network.ID + ")")
-			err = DockerClient.ContainerStart(context.Background(), container.ID, types.ContainerStartOptions{})
+	preloadedServer := PreloadedServer{}
 
-			if err != nil {
-				logger.Error("Error starting container: " + err.Error())
-				return
-			}
+	preloadedServerJson, err := os.ReadFile(path.Join(PRELOADED_SERVERS_DIR, name, "info.json"))
 
-			logger.Info("Container started: " + container.ID)
-			return
-		}
+	if err != nil {
+		return preloadedServer, err
 	}
 
-	createPreloadContainer(name)
+	err = json.Unmarshal(preloadedServerJson, &preloadedServer)
 
+	return preloadedServer, err
 }
+
 func PreloadServers() {
 
 	logger.Info("Preloading servers")
 
-	files, err := os.ReadDir("preloaded")
+	files, err := os.ReadDir(PRELOADED_SERVERS_DIR)
 
 	if err != nil {
 		logger.Error("Error reading preloaded servers directory: " + err.Error())
@@ -343,139 +451,204 @@ func PreloadServers() {
 
 			logger.Info("Preloading server " + file.Name())
 
-			preloadedServer := PreloadedServer{}
-
-			preloadedServerJson, err := os.ReadFile(path.Join("preloaded", file.Name(), "info.json"))
+			err := preloadServer(file.Name())
 
 			if err != nil {
-				logger.Error("Error reading preloaded server info: " + err.Error())
-				continue
+				logger.Error("Error preloading server " + file.Name() + ": " + err.Error())
 			}
+		}
+	}
+}
 
-			err = json.Unmarshal(preloadedServerJson, &preloadedServer)
+// preloadServer creates the row, port lease, keys and container of a preloaded server.
+// Whatever was created is removed again when a later step fails, so the next start retries cleanly.
+func preloadServer(name string) error {
 
-			if err != nil {
-				logger.Error("Error unmarshalling preloaded server info: " + err.Error())
-				continue
-			}
+	localDir, err := LocalServerDir(name)
+
+	if err != nil {
+		return err
+	}
 
-			envs := []string{}
+	preloadedServer, err := readPreloadedServer(name)
 
-			for key, value := range preloadedServer.Env {
-				envs = append(envs, key+"="+value)
-			}
+	if err != nil {
+		return fmt.Errorf("reading preloaded server info: %w", err)
+	}
+
+	serverPort, err := AllocatePort(0)
+
+	if err != nil {
+		return fmt.Errorf("allocating port: %w", err)
+	}
 
-			envs = append(envs, GetPreparedEnvVariables(db.Server{})...)
+	// The row comes first so the container gets a key bound to its server id
+	server := db.Server{
+		Name:          preloadedServer.Name,
+		ContainerName: name,
+		IP:            name, // Internal
+		Region:        "eu",
+		Port:          serverPort,
+		RconPassword:  rcon.GeneratePassword(),
+	}
 
-			var latestServer db.Server
+	err = db.OpenedConnection.Create(&server).Error
 
-			db.OpenedConnection.Last(&latestServer)
+	if err != nil {
+		ReleasePort(serverPort)
+		return fmt.Errorf("creating server: %w", err)
+	}
 
-			lastId := 0
+	containerId := ""
 
-			if latestServer.ID > 1 {
-				lastId = int(latestServer.ID)
-				logger.Info("Last server was not null!")
-			}
+	err = func() error {
 
-			var serverPort string
+		err := AssignPort(serverPort, server.ID)
 
-			if 25565+lastId == 25577 {
-				serverPort = strconv.Itoa(25565 + lastId + 1)
-			} else {
-				serverPort = strconv.Itoa(25565 + lastId)
-			}
+		if err != nil {
+			return fmt.Errorf("assigning port: %w", err)
+		}
 
-			serverBind := path.Join(DATA_DIR, "servers", file.Name())
-			logger.Info("Server bind: " + serverBind)
+		apiKey, err := auth.IssueServerKey(server.ID)
 
-			os.MkdirAll(path.Join("/data", "servers", file.Name()), os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("issuing api key: %w", err)
+		}
+
+		signingKey, err := channels.RotateSigningKey(server.ID, 0)
+
+		if err != nil {
+			return fmt.Errorf("issuing signing key: %w", err)
+		}
+
+		envs := []string{}
+
+		for key, value := range preloadedServer.Env {
+			envs = append(envs, key+"="+value)
+		}
+
+		envs = append(envs, GetPreparedEnvVariables(server, apiKey)...)
+		envs = append(envs, RconEnvVariables(server.RconPassword)...)
+		envs = append(envs, SigningEnvVariables(signingKey)...)
 
-			mounts := []mount.Mount{
+		serverBind := path.Join(DATA_DIR, "servers", name)
+		logger.Info("Server bind: " + serverBind)
+
+		os.MkdirAll(localDir, os.ModePerm)
+
+		containerId, err = ContainerRuntime.CreateContainer(context.Background(), ContainerSpec{
+			Name:  name,
+			Image: SERVER_IMAGE,
+			Env:   envs,
+			Mounts: []Mount{
 				{
-					Type:     mount.TypeBind,
-					Source:   serverBind,
-					Target:   "/data",
-					ReadOnly: false,
+					Source: serverBind,
+					Target: "/data",
 				},
-			}
+			},
+			Ports: map[string]string{
+				"25565/tcp": strconv.Itoa(serverPort),
+			},
+			Resources: BuildResources(db.ResourceLimits{}, preloadedServer.Env["MAX_MEMORY"]),
+		})
 
-			container, err := DockerClient.ContainerCreate(context.Background(), &container.Config{
-				Image: SERVER_IMAGE,
-				Env:   envs,
-			}, &container.HostConfig{
-				Mounts: mounts,
-				PortBindings: nat.PortMap{
-					"25565/tcp": []nat.PortBinding{
-						{
-							HostIP:   "0.0.0.0",
-							HostPort: serverPort,
-						},
-					},
-				},
-			}, nil, nil, file.Name())
+		if err != nil {
+			return fmt.Errorf("creating container: %w", err)
+		}
 
-			if err != nil {
-				logger.Error("Error creating container: " + err.Error())
-				continue
-			}
+		err = ContainerRuntime.ConnectNetwork(context.Background(), os.Getenv("NETWORK_NAME"), containerId)
 
-			network, err := GetNetworkByName(os.Getenv("NETWORK_NAME"))
+		if err != nil {
+			return fmt.Errorf("connecting container to network: %w", err)
+		}
 
-			if err != nil {
-				logger.Error("Error getting network: " + err.Error())
-				return
-			}
+		return ContainerRuntime.StartContainer(context.Background(), containerId)
+	}()
 
-			err = DockerClient.NetworkConnect(context.Background(), network.ID, container.ID, nil)
+	if err != nil {
+		discardPreloadedServer(server, containerId)
+		return err
+	}
 
-			if err != nil {
-				logger.Error("Error connecting container to network: " + err.Error())
-				return
-			}
-			//Inserting in db
+	logger.Info("Container started: " + containerId)
 
-			portInt, err := strconv.Atoi(serverPort)
+	return nil
+}
 
-			if err != nil {
-				logger.Error("Error converting port to int: " + err.Error())
-				continue
-			}
+func discardPreloadedServer(server db.Server, containerId string) {
 
-			server := db.Server{
-				Name:          preloadedServer.Name,
-				ContainerName: file.Name(),
-				IP:            file.Name(), // Internal
-				Region:        "eu",
-				Port:          portInt,
-			}
+	if containerId != "" {
+		err := ContainerRuntime.RemoveContainer(context.Background(), containerId)
 
-			db.OpenedConnection.Create(&server)
+		if err != nil {
+			logger.Error("Error removing container: " + err.Error())
+		}
+	}
 
-			err = DockerClient.ContainerStart(context.Background(), container.ID, types.ContainerStartOptions{})
-			if err != nil {
-				logger.Error("Error starting container: " + err.Error())
-				continue
-			}
+	err := ReleaseServerPorts(server.ID)
+
+	if err != nil {
+		logger.Error("Error releasing ports: " + err.Error())
+	}
+
+	db.OpenedConnection.Model(&db.ApiKey{}).Where("server_id = ?", server.ID).Update("revoked", true)
+	db.OpenedConnection.Where("server_id = ?", server.ID).Delete(&db.SigningKey{})
+	db.OpenedConnection.Delete(&server)
+}
+
+// ReissueServerCredentials gives containers created before servers had their own keys (and
+// still carry the admin Secret as API_KEY) or with broader key scopes a fresh api and signing key.
+// The container is recreated for that, so it happens once per server.
+func ReissueServerCredentials() {
+
+	servers := []db.Server{}
+	db.OpenedConnection.Find(&servers)
+
+	for _, server := range servers {
+		if auth.HasCurrentServerKey(server.ID) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+		err := reissueServerCredentials(ctx, server)
+		cancel()
 
-			logger.Info("Container started: " + container.ID)
+		if err != nil {
+			logger.Error("Error reissuing credentials of server " + server.Name + ": " + err.Error())
 		}
 	}
 }
 
-func GetNetworkByName(networkName string) (types.NetworkResource, error) {
+func reissueServerCredentials(ctx context.Context, server db.Server) error {
 
-	networks, err := DockerClient.NetworkList(context.Background(), types.NetworkListOptions{})
+	container, err := ContainerRuntime.InspectContainer(ctx, server.ContainerName)
+
+	// The key is issued when the container gets created
+	if err == ErrContainerNotFound {
+		return nil
+	}
 
 	if err != nil {
-		return types.NetworkResource{}, err
+		return err
 	}
 
-	for _, network := range networks {
-		if network.Name == networkName {
-			return network, nil
-		}
+	logger.Info("Reissuing credentials of server " + server.Name)
+
+	apiKey, err := auth.IssueServerKey(server.ID)
+
+	if err != nil {
+		return err
 	}
 
-	return types.NetworkResource{}, errors.New("Network not found")
+	signingKey, err := channels.ActiveSigningKey(server.ID)
+
+	if err != nil {
+		return err
+	}
+
+	env := append([]string{"API_KEY=" + apiKey}, SigningEnvVariables(signingKey)...)
+
+	_, err = ContainerRuntime.ReplaceEnv(ctx, container.ID, env)
+
+	return err
 }
@@ -0,0 +1,368 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+)
+
+type DockerRuntime struct {
+	Client *client.Client
+}
+
+func NewDockerRuntime(cli *client.Client) *DockerRuntime {
+	return &DockerRuntime{Client: cli}
+}
+
+func (r *DockerRuntime) PullImage(ctx context.Context, image string) error {
+	reader, err := r.Client.ImagePull(ctx, image, types.ImagePullOptions{})
+
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	// The pull only completes once the progress stream is drained
+	_, err = io.Copy(io.Discard, reader)
+
+	return err
+}
+
+func (r *DockerRuntime) CreateContainer(ctx context.Context, spec ContainerSpec) (string, error) {
+
+	mounts := []mount.Mount{}
+
+	for _, m := range spec.Mounts {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
+
+	exposed := nat.PortSet{}
+	bindings := nat.PortMap{}
+
+	for containerPort, hostPort := range spec.Ports {
+		port := nat.Port(containerPort)
+		exposed[port] = struct{}{}
+		bindings[port] = []nat.PortBinding{
+			{
+				HostIP:   "0.0.0.0",
+				HostPort: hostPort,
+			},
+		}
+	}
+
+	hostConfig := &container.HostConfig{
+		Mounts:       mounts,
+		PortBindings: bindings,
+		Resources:    dockerResources(spec.Resources),
+	}
+
+	if spec.Resources.StorageSize != "" {
+		hostConfig.StorageOpt = map[string]string{"size": spec.Resources.StorageSize}
+	}
+
+	resp, err := r.Client.ContainerCreate(ctx, &container.Config{
+		Image:        spec.Image,
+		Env:          spec.Env,
+		ExposedPorts: exposed,
+	}, hostConfig, nil, nil, spec.Name)
+
+	if err != nil {
+		return "", err
+	}
+
+	return resp.ID, nil
+}
+
+func (r *DockerRuntime) StartContainer(ctx context.Context, id string) error {
+	return r.Client.ContainerStart(ctx, id, types.ContainerStartOptions{})
+}
+
+func (r *DockerRuntime) StopContainer(ctx context.Context, id string, timeout *time.Duration) error {
+	return r.Client.ContainerStop(ctx, id, timeout)
+}
+
+func (r *DockerRuntime) RestartContainer(ctx context.Context, id string, timeout *time.Duration) error {
+	return r.Client.ContainerRestart(ctx, id, timeout)
+}
+
+func (r *DockerRuntime) KillContainer(ctx context.Context, id string, signal string) error {
+	return r.Client.ContainerKill(ctx, id, signal)
+}
+
+func (r *DockerRuntime) RemoveContainer(ctx context.Context, id string) error {
+	return r.Client.ContainerRemove(ctx, id, types.ContainerRemoveOptions{
+		Force: true,
+	})
+}
+
+func (r *DockerRuntime) ListContainers(ctx context.Context) ([]Container, error) {
+	return r.listContainers(ctx, filters.NewArgs())
+}
+
+func (r *DockerRuntime) InspectContainer(ctx context.Context, name string) (Container, error) {
+
+	containers, err := r.listContainers(ctx, filters.NewArgs(filters.Arg("name", "^/"+name+"$")))
+
+	if err != nil {
+		return Container{}, err
+	}
+
+	for _, c := range containers {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+
+	return Container{}, ErrContainerNotFound
+}
+
+func (r *DockerRuntime) ConnectNetwork(ctx context.Context, network string, id string) error {
+
+	networks, err := r.Client.NetworkList(ctx, types.NetworkListOptions{})
+
+	if err != nil {
+		return err
+	}
+
+	for _, n := range networks {
+		if n.Name == network {
+			return r.Client.NetworkConnect(ctx, n.ID, id, nil)
+		}
+	}
+
+	return errors.New("Network not found")
+}
+
+func (r *DockerRuntime) UpdateResources(ctx context.Context, id string, resources Resources) error {
+	_, err := r.Client.ContainerUpdate(ctx, id, container.UpdateConfig{
+		Resources: dockerUpdateResources(resources),
+	})
+
+	return err
+}
+
+func (r *DockerRuntime) Logs(ctx context.Context, id string, options LogOptions) (io.ReadCloser, error) {
+
+	stream, err := r.Client.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     options.Follow,
+		Tail:       options.Tail,
+		Timestamps: options.Timestamps,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Containers run without a tty, so docker multiplexes both streams into one
+	reader, writer := io.Pipe()
+
+	go func() {
+		_, err := stdcopy.StdCopy(writer, writer, stream)
+		stream.Close()
+		writer.CloseWithError(err)
+	}()
+
+	return reader, nil
+}
+
+func (r *DockerRuntime) Exec(ctx context.Context, id string, cmd []string) (string, error) {
+
+	exec, err := r.Client.ContainerExecCreate(ctx, id, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := r.Client.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Close()
+
+	var output strings.Builder
+
+	_, err = stdcopy.StdCopy(&output, &output, resp.Reader)
+
+	if err != nil {
+		return "", err
+	}
+
+	inspect, err := r.Client.ContainerExecInspect(ctx, exec.ID)
+
+	if err != nil {
+		return "", err
+	}
+
+	if inspect.ExitCode != 0 {
+		return output.String(), fmt.Errorf("command exited with code %d", inspect.ExitCode)
+	}
+
+	return output.String(), nil
+}
+
+func (r *DockerRuntime) listContainers(ctx context.Context, args filters.Args) ([]Container, error) {
+
+	list, err := r.Client.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: args,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	containers := []Container{}
+
+	for _, c := range list {
+
+		name := ""
+
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		ports := []int{}
+
+		for _, port := range c.Ports {
+			if port.PublicPort != 0 {
+				ports = append(ports, int(port.PublicPort))
+			}
+		}
+
+		containers = append(containers, Container{
+			ID:     c.ID,
+			Name:   name,
+			Image:  c.Image,
+			State:  c.State,
+			Status: c.Status,
+			Ports:  ports,
+		})
+	}
+
+	return containers, nil
+}
+
+func dockerResources(resources Resources) container.Resources {
+
+	result := container.Resources{
+		CPUShares: resources.CpuShares,
+		NanoCPUs:  resources.NanoCpus,
+		Memory:    resources.Memory,
+	}
+
+	if resources.Memory != 0 {
+		result.MemorySwap = resources.Memory
+	}
+
+	if resources.PidsLimit != 0 {
+		pidsLimit := resources.PidsLimit
+		result.PidsLimit = &pidsLimit
+	}
+
+	return result
+}
+
+// Docker's default cpu weight
+const DEFAULT_CPU_SHARES = 1024
+
+// dockerUpdateResources sends lifted limits as docker's explicit defaults, an update leaves
+// zero values unchanged. Memory and cpus can't be lifted, see ApplyServerResources.
+func dockerUpdateResources(resources Resources) container.Resources {
+
+	result := dockerResources(resources)
+
+	if result.CPUShares == 0 {
+		result.CPUShares = DEFAULT_CPU_SHARES
+	}
+
+	if result.PidsLimit == nil {
+		unlimited := int64(-1)
+		result.PidsLimit = &unlimited
+	}
+
+	return result
+}
+
+func (r *DockerRuntime) ReplaceEnv(ctx context.Context, id string, env []string) (string, error) {
+
+	info, err := r.Client.ContainerInspect(ctx, id)
+
+	if client.IsErrNotFound(err) {
+		return "", ErrContainerNotFound
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	running := info.State != nil && info.State.Running
+
+	if running {
+		err = r.Client.ContainerStop(ctx, info.ID, nil)
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = r.Client.ContainerRemove(ctx, info.ID, types.ContainerRemoveOptions{})
+
+	if err != nil {
+		return "", err
+	}
+
+	info.Config.Env = mergeEnv(info.Config.Env, env)
+
+	resp, err := r.Client.ContainerCreate(ctx, info.Config, info.HostConfig, nil, nil, strings.TrimPrefix(info.Name, "/"))
+
+	if err != nil {
+		return "", err
+	}
+
+	// Only the network mode's network is attached on create, the others are connected again
+	for name, endpoint := range info.NetworkSettings.Networks {
+		mode := info.HostConfig.NetworkMode
+
+		if name == mode.NetworkName() || (mode.IsDefault() && name == "bridge") {
+			continue
+		}
+
+		err = r.Client.NetworkConnect(ctx, name, resp.ID, &network.EndpointSettings{Aliases: endpoint.Aliases})
+
+		if err != nil {
+			return resp.ID, err
+		}
+	}
+
+	if running {
+		err = r.Client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
+	}
+
+	return resp.ID, err
+}
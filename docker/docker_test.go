@@ -0,0 +1,271 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/db/dbtest"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"gorm.io/gorm"
+)
+
+// setupPreload gives PreloadServers a fake runtime, an empty database and temporary
+// data and preloaded directories holding the given info.json files
+func setupPreload(t *testing.T, infos map[string]string) *FakeRuntime {
+
+	dbtest.Open(t, &db.Server{}, &db.PortLease{}, &db.ApiKey{}, &db.SigningKey{})
+
+	runtime := NewFakeRuntime()
+	preloaded := t.TempDir()
+
+	for name, info := range infos {
+		os.MkdirAll(filepath.Join(preloaded, name), os.ModePerm)
+
+		err := os.WriteFile(filepath.Join(preloaded, name, "info.json"), []byte(info), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previousRuntime, previousData, previousPreloaded := ContainerRuntime, LOCAL_DATA_DIR, PRELOADED_SERVERS_DIR
+
+	ContainerRuntime, LOCAL_DATA_DIR, PRELOADED_SERVERS_DIR = runtime, t.TempDir(), preloaded
+
+	t.Cleanup(func() {
+		ContainerRuntime, LOCAL_DATA_DIR, PRELOADED_SERVERS_DIR = previousRuntime, previousData, previousPreloaded
+	})
+
+	return runtime
+}
+
+func count(t *testing.T, model interface{}, query string, args ...interface{}) int64 {
+
+	var n int64
+
+	err := db.OpenedConnection.Model(model).Where(query, args...).Count(&n).Error
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestPreloadServers(t *testing.T) {
+
+	lobby := `{"name": "Lobby", "env": {"MAX_MEMORY": "1G", "MOTD": "hi"}}`
+
+	tests := []struct {
+		name  string
+		infos map[string]string
+		fail  string
+		// Servers (and with them running containers, leases, keys) left afterwards
+		servers int64
+	}{
+		{name: "new server", infos: map[string]string{"lobby": lobby}, servers: 1},
+		{name: "two servers", infos: map[string]string{"lobby": lobby, "survival": `{"name": "Survival"}`}, servers: 2},
+		{name: "broken info.json", infos: map[string]string{"lobby": `{`}},
+		{name: "invalid directory name", infos: map[string]string{"-lobby": lobby}},
+		{name: "create fails", infos: map[string]string{"lobby": lobby}, fail: "CreateContainer"},
+		{name: "network fails", infos: map[string]string{"lobby": lobby}, fail: "ConnectNetwork"},
+		{name: "start fails", infos: map[string]string{"lobby": lobby}, fail: "StartContainer"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			runtime := setupPreload(t, test.infos)
+
+			if test.fail != "" {
+				runtime.Fail[test.fail] = errors.New("injected failure")
+			}
+
+			PreloadServers()
+
+			// A failed preload must leave nothing behind, so the next start retries cleanly
+			checks := map[string]int64{
+				"servers":         count(t, &db.Server{}, "1 = 1"),
+				"assigned leases": count(t, &db.PortLease{}, "server_id <> 0"),
+				"all leases":      count(t, &db.PortLease{}, "1 = 1"),
+				"api keys":        count(t, &db.ApiKey{}, "revoked = ?", false),
+				"signing keys":    count(t, &db.SigningKey{}, "1 = 1"),
+				"containers":      int64(len(runtime.Containers)),
+			}
+
+			for what, got := range checks {
+				if got != test.servers {
+					t.Errorf("%d %s, want %d", got, what, test.servers)
+				}
+			}
+
+			for _, container := range runtime.Containers {
+				if container.State != "running" || len(container.Networks) != 1 {
+					t.Errorf("container %s is %s on networks %v", container.Name, container.State, container.Networks)
+				}
+			}
+		})
+	}
+}
+
+func TestPreloadServersKeepsExisting(t *testing.T) {
+
+	runtime := setupPreload(t, map[string]string{"lobby": `{"name": "Lobby", "env": {"MAX_MEMORY": "1G"}}`})
+
+	PreloadServers()
+
+	server := db.Server{}
+	db.OpenedConnection.First(&server)
+
+	for _, container := range runtime.Containers {
+		runtime.StopContainer(context.Background(), container.ID, nil)
+	}
+
+	// On the next start the row exists, the stopped container is started again
+	PreloadServers()
+
+	if n := count(t, &db.Server{}, "1 = 1"); n != 1 {
+		t.Errorf("%d servers after preloading twice", n)
+	}
+
+	if len(runtime.Containers) != 1 {
+		t.Fatalf("%d containers after preloading twice", len(runtime.Containers))
+	}
+
+	for _, container := range runtime.Containers {
+		if container.State != "running" || container.Name != server.ContainerName {
+			t.Errorf("container %s of server %s is %s", container.Name, server.ContainerName, container.State)
+		}
+
+		env := map[string]bool{}
+
+		for _, variable := range container.Spec.Env {
+			env[variable] = true
+		}
+
+		if !env["MAX_MEMORY=1G"] || !env["SERVER_ID="+strconv.Itoa(int(server.ID))] {
+			t.Errorf("container env %v", container.Spec.Env)
+		}
+	}
+}
+
+// setupProvisioning gives CreateServer a fake runtime, an empty database, a temporary data
+// directory and redis for the servers:added event. The returned slice collects every phase
+// a job is saved with.
+func setupProvisioning(t *testing.T) (*FakeRuntime, *[]string) {
+
+	dbtest.Open(t, &db.Server{}, &db.ServerTemplate{}, &db.Job{}, &db.ApiKey{}, &db.SigningKey{})
+
+	runtime := NewFakeRuntime()
+	previousRuntime, previousRedis := ContainerRuntime, channels.RedisConnection
+	previousData, previousLocal := DATA_DIR, LOCAL_DATA_DIR
+
+	ContainerRuntime = runtime
+	channels.RedisConnection = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	DATA_DIR, LOCAL_DATA_DIR = "/srv/lisek", t.TempDir()
+
+	t.Cleanup(func() {
+		channels.RedisConnection.Close()
+		ContainerRuntime, channels.RedisConnection = previousRuntime, previousRedis
+		DATA_DIR, LOCAL_DATA_DIR = previousData, previousLocal
+	})
+
+	phases := []string{}
+
+	db.OpenedConnection.Callback().Update().After("gorm:update").Register("test:record_phase", func(tx *gorm.DB) {
+		if job, ok := tx.Statement.Dest.(*db.Job); ok {
+			phases = append(phases, job.Phase)
+		}
+	})
+
+	return runtime, &phases
+}
+
+func TestCreateServer(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		fail     string
+		template uint
+		phases   []string
+		error    string
+		state    string
+	}{
+		{name: "provisioned", phases: []string{db.JOB_PULLING, db.JOB_CREATING, db.JOB_STARTING, db.JOB_READY}, state: "running"},
+		{name: "unknown template", template: 9, phases: []string{db.JOB_FAILED}, error: "resolving template: "},
+		{name: "pull fails", fail: "PullImage", phases: []string{db.JOB_PULLING, db.JOB_FAILED}, error: "pulling container image: "},
+		{name: "create fails", fail: "CreateContainer", phases: []string{db.JOB_PULLING, db.JOB_CREATING, db.JOB_FAILED}, error: "creating container: "},
+		{name: "start fails", fail: "StartContainer", phases: []string{db.JOB_PULLING, db.JOB_CREATING, db.JOB_STARTING, db.JOB_FAILED}, error: "starting container: "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			runtime, phases := setupProvisioning(t)
+
+			if test.fail != "" {
+				runtime.Fail[test.fail] = errors.New("docker said no")
+			}
+
+			server := db.Server{Name: "lobby", ContainerName: "lobby", Port: 30000, TemplateID: test.template}
+			db.OpenedConnection.Create(&server)
+
+			job, err := db.CreateJob("provision", server.ID)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			CreateServer(server, job)
+
+			if strings.Join(*phases, ",") != strings.Join(test.phases, ",") {
+				t.Errorf("phases %v, want %v", *phases, test.phases)
+			}
+
+			stored := db.Job{}
+			db.OpenedConnection.First(&stored, job.ID)
+
+			if stored.Phase != test.phases[len(test.phases)-1] || stored.FinishedAt == nil || !strings.HasPrefix(stored.Error, test.error) {
+				t.Errorf("job finished as %s at %v with %q, want error %q", stored.Phase, stored.FinishedAt, stored.Error, test.error)
+			}
+
+			db.OpenedConnection.First(&server, server.ID)
+
+			if server.State != test.state {
+				t.Errorf("server state %q, want %q", server.State, test.state)
+			}
+
+			if test.state == "" {
+				return
+			}
+
+			container := runtime.find("lobby")
+
+			if container == nil || container.State != "running" {
+				t.Fatalf("container %+v", container)
+			}
+
+			env := map[string]bool{}
+
+			for _, variable := range container.Spec.Env {
+				env[variable] = true
+			}
+
+			if !env["SERVER_ID="+strconv.Itoa(int(server.ID))] || count(t, &db.ApiKey{}, "server_id = ?", server.ID) != 1 || count(t, &db.SigningKey{}, "server_id = ?", server.ID) != 1 {
+				t.Errorf("container env %v", container.Spec.Env)
+			}
+
+			if container.Spec.Ports["25565/tcp"] != "30000" || container.Spec.Mounts[0].Source != "/srv/lisek/servers/lobby" {
+				t.Errorf("container ports %v and mounts %v", container.Spec.Ports, container.Spec.Mounts)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type FakeContainer struct {
+	Container
+	Spec     ContainerSpec
+	Networks []string
+	// Returned by Logs, one entry per line
+	LogLines []string
+	Commands [][]string
+}
+
+// FakeRuntime is an in-memory Runtime for running the lifecycle code without a docker daemon.
+// Setting Fail["StartContainer"] makes that method return the given error.
+type FakeRuntime struct {
+	mu         sync.Mutex
+	lastId     int
+	Containers map[string]*FakeContainer
+	Pulled     []string
+	Fail       map[string]error
+	// Returned by Exec for every command
+	ExecOutput string
+}
+
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		Containers: map[string]*FakeContainer{},
+		Fail:       map[string]error{},
+	}
+}
+
+func (r *FakeRuntime) PullImage(ctx context.Context, image string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Fail["PullImage"]; err != nil {
+		return err
+	}
+
+	r.Pulled = append(r.Pulled, image)
+
+	return nil
+}
+
+func (r *FakeRuntime) CreateContainer(ctx context.Context, spec ContainerSpec) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Fail["CreateContainer"]; err != nil {
+		return "", err
+	}
+
+	for _, c := range r.Containers {
+		if c.Name == spec.Name {
+			return "", errors.New("container name " + spec.Name + " is already in use")
+		}
+	}
+
+	r.lastId++
+	id := "fake-" + strconv.Itoa(r.lastId)
+
+	ports := []int{}
+
+	for _, hostPort := range spec.Ports {
+		port, err := strconv.Atoi(hostPort)
+
+		if err == nil {
+			ports = append(ports, port)
+		}
+	}
+
+	r.Containers[id] = &FakeContainer{
+		Container: Container{
+			ID:     id,
+			Name:   spec.Name,
+			Image:  spec.Image,
+			State:  "created",
+			Status: "Created",
+			Ports:  ports,
+		},
+		Spec: spec,
+	}
+
+	return id, nil
+}
+
+func (r *FakeRuntime) StartContainer(ctx context.Context, id string) error {
+	return r.setState("StartContainer", id, "running", "Up")
+}
+
+func (r *FakeRuntime) StopContainer(ctx context.Context, id string, timeout *time.Duration) error {
+	return r.setState("StopContainer", id, "exited", "Exited (0)")
+}
+
+func (r *FakeRuntime) RestartContainer(ctx context.Context, id string, timeout *time.Duration) error {
+	return r.setState("RestartContainer", id, "running", "Up")
+}
+
+func (r *FakeRuntime) KillContainer(ctx context.Context, id string, signal string) error {
+	return r.setState("KillContainer", id, "exited", "Exited (137)")
+}
+
+func (r *FakeRuntime) RemoveContainer(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Fail["RemoveContainer"]; err != nil {
+		return err
+	}
+
+	c := r.find(id)
+
+	if c == nil {
+		return ErrContainerNotFound
+	}
+
+	delete(r.Containers, c.ID)
+
+	return nil
+}
+
+func (r *FakeRuntime) ListContainers(ctx context.Context) ([]Container, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Fail["ListContainers"]; err != nil {
+		return nil, err
+	}
+
+	containers := []Container{}
+
+	for _, c := range r.Containers {
+		containers = append(containers, c.Container)
+	}
+
+	return containers, nil
+}
+
+func (r *FakeRuntime) InspectContainer(ctx context.Context, name string) (Container, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Fail["InspectContainer"]; err != nil {
+		return Container{}, err
+	}
+
+	c := r.find(name)
+
+	if c == nil {
+		return Container{}, ErrContainerNotFound
+	}
+
+	return c.Container, nil
+}
+
+func (r *FakeRuntime) ConnectNetwork(ctx context.Context, network string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Fail["ConnectNetwork"]; err != nil {
+		return err
+	}
+
+	c := r.find(id)
+
+	if c == nil {
+		return ErrContainerNotFound
+	}
+
+	c.Networks = append(c.Networks, network)
+
+	return nil
+}
+
+func (r *FakeRuntime) UpdateResources(ctx context.Context, id string, resources Resources) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Fail["UpdateResources"]; err != nil {
+		return err
+	}
+
+	c := r.find(id)
+
+	if c == nil {
+		return ErrContainerNotFound
+	}
+
+	storageSize := c.Spec.Resources.StorageSize
+	c.Spec.Resources = resources
+	c.Spec.Resources.StorageSize = storageSize
+
+	return nil
+}
+
+func (r *FakeRuntime) Logs(ctx context.Context, id string, options LogOptions) (io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Fail["Logs"]; err != nil {
+		return nil, err
+	}
+
+	c := r.find(id)
+
+	if c == nil {
+		return nil, ErrContainerNotFound
+	}
+
+	lines := c.LogLines
+
+	if tail, err := strconv.Atoi(options.Tail); err == nil && tail < len(lines) {
+		lines = lines[len(lines)-tail:]
+	}
+
+	output := ""
+
+	for _, line := range lines {
+		output += line + "\n"
+	}
+
+	return io.NopCloser(strings.NewReader(output)), nil
+}
+
+func (r *FakeRuntime) Exec(ctx context.Context, id string, cmd []string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Fail["Exec"]; err != nil {
+		return "", err
+	}
+
+	c := r.find(id)
+
+	if c == nil {
+		return "", ErrContainerNotFound
+	}
+
+	c.Commands = append(c.Commands, cmd)
+
+	return r.ExecOutput, nil
+}
+
+func (r *FakeRuntime) ReplaceEnv(ctx context.Context, id string, env []string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Fail["ReplaceEnv"]; err != nil {
+		return "", err
+	}
+
+	c := r.find(id)
+
+	if c == nil {
+		return "", ErrContainerNotFound
+	}
+
+	c.Spec.Env = mergeEnv(c.Spec.Env, env)
+
+	return c.ID, nil
+}
+
+func (r *FakeRuntime) setState(method string, id string, state string, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Fail[method]; err != nil {
+		return err
+	}
+
+	c := r.find(id)
+
+	if c == nil {
+		return ErrContainerNotFound
+	}
+
+	c.State = state
+	c.Status = status
+
+	return nil
+}
+
+// Docker accepts both ids and names everywhere, so does the fake
+func (r *FakeRuntime) find(idOrName string) *FakeContainer {
+
+	if c, ok := r.Containers[idOrName]; ok {
+		return c
+	}
+
+	for _, c := range r.Containers {
+		if c.Name == idOrName {
+			return c
+		}
+	}
+
+	return nil
+}
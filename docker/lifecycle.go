@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/logger"
+)
+
+func StartServer(server *db.Server) error {
+	return changeServerState(server, "start", func(ctx context.Context, id string) error {
+		return ContainerRuntime.StartContainer(ctx, id)
+	})
+}
+
+func StopServer(server *db.Server, timeout *time.Duration) error {
+	return changeServerState(server, "stop", func(ctx context.Context, id string) error {
+		return ContainerRuntime.StopContainer(ctx, id, timeout)
+	})
+}
+
+func RestartServer(server *db.Server, timeout *time.Duration) error {
+	return changeServerState(server, "restart", func(ctx context.Context, id string) error {
+		return ContainerRuntime.RestartContainer(ctx, id, timeout)
+	})
+}
+
+func KillServer(server *db.Server, signal string) error {
+	return changeServerState(server, "kill", func(ctx context.Context, id string) error {
+		return ContainerRuntime.KillContainer(ctx, id, signal)
+	})
+}
+
+func changeServerState(server *db.Server, action string, apply func(ctx context.Context, id string) error) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+	defer cancel()
+
+	container, err := ContainerRuntime.InspectContainer(ctx, server.ContainerName)
+
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Running " + action + " on container " + server.ContainerName)
+
+	err = apply(ctx, container.ID)
+
+	if err != nil {
+		return err
+	}
+
+	ForgetProbe(server.ID)
+
+	return RecordServerState(ctx, server)
+}
+
+func RecordServerState(ctx context.Context, server *db.Server) error {
+
+	container, err := ContainerRuntime.InspectContainer(ctx, server.ContainerName)
+
+	if err == ErrContainerNotFound {
+		server.State = "missing"
+	} else if err != nil {
+		return err
+	} else {
+		server.State = container.State
+	}
+
+	server.StateUpdatedAt = time.Now()
+
+	return db.OpenedConnection.Model(server).Updates(map[string]interface{}{
+		"state":            server.State,
+		"state_updated_at": server.StateUpdatedAt,
+	}).Error
+}
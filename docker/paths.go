@@ -0,0 +1,114 @@
+package docker
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidContainerName = errors.New("invalid container name, it must be a single path element of letters, digits, '_', '.' and '-'")
+var ErrMountOutsideDir = errors.New("mount sources must be inside DATA_DIR/mounts")
+
+// Docker's own rule for container names, which also keeps them a single path element
+var containerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// The container name ends up in host paths, so it's checked wherever a server row is written
+func ValidateContainerName(name string) error {
+
+	if !containerNamePattern.MatchString(name) || strings.Contains(name, "..") {
+		return ErrInvalidContainerName
+	}
+
+	return nil
+}
+
+func serversDir() string {
+	return path.Join(LOCAL_DATA_DIR, "servers")
+}
+
+// insideServersDir is true for directories strictly below DATA_DIR/servers
+func insideServersDir(dir string) bool {
+	return strings.HasPrefix(path.Clean(dir), serversDir()+"/")
+}
+
+// LocalServerDir is the server's data directory as the api sees it
+func LocalServerDir(containerName string) (string, error) {
+
+	err := ValidateContainerName(containerName)
+
+	if err != nil {
+		return "", err
+	}
+
+	dir := path.Join(serversDir(), containerName)
+
+	if !insideServersDir(dir) {
+		return "", ErrInvalidContainerName
+	}
+
+	return dir, nil
+}
+
+// ValidateMountSource only lets templates mount host directories below DATA_DIR/mounts,
+// anything else (/, the docker socket, other servers' data) would hand the container the host.
+// Symlinks are resolved through the api's view of the same directory, for sources that don't
+// exist yet through their deepest existing parent since docker creates the rest.
+func ValidateMountSource(source string) error {
+
+	if DATA_DIR == "" || !path.IsAbs(source) || strings.Contains(source, "..") {
+		return ErrMountOutsideDir
+	}
+
+	relative := strings.TrimPrefix(path.Clean(source), path.Join(DATA_DIR, "mounts")+"/")
+
+	if relative == path.Clean(source) {
+		return ErrMountOutsideDir
+	}
+
+	localMounts := filepath.Join(LOCAL_DATA_DIR, "mounts")
+
+	err := os.MkdirAll(localMounts, os.ModePerm)
+
+	if err != nil {
+		return err
+	}
+
+	realMounts, err := filepath.EvalSymlinks(localMounts)
+
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(localMounts, filepath.FromSlash(relative))
+	existing := target
+
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+
+		if err == nil {
+			if resolved == realMounts && existing != target {
+				return nil
+			}
+
+			if !strings.HasPrefix(resolved, realMounts+string(os.PathSeparator)) {
+				return ErrMountOutsideDir
+			}
+
+			return nil
+		}
+
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		// A dangling symlink would let docker create its target anywhere
+		if _, err := os.Lstat(existing); err == nil {
+			return ErrMountOutsideDir
+		}
+
+		existing = filepath.Dir(existing)
+	}
+}
@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateMountSource(t *testing.T) {
+
+	previousData, previousLocal := DATA_DIR, LOCAL_DATA_DIR
+	DATA_DIR, LOCAL_DATA_DIR = "/srv/lisek", t.TempDir()
+
+	t.Cleanup(func() {
+		DATA_DIR, LOCAL_DATA_DIR = previousData, previousLocal
+	})
+
+	mounts := filepath.Join(LOCAL_DATA_DIR, "mounts")
+	os.MkdirAll(filepath.Join(mounts, "maps"), os.ModePerm)
+	os.Symlink("/", filepath.Join(mounts, "root"))
+	os.Symlink("maps", filepath.Join(mounts, "inner"))
+	os.Symlink("/missing", filepath.Join(mounts, "dangling"))
+
+	tests := []struct {
+		source string
+		ok     bool
+	}{
+		{source: "/srv/lisek/mounts/maps", ok: true},
+		{source: "/srv/lisek/mounts/maps/new/dir", ok: true},
+		{source: "/srv/lisek/mounts/not-yet", ok: true},
+		{source: "/srv/lisek/mounts/inner", ok: true},
+		{source: "/srv/lisek/mounts"},
+		{source: "/srv/lisek/mounts/"},
+		{source: "/"},
+		{source: "/var/run/docker.sock"},
+		{source: "/srv/lisek/servers/other"},
+		{source: "/srv/lisek/mounts/../servers/other"},
+		{source: "/srv/lisek/mountsx"},
+		{source: "srv/lisek/mounts/maps"},
+		{source: "/srv/lisek/mounts/root"},
+		{source: "/srv/lisek/mounts/root/etc"},
+		{source: "/srv/lisek/mounts/dangling"},
+		{source: "/srv/lisek/mounts/dangling/dir"},
+	}
+
+	for _, test := range tests {
+		err := ValidateMountSource(test.source)
+
+		if (err == nil) != test.ok {
+			t.Errorf("ValidateMountSource(%q) = %v", test.source, err)
+		}
+	}
+
+	DATA_DIR = ""
+
+	if ValidateMountSource("/srv/lisek/mounts/maps") == nil {
+		t.Error("mounts allowed without DATA_DIR")
+	}
+}
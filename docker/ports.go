@@ -0,0 +1,123 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"gorm.io/gorm"
+)
+
+var ErrNoFreePorts = errors.New("no free ports left in the configured range")
+
+// Key of the postgres advisory lock serializing allocations between api replicas
+const PORT_ALLOCATION_LOCK = 25565
+
+var portMutex sync.Mutex
+
+func portRange() (int, int) {
+	start := config.LoadedConfiguration.Ports.Start
+	end := config.LoadedConfiguration.Ports.End
+
+	if start == 0 {
+		start = 25565
+	}
+
+	if end < start {
+		end = start + 100
+	}
+
+	return start, end
+}
+
+// AllocatePort leases the first host port in the configured range that is not reserved,
+// leased, used by a server row or published by any container on the host.
+// serverId may be 0 when the server row does not exist yet, see AssignPort.
+func AllocatePort(serverId uint) (int, error) {
+
+	portMutex.Lock()
+	defer portMutex.Unlock()
+
+	used := map[int]bool{}
+
+	for _, port := range config.LoadedConfiguration.Ports.Reserved {
+		used[port] = true
+	}
+
+	containers, err := ContainerRuntime.ListContainers(context.Background())
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, container := range containers {
+		for _, port := range container.Ports {
+			used[port] = true
+		}
+	}
+
+	start, end := portRange()
+	port := 0
+
+	err = db.OpenedConnection.Transaction(func(tx *gorm.DB) error {
+
+		if tx.Dialector.Name() == "postgres" {
+			err := tx.Exec("SELECT pg_advisory_xact_lock(?)", PORT_ALLOCATION_LOCK).Error
+
+			if err != nil {
+				return err
+			}
+		}
+
+		leased := []int{}
+		err := tx.Model(&db.PortLease{}).Pluck("port", &leased).Error
+
+		if err != nil {
+			return err
+		}
+
+		serverPorts := []int{}
+		err = tx.Model(&db.Server{}).Pluck("port", &serverPorts).Error
+
+		if err != nil {
+			return err
+		}
+
+		for _, p := range append(leased, serverPorts...) {
+			used[p] = true
+		}
+
+		for p := start; p <= end; p++ {
+			if !used[p] {
+				port = p
+				break
+			}
+		}
+
+		if port == 0 {
+			return ErrNoFreePorts
+		}
+
+		return tx.Create(&db.PortLease{Port: port, ServerID: serverId}).Error
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return port, nil
+}
+
+func AssignPort(port int, serverId uint) error {
+	return db.OpenedConnection.Model(&db.PortLease{}).Where("port = ?", port).Update("server_id", serverId).Error
+}
+
+func ReleasePort(port int) error {
+	return db.OpenedConnection.Delete(&db.PortLease{}, "port = ?", port).Error
+}
+
+func ReleaseServerPorts(serverId uint) error {
+	return db.OpenedConnection.Delete(&db.PortLease{}, "server_id = ?", serverId).Error
+}
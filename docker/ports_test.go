@@ -0,0 +1,173 @@
+package docker
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/db/dbtest"
+)
+
+// setupPorts gives the allocator an empty database, a fake runtime and the port range
+func setupPorts(t *testing.T, start int, end int, reserved ...int) *FakeRuntime {
+
+	dbtest.Open(t, &db.Server{}, &db.PortLease{})
+
+	runtime := NewFakeRuntime()
+	previousRuntime, previousPorts := ContainerRuntime, config.LoadedConfiguration.Ports
+
+	ContainerRuntime = runtime
+	config.LoadedConfiguration.Ports.Start = start
+	config.LoadedConfiguration.Ports.End = end
+	config.LoadedConfiguration.Ports.Reserved = reserved
+
+	t.Cleanup(func() {
+		ContainerRuntime, config.LoadedConfiguration.Ports = previousRuntime, previousPorts
+	})
+
+	return runtime
+}
+
+func TestPortRange(t *testing.T) {
+
+	tests := []struct {
+		start, end                 int
+		expectedStart, expectedEnd int
+	}{
+		{30000, 30010, 30000, 30010},
+		{30000, 30000, 30000, 30000},
+		{0, 0, 25565, 25665},
+		{30000, 0, 30000, 30100},
+		{30000, 29000, 30000, 30100},
+	}
+
+	previousPorts := config.LoadedConfiguration.Ports
+	t.Cleanup(func() { config.LoadedConfiguration.Ports = previousPorts })
+
+	for _, test := range tests {
+		config.LoadedConfiguration.Ports.Start = test.start
+		config.LoadedConfiguration.Ports.End = test.end
+
+		start, end := portRange()
+
+		if start != test.expectedStart || end != test.expectedEnd {
+			t.Errorf("range %d-%d resolved to %d-%d, want %d-%d", test.start, test.end, start, end, test.expectedStart, test.expectedEnd)
+		}
+	}
+}
+
+func TestAllocatePort(t *testing.T) {
+
+	runtime := setupPorts(t, 30000, 30004, 30000)
+
+	// Every way a port can be taken, only 30004 is left
+	runtime.CreateContainer(context.Background(), ContainerSpec{Name: "foreign", Ports: map[string]string{"25565/tcp": "30001"}})
+	db.OpenedConnection.Create(&db.Server{ID: 1, Name: "lobby", ContainerName: "lobby", Port: 30002})
+	db.OpenedConnection.Create(&db.PortLease{Port: 30003, ServerID: 2})
+
+	port, err := AllocatePort(3)
+
+	if err != nil || port != 30004 {
+		t.Fatalf("allocated %d (%v), want 30004", port, err)
+	}
+
+	_, err = AllocatePort(4)
+
+	if err != ErrNoFreePorts {
+		t.Fatalf("expected ErrNoFreePorts from a full range, got %v", err)
+	}
+
+	err = ReleasePort(30003)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err = AllocatePort(4)
+
+	if err != nil || port != 30003 {
+		t.Fatalf("allocated %d (%v) after releasing 30003", port, err)
+	}
+
+	if n := count(t, &db.PortLease{}, "port = ? AND server_id = ?", 30003, 4); n != 1 {
+		t.Errorf("%d leases of 30003 for server 4", n)
+	}
+}
+
+func TestAssignPort(t *testing.T) {
+
+	setupPorts(t, 30000, 30001)
+
+	// Preloaded servers lease their port before their row exists
+	port, err := AllocatePort(0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = AssignPort(port, 7)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, &db.PortLease{}, "port = ? AND server_id = ?", port, 7); n != 1 {
+		t.Fatalf("%d leases of %d for server 7", n, port)
+	}
+
+	other, _ := AllocatePort(8)
+
+	err = ReleaseServerPorts(7)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, &db.PortLease{}, "1 = 1"); n != 1 || count(t, &db.PortLease{}, "port = ?", other) != 1 {
+		t.Errorf("%d leases left, want only server 8's", n)
+	}
+}
+
+func TestAllocatePortConcurrently(t *testing.T) {
+
+	setupPorts(t, 30000, 30019)
+
+	ports := make(chan int, 20)
+	var wg sync.WaitGroup
+
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+
+		go func(serverId uint) {
+			defer wg.Done()
+
+			port, err := AllocatePort(serverId)
+
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			ports <- port
+		}(uint(i))
+	}
+
+	wg.Wait()
+	close(ports)
+
+	seen := map[int]bool{}
+
+	for port := range ports {
+		if seen[port] {
+			t.Errorf("port %d allocated twice", port)
+		}
+
+		seen[port] = true
+	}
+
+	if len(seen) != 20 {
+		t.Errorf("%d distinct ports allocated, want 20", len(seen))
+	}
+}
@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/mcping"
+)
+
+const PROBE_TIMEOUT = 3 * time.Second
+const PROBE_CACHE_TTL = 10 * time.Second
+
+type ProbeResult struct {
+	Status   *mcping.Status
+	Error    error
+	ProbedAt time.Time
+}
+
+var probeCache = map[uint]ProbeResult{}
+var probeMutex sync.Mutex
+
+// Game port inside the container, reachable by container name on the shared network
+func GameAddress(server db.Server) string {
+	return net.JoinHostPort(server.ContainerName, "25565")
+}
+
+// ProbeServer pings the server, results (failures included) are cached for PROBE_CACHE_TTL
+func ProbeServer(server db.Server) ProbeResult {
+
+	probeMutex.Lock()
+	cached, ok := probeCache[server.ID]
+	probeMutex.Unlock()
+
+	if ok && time.Since(cached.ProbedAt) < PROBE_CACHE_TTL {
+		return cached
+	}
+
+	status, err := mcping.Probe(GameAddress(server), PROBE_TIMEOUT)
+
+	result := ProbeResult{
+		Status:   status,
+		Error:    err,
+		ProbedAt: time.Now(),
+	}
+
+	probeMutex.Lock()
+	probeCache[server.ID] = result
+	probeMutex.Unlock()
+
+	return result
+}
+
+func ForgetProbe(serverId uint) {
+	probeMutex.Lock()
+	delete(probeCache, serverId)
+	probeMutex.Unlock()
+}
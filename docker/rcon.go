@@ -0,0 +1,37 @@
+package docker
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/rcon"
+)
+
+var ErrNoRconCredentials = errors.New("server has no rcon credentials, recreate it to enable rcon")
+
+const RCON_TIMEOUT = time.Second * 10
+
+// Containers are reachable by name on the shared network
+func RconAddress(server db.Server) string {
+	return net.JoinHostPort(server.ContainerName, strconv.Itoa(rcon.DEFAULT_PORT))
+}
+
+func RconCommand(server db.Server, command string) (string, error) {
+
+	if server.RconPassword == "" {
+		return "", ErrNoRconCredentials
+	}
+
+	client, err := rcon.Dial(RconAddress(server), server.RconPassword, RCON_TIMEOUT)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer client.Close()
+
+	return client.Command(command)
+}
@@ -0,0 +1,138 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/archive"
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/logger"
+)
+
+const (
+	DATA_KEEP    = "keep"
+	DATA_ARCHIVE = "archive"
+	DATA_PURGE   = "purge"
+)
+
+func IsValidDataMode(mode string) bool {
+	return mode == DATA_KEEP || mode == DATA_ARCHIVE || mode == DATA_PURGE
+}
+
+// RemoveServer stops and removes the server container and then keeps, archives or purges its data directory
+func RemoveServer(server db.Server, dataMode string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+	defer cancel()
+
+	container, err := ContainerRuntime.InspectContainer(ctx, server.ContainerName)
+
+	if err != nil && err != ErrContainerNotFound {
+		return err
+	}
+
+	if err == nil {
+		logger.Info("Removing container " + container.ID + " of server " + server.Name)
+
+		if container.State == "running" {
+			err = ContainerRuntime.StopContainer(ctx, container.ID, nil)
+
+			if err != nil {
+				logger.Warning("Error stopping container, removing it anyway: " + err.Error())
+			}
+		}
+
+		err = ContainerRuntime.RemoveContainer(ctx, container.ID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ReleaseServerPorts(server.ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = db.OpenedConnection.Where("server_id = ?", server.ID).Delete(&db.ScheduledTask{}).Error
+
+	if err != nil {
+		return err
+	}
+
+	// The container's credentials must not outlive it, a later server could get the same id
+	err = db.OpenedConnection.Model(&db.ApiKey{}).Where("server_id = ?", server.ID).Update("revoked", true).Error
+
+	if err != nil {
+		return err
+	}
+
+	err = db.OpenedConnection.Where("server_id = ?", server.ID).Delete(&db.SigningKey{}).Error
+
+	if err != nil {
+		return err
+	}
+
+	if dataMode == DATA_KEEP {
+		return publishRemoved(server, dataMode)
+	}
+
+	dataDir, err := LocalServerDir(server.ContainerName)
+
+	if err != nil {
+		return err
+	}
+
+	// RemoveAll below must never get anything but a single server's directory
+	if !insideServersDir(dataDir) {
+		return ErrInvalidContainerName
+	}
+
+	switch dataMode {
+	case DATA_ARCHIVE:
+		archivePath := path.Join(LOCAL_DATA_DIR, "archives", server.ContainerName+"-"+strconv.Itoa(int(time.Now().Unix()))+".tar.zst")
+
+		err = archive.WriteFile(dataDir, archivePath)
+
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Server data archived to " + archivePath)
+
+		err = os.RemoveAll(dataDir)
+	case DATA_PURGE:
+		err = os.RemoveAll(dataDir)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return publishRemoved(server, dataMode)
+}
+
+func publishRemoved(server db.Server, dataMode string) error {
+
+	removedServerRequest := channels.ServerRemovedRequest{
+		ServerId: int(server.ID),
+		Data:     dataMode,
+	}
+
+	removedServerRequestJson, err := json.Marshal(removedServerRequest)
+
+	if err != nil {
+		logger.Error("Error marshalling server removed request: " + err.Error())
+		return nil
+	}
+
+	channels.PublishEvent("servers:removed", removedServerRequestJson)
+
+	return nil
+}
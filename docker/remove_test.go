@@ -0,0 +1,58 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/db/dbtest"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+)
+
+func TestRemoveServerRevokesCredentials(t *testing.T) {
+
+	dbtest.Open(t, &db.Server{}, &db.PortLease{}, &db.ApiKey{}, &db.SigningKey{}, &db.ScheduledTask{})
+
+	previousRuntime, previousRedis := ContainerRuntime, channels.RedisConnection
+
+	ContainerRuntime = NewFakeRuntime()
+	channels.RedisConnection = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+
+	t.Cleanup(func() {
+		channels.RedisConnection.Close()
+		ContainerRuntime, channels.RedisConnection = previousRuntime, previousRedis
+	})
+
+	removed := db.Server{ID: 1, Name: "Lobby", ContainerName: "lobby"}
+	other := db.Server{ID: 2, Name: "Survival", ContainerName: "survival"}
+	db.OpenedConnection.Create(&removed)
+	db.OpenedConnection.Create(&other)
+
+	for _, server := range []db.Server{removed, other} {
+		db.OpenedConnection.Create(&db.ApiKey{Name: server.Name, Hash: server.ContainerName, ServerID: server.ID})
+		db.OpenedConnection.Create(&db.SigningKey{KeyID: server.ContainerName, ServerID: server.ID, Secret: "secret"})
+	}
+
+	err := RemoveServer(removed, DATA_KEEP)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, &db.ApiKey{}, "server_id = ? AND revoked = ?", removed.ID, false); n != 0 {
+		t.Errorf("%d api keys of the removed server still valid", n)
+	}
+
+	if n := count(t, &db.SigningKey{}, "server_id = ?", removed.ID); n != 0 {
+		t.Errorf("%d signing keys of the removed server left", n)
+	}
+
+	if n := count(t, &db.ApiKey{}, "server_id = ? AND revoked = ?", other.ID, false); n != 1 {
+		t.Errorf("%d valid api keys of the other server, expected 1", n)
+	}
+
+	if n := count(t, &db.SigningKey{}, "server_id = ?", other.ID); n != 1 {
+		t.Errorf("%d signing keys of the other server, expected 1", n)
+	}
+}
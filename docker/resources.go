@@ -0,0 +1,137 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+)
+
+// Headroom on top of the java heap for metaspace, threads and native buffers
+const MEMORY_OVERHEAD_PERCENT = 25
+const MIN_MEMORY_OVERHEAD = 512 * 1024 * 1024
+
+var ErrLimitRemoval = errors.New("memory and cpu limits can't be removed from an existing container")
+
+// ParseMemory parses MAX_MEMORY style values (1024M, 2G, 512k or plain bytes)
+func ParseMemory(value string) (int64, error) {
+
+	value = strings.TrimSpace(strings.ToUpper(value))
+
+	if value == "" {
+		return 0, errors.New("empty memory value")
+	}
+
+	multiplier := int64(1)
+
+	switch value[len(value)-1] {
+	case 'K':
+		multiplier = 1024
+	case 'M':
+		multiplier = 1024 * 1024
+	case 'G':
+		multiplier = 1024 * 1024 * 1024
+	}
+
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	amount, err := strconv.ParseInt(value, 10, 64)
+
+	if err != nil || amount <= 0 {
+		return 0, errors.New("invalid memory value")
+	}
+
+	return amount * multiplier, nil
+}
+
+// BuildResources turns limits into container resources. Without an explicit memory limit
+// the hard limit is MAX_MEMORY plus overhead, so the JVM hits its own heap limit first.
+func BuildResources(limits db.ResourceLimits, maxMemory string) Resources {
+
+	resources := Resources{
+		CpuShares:   limits.CpuShares,
+		NanoCpus:    int64(limits.Cpus * 1e9),
+		PidsLimit:   limits.PidsLimit,
+		StorageSize: limits.StorageSize,
+	}
+
+	if limits.MemoryMB != 0 {
+		resources.Memory = limits.MemoryMB * 1024 * 1024
+	} else if heap, err := ParseMemory(maxMemory); err == nil {
+		overhead := heap * MEMORY_OVERHEAD_PERCENT / 100
+
+		if overhead < MIN_MEMORY_OVERHEAD {
+			overhead = MIN_MEMORY_OVERHEAD
+		}
+
+		resources.Memory = heap + overhead
+	}
+
+	return resources
+}
+
+func ValidateLimits(limits db.ResourceLimits) error {
+
+	if limits.CpuShares < 0 || limits.Cpus < 0 || limits.MemoryMB < 0 || limits.PidsLimit < 0 {
+		return errors.New("limits can't be negative")
+	}
+
+	// Docker refuses anything below 6MB
+	if limits.MemoryMB != 0 && limits.MemoryMB < 6 {
+		return errors.New("memory limit must be at least 6MB")
+	}
+
+	if limits.StorageSize != "" {
+		if _, err := ParseMemory(limits.StorageSize); err != nil {
+			return errors.New("invalid storage size")
+		}
+	}
+
+	return nil
+}
+
+// ServerResources resolves the effective resources of a server
+func ServerResources(server db.Server) (Resources, error) {
+
+	// Preloaded servers take MAX_MEMORY from their info.json instead of a template
+	preloadedServer, err := readPreloadedServer(server.ContainerName)
+
+	if err == nil {
+		return BuildResources(server.Limits, preloadedServer.Env["MAX_MEMORY"]), nil
+	}
+
+	template, err := ResolveTemplate(server)
+
+	if err != nil {
+		return Resources{}, err
+	}
+
+	return BuildResources(template.Limits.Merge(server.Limits), template.Memory), nil
+}
+
+// liftsLimits is true when next drops a memory or cpu limit previous had. Docker update
+// treats 0 as unchanged and refuses -1 for both, only a new container gets rid of them.
+func liftsLimits(previous Resources, next Resources) bool {
+	return (previous.Memory != 0 && next.Memory == 0) || (previous.NanoCpus != 0 && next.NanoCpus == 0)
+}
+
+// ApplyServerResources pushes the server's current limits to its running container,
+// previous are the resources the container was last given
+func ApplyServerResources(ctx context.Context, server db.Server, previous Resources, resources Resources) error {
+
+	container, err := ContainerRuntime.InspectContainer(ctx, server.ContainerName)
+
+	if err != nil {
+		return err
+	}
+
+	if liftsLimits(previous, resources) {
+		return ErrLimitRemoval
+	}
+
+	return ContainerRuntime.UpdateResources(ctx, container.ID, resources)
+}
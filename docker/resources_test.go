@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+)
+
+func TestApplyServerResources(t *testing.T) {
+
+	limited := Resources{CpuShares: 512, NanoCpus: 2e9, Memory: 2 << 30, PidsLimit: 100}
+
+	tests := []struct {
+		name     string
+		next     Resources
+		expected error
+	}{
+		{"lower limits", Resources{CpuShares: 256, NanoCpus: 1e9, Memory: 1 << 30, PidsLimit: 50}, nil},
+		{"lift shares and pids", Resources{NanoCpus: 2e9, Memory: 2 << 30}, nil},
+		{"lift memory", Resources{CpuShares: 512, NanoCpus: 2e9, PidsLimit: 100}, ErrLimitRemoval},
+		{"lift cpus", Resources{CpuShares: 512, Memory: 2 << 30, PidsLimit: 100}, ErrLimitRemoval},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			runtime := NewFakeRuntime()
+			previousRuntime := ContainerRuntime
+			ContainerRuntime = runtime
+			t.Cleanup(func() { ContainerRuntime = previousRuntime })
+
+			id, _ := runtime.CreateContainer(context.Background(), ContainerSpec{Name: "lobby", Resources: limited})
+
+			err := ApplyServerResources(context.Background(), db.Server{ContainerName: "lobby"}, limited, test.next)
+
+			if err != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, err)
+			}
+
+			applied := runtime.find(id).Spec.Resources
+
+			if test.expected == nil && applied != test.next {
+				t.Errorf("container has %+v, want %+v", applied, test.next)
+			}
+
+			if test.expected != nil && applied != limited {
+				t.Errorf("rejected update changed the container to %+v", applied)
+			}
+		})
+	}
+}
+
+func TestDockerUpdateResources(t *testing.T) {
+
+	lifted := dockerUpdateResources(Resources{Memory: 1 << 30})
+
+	if lifted.CPUShares != DEFAULT_CPU_SHARES || lifted.PidsLimit == nil || *lifted.PidsLimit != -1 {
+		t.Errorf("lifted shares and pids are sent as %d and %v", lifted.CPUShares, lifted.PidsLimit)
+	}
+
+	if lifted.Memory != 1<<30 || lifted.MemorySwap != 1<<30 {
+		t.Errorf("memory %d and swap %d, want both 1G", lifted.Memory, lifted.MemorySwap)
+	}
+
+	limited := dockerUpdateResources(Resources{CpuShares: 256, PidsLimit: 50})
+
+	if limited.CPUShares != 256 || limited.PidsLimit == nil || *limited.PidsLimit != 50 {
+		t.Errorf("limits are sent as %d and %v", limited.CPUShares, limited.PidsLimit)
+	}
+}
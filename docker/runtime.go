@@ -0,0 +1,98 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrContainerNotFound = errors.New("container not found")
+
+type Mount struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+type Resources struct {
+	CpuShares int64
+	NanoCpus  int64
+	// Bytes, swap is limited to the same value
+	Memory    int64
+	PidsLimit int64
+	// Passed as the "size" storage option, only supported by some storage drivers
+	StorageSize string
+}
+
+type LogOptions struct {
+	Follow bool
+	// Number of lines from the end, "all" or empty for everything
+	Tail       string
+	Timestamps bool
+}
+
+type ContainerSpec struct {
+	Name   string
+	Image  string
+	Env    []string
+	Mounts []Mount
+	// Container port (e.g. "25565/tcp") -> host port
+	Ports     map[string]string
+	Resources Resources
+}
+
+type Container struct {
+	ID     string
+	Name   string
+	Image  string
+	State  string
+	Status string
+	// Published host ports
+	Ports []int
+}
+
+// Runtime is everything the api needs from a container engine.
+// DockerRuntime talks to a real daemon, FakeRuntime keeps everything in memory.
+type Runtime interface {
+	PullImage(ctx context.Context, image string) error
+	CreateContainer(ctx context.Context, spec ContainerSpec) (string, error)
+	StartContainer(ctx context.Context, id string) error
+	StopContainer(ctx context.Context, id string, timeout *time.Duration) error
+	RestartContainer(ctx context.Context, id string, timeout *time.Duration) error
+	KillContainer(ctx context.Context, id string, signal string) error
+	RemoveContainer(ctx context.Context, id string) error
+	ListContainers(ctx context.Context) ([]Container, error)
+	InspectContainer(ctx context.Context, name string) (Container, error)
+	ConnectNetwork(ctx context.Context, network string, id string) error
+	// Storage size can't be changed on a live container and is ignored
+	UpdateResources(ctx context.Context, id string, resources Resources) error
+	// Logs returns stdout and stderr merged into one plain text stream
+	Logs(ctx context.Context, id string, options LogOptions) (io.ReadCloser, error)
+	Exec(ctx context.Context, id string, cmd []string) (string, error)
+	// ReplaceEnv recreates the container with the same configuration and the given
+	// KEY=value variables replaced, it's started again if it was running. Returns the new id.
+	ReplaceEnv(ctx context.Context, id string, env []string) (string, error)
+}
+
+var ContainerRuntime Runtime
+
+// mergeEnv replaces the variables of current that overrides sets and appends the new ones
+func mergeEnv(current []string, overrides []string) []string {
+
+	merged := []string{}
+	replaced := map[string]bool{}
+
+	for _, variable := range overrides {
+		replaced[strings.SplitN(variable, "=", 2)[0]] = true
+	}
+
+	for _, variable := range current {
+		if !replaced[strings.SplitN(variable, "=", 2)[0]] {
+			merged = append(merged, variable)
+		}
+	}
+
+	return append(merged, overrides...)
+}
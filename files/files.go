@@ -0,0 +1,421 @@
+package files
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/docker"
+)
+
+const (
+	// Files read or written as text through the api
+	MAX_EDIT_SIZE   = 4 << 20
+	MAX_UPLOAD_SIZE = 512 << 20
+)
+
+var ErrInvalidPath = errors.New("invalid path")
+var ErrOutsideRoot = errors.New("path is outside of the server directory")
+var ErrRootPath = errors.New("the server directory itself can't be changed")
+var ErrTooLarge = errors.New("file is too large")
+var ErrNotFound = errors.New("file not found")
+var ErrIsDirectory = errors.New("path is a directory")
+var ErrExists = errors.New("target already exists")
+var ErrDanglingLink = errors.New("path goes through a broken symlink")
+
+type Entry struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Directory bool      `json:"directory"`
+	Size      int64     `json:"size"`
+	Mode      string    `json:"mode"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Root is what a server's file paths are relative to
+func Root(server db.Server) (string, error) {
+	return docker.LocalServerDir(server.ContainerName)
+}
+
+// Resolve maps a path relative to root onto the filesystem. ".." is refused outright and
+// every existing component is checked with Lstat, a symlink is followed only when its
+// target stays inside root. Paths that don't exist yet are resolved through their deepest
+// existing parent, dangling symlinks are refused since writing through them could create
+// the file anywhere.
+func Resolve(root string, relative string) (string, error) {
+
+	err := checkRelative(relative)
+
+	if err != nil {
+		return "", err
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	target := realRoot
+	parts := strings.Split(filepath.ToSlash(relative), "/")
+
+	for i, part := range parts {
+		if part == "" || part == "." {
+			continue
+		}
+
+		next := filepath.Join(target, part)
+		info, err := os.Lstat(next)
+
+		// Nothing below a missing component can exist either
+		if os.IsNotExist(err) {
+			return filepath.Join(next, filepath.FromSlash(path.Join(parts[i+1:]...))), nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			next, err = filepath.EvalSymlinks(next)
+
+			if os.IsNotExist(err) {
+				return "", ErrDanglingLink
+			}
+
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if !isInside(realRoot, next) {
+			return "", ErrOutsideRoot
+		}
+
+		target = next
+	}
+
+	return target, nil
+}
+
+func isInside(root string, target string) bool {
+	return target == root || strings.HasPrefix(target, root+string(os.PathSeparator))
+}
+
+func checkRelative(relative string) error {
+
+	if strings.ContainsRune(relative, 0) {
+		return ErrInvalidPath
+	}
+
+	for _, part := range strings.Split(filepath.ToSlash(relative), "/") {
+		if part == ".." {
+			return ErrInvalidPath
+		}
+	}
+
+	return nil
+}
+
+func relativePath(root string, target string) string {
+
+	realRoot, err := filepath.EvalSymlinks(root)
+
+	if err != nil {
+		realRoot = root
+	}
+
+	relative, err := filepath.Rel(realRoot, target)
+
+	if err != nil || relative == "." {
+		return "/"
+	}
+
+	return "/" + filepath.ToSlash(relative)
+}
+
+func resolveExisting(root string, relative string) (string, os.FileInfo, error) {
+
+	target, err := Resolve(root, relative)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	info, err := os.Stat(target)
+
+	if os.IsNotExist(err) {
+		return "", nil, ErrNotFound
+	}
+
+	return target, info, err
+}
+
+// resolveChangeable resolves the parent only, so deleting or renaming a symlink acts on
+// the link and not on what it points to. Changes to the root itself are refused.
+func resolveChangeable(root string, relative string) (string, error) {
+
+	err := checkRelative(relative)
+
+	if err != nil {
+		return "", err
+	}
+
+	cleaned := path.Clean("/" + filepath.ToSlash(relative))
+
+	if cleaned == "/" {
+		return "", ErrRootPath
+	}
+
+	parent, err := Resolve(root, path.Dir(cleaned))
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(parent, path.Base(cleaned)), nil
+}
+
+// mkdirAll creates dir and then resolves relative once more, so a component swapped for
+// a symlink while the directories were created can't redirect what comes next
+func mkdirAll(dir string, root string, relative string, target string) error {
+
+	err := os.MkdirAll(dir, os.ModePerm)
+
+	if err != nil {
+		return err
+	}
+
+	again, err := resolveChangeable(root, relative)
+
+	if err != nil {
+		return err
+	}
+
+	if again != target {
+		return ErrOutsideRoot
+	}
+
+	return nil
+}
+
+func List(root string, relative string) ([]Entry, error) {
+
+	target, info, err := resolveExisting(root, relative)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, ErrInvalidPath
+	}
+
+	dirEntries, err := os.ReadDir(target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+
+	for _, dirEntry := range dirEntries {
+		info, err := dirEntry.Info()
+
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, Entry{
+			Name:      dirEntry.Name(),
+			Path:      relativePath(root, filepath.Join(target, dirEntry.Name())),
+			Directory: info.IsDir(),
+			Size:      info.Size(),
+			Mode:      info.Mode().String(),
+			UpdatedAt: info.ModTime(),
+		})
+	}
+
+	// Directories first, like every file manager
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Directory && !entries[j].Directory
+	})
+
+	return entries, nil
+}
+
+// Open returns the file for downloads
+func Open(root string, relative string) (*os.File, os.FileInfo, error) {
+
+	target, info, err := resolveExisting(root, relative)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if info.IsDir() {
+		return nil, nil, ErrIsDirectory
+	}
+
+	file, err := os.Open(target)
+
+	return file, info, err
+}
+
+func Read(root string, relative string) ([]byte, error) {
+
+	file, info, err := Open(root, relative)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	if info.Size() > MAX_EDIT_SIZE {
+		return nil, ErrTooLarge
+	}
+
+	return io.ReadAll(io.LimitReader(file, MAX_EDIT_SIZE))
+}
+
+// Write replaces the file with data through a temporary file, so the server never
+// reads a half written file. Missing parent directories are created. Returns the size.
+func Write(root string, relative string, data io.Reader, limit int64) (int64, error) {
+
+	target, err := resolveChangeable(root, relative)
+
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Lstat(target)
+
+	if err == nil && info.IsDir() {
+		return 0, ErrIsDirectory
+	}
+
+	mode := os.FileMode(0644)
+
+	if err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	err = mkdirAll(filepath.Dir(target), root, relative, target)
+
+	if err != nil {
+		return 0, err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer os.Remove(temp.Name())
+
+	// One byte over the limit tells a too large body apart from one of exactly limit bytes
+	size, err := io.Copy(temp, io.LimitReader(data, limit+1))
+
+	if err == nil && size > limit {
+		err = ErrTooLarge
+	}
+
+	if err != nil {
+		temp.Close()
+		return 0, err
+	}
+
+	err = temp.Close()
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.Chmod(temp.Name(), mode)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return size, os.Rename(temp.Name(), target)
+}
+
+func Mkdir(root string, relative string) error {
+
+	target, err := resolveChangeable(root, relative)
+
+	if err != nil {
+		return err
+	}
+
+	return mkdirAll(target, root, relative, target)
+}
+
+func Rename(root string, from string, to string) error {
+
+	source, err := resolveChangeable(root, from)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Lstat(source)
+
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	target, err := resolveChangeable(root, to)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Lstat(target)
+
+	if err == nil {
+		return ErrExists
+	}
+
+	err = mkdirAll(filepath.Dir(target), root, to, target)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(source, target)
+}
+
+// Delete refuses non empty directories unless recursive is set
+func Delete(root string, relative string, recursive bool) error {
+
+	target, err := resolveChangeable(root, relative)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Lstat(target)
+
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	if recursive {
+		return os.RemoveAll(target)
+	}
+
+	return os.Remove(target)
+}
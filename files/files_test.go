@@ -0,0 +1,96 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupRoot(t *testing.T) (string, string) {
+
+	base := t.TempDir()
+	root := filepath.Join(base, "server")
+	outside := filepath.Join(base, "outside")
+
+	for _, dir := range []string{filepath.Join(root, "world"), outside} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"inner":    filepath.Join(root, "world"),
+		"escape":   outside,
+		"dangling": filepath.Join(outside, "missing"),
+	}
+
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root, outside
+}
+
+func TestResolve(t *testing.T) {
+
+	root, _ := setupRoot(t)
+	realRoot, _ := filepath.EvalSymlinks(root)
+
+	tests := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{path: "/", want: realRoot},
+		{path: "world/level.dat", want: filepath.Join(realRoot, "world", "level.dat")},
+		{path: "new/dir/file", want: filepath.Join(realRoot, "new", "dir", "file")},
+		{path: "inner/region", want: filepath.Join(realRoot, "world", "region")},
+		{path: "../outside", err: ErrInvalidPath},
+		{path: "escape/file", err: ErrOutsideRoot},
+		{path: "dangling", err: ErrDanglingLink},
+		{path: "dangling/file", err: ErrDanglingLink},
+	}
+
+	for _, test := range tests {
+		got, err := Resolve(root, test.path)
+
+		if err != test.err {
+			t.Errorf("Resolve(%q) error = %v, want %v", test.path, err, test.err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("Resolve(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestWriteThroughDanglingLink(t *testing.T) {
+
+	root, outside := setupRoot(t)
+
+	for _, target := range []string{"dangling/server.jar", "escape/server.jar"} {
+		_, err := Write(root, target, strings.NewReader("data"), MAX_EDIT_SIZE)
+
+		if err == nil {
+			t.Errorf("Write(%q) succeeded", target)
+		}
+
+		if err := Mkdir(root, target); err == nil {
+			t.Errorf("Mkdir(%q) succeeded", target)
+		}
+	}
+
+	entries, err := os.ReadDir(outside)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("%d entries were created outside of the root", len(entries))
+	}
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/Lisek-World-Reborn/lisek-api/auth"
+	"github.com/Lisek-World-Reborn/lisek-api/backups"
 	"github.com/Lisek-World-Reborn/lisek-api/channels"
 	"github.com/Lisek-World-Reborn/lisek-api/config"
 	"github.com/Lisek-World-Reborn/lisek-api/db"
 	"github.com/Lisek-World-Reborn/lisek-api/docker"
 	"github.com/Lisek-World-Reborn/lisek-api/logger"
+	"github.com/Lisek-World-Reborn/lisek-api/plugins"
 	"github.com/Lisek-World-Reborn/lisek-api/routes"
+	"github.com/Lisek-World-Reborn/lisek-api/scheduler"
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -49,7 +59,37 @@ func main() {
 	db.OpenedConnection = database
 
 	db.OpenedConnection.AutoMigrate(&db.Server{})
-	db.OpenedConnection.Table("users").AutoMigrate(&db.User{})
+
+	err = db.MigrateUsers()
+
+	if err != nil {
+		logger.Error("Error migrating users: " + err.Error())
+	}
+
+	db.OpenedConnection.AutoMigrate(&db.Job{})
+	db.OpenedConnection.AutoMigrate(&db.PortLease{})
+	db.OpenedConnection.AutoMigrate(&db.ServerTemplate{})
+	db.OpenedConnection.AutoMigrate(&db.SigningKey{})
+	db.OpenedConnection.AutoMigrate(&db.Heartbeat{})
+	db.OpenedConnection.AutoMigrate(&db.ApiKey{})
+	db.OpenedConnection.AutoMigrate(&db.PlayerSession{})
+	db.OpenedConnection.AutoMigrate(&db.Backup{})
+	db.OpenedConnection.AutoMigrate(&db.ScheduledTask{})
+	db.OpenedConnection.AutoMigrate(&db.TaskRun{})
+	db.OpenedConnection.AutoMigrate(&db.FileChange{})
+	db.OpenedConnection.AutoMigrate(&db.InstalledPlugin{})
+
+	err = db.FailInterruptedJobs()
+
+	if err != nil {
+		logger.Error("Error failing interrupted jobs: " + err.Error())
+	}
+
+	err = db.FailInterruptedBackups()
+
+	if err != nil {
+		logger.Error("Error failing interrupted backups: " + err.Error())
+	}
 
 	logger.Info("Database connection opened")
 
@@ -59,30 +99,187 @@ func main() {
 
 	logger.Info("Redis connection established.")
 
-	//	go channels.StartAcceptingRequests()
+	channels.RequestDispatcher.Workers = cfg.DispatcherWorkers
+
+	err = channels.StartAcceptingRequests()
+
+	if err != nil {
+		logger.Fatal("Error starting request dispatcher: " + err.Error())
+		return
+	}
+
+	monitorCtx, stopMonitors := context.WithCancel(context.Background())
+	defer stopMonitors()
+
+	go channels.StartStreamMonitor(monitorCtx, 30*time.Second)
+
+	err = channels.StartHeartbeatListener(monitorCtx)
+
+	if err != nil {
+		logger.Fatal("Error starting heartbeat listener: " + err.Error())
+		return
+	}
+
+	go channels.StartHeartbeatMonitor(monitorCtx, 10*time.Second)
 
 	docker.Init()
 
+	err = backups.Init()
+
+	if err != nil {
+		logger.Fatal("Error initializing backup storage: " + err.Error())
+		return
+	}
+
+	err = plugins.Init()
+
+	if err != nil {
+		logger.Fatal("Error initializing plugin catalogs: " + err.Error())
+		return
+	}
+
+	go backups.StartRetentionMonitor(monitorCtx, time.Hour)
+	go scheduler.Start(monitorCtx, 5*time.Second)
+
 	logger.Info("Preloading servers")
 
 	docker.PreloadServers()
 
+	docker.ReissueServerCredentials()
+
 	logger.Info("Starting http server")
 	r := gin.Default()
 
-	r.GET("/", routes.Index)
-	r.GET("/load", routes.GetSystemLoad)
-	r.GET("/servers/:id", routes.GetServer)
-	r.POST("/servers", routes.CreateServer)
-	r.PUT("/servers/:id", routes.UpdateServer)
+	public := routes.AllowPublic(auth.SCOPE_SERVERS_READ)
+	read := routes.RequireScope(auth.SCOPE_SERVERS_READ)
+	write := routes.RequireScope(auth.SCOPE_SERVERS_WRITE)
+	console := routes.RequireScope(auth.SCOPE_CONSOLE)
+	admin := routes.RequireScope(auth.SCOPE_ADMIN)
+	playersRead := routes.RequireScope(auth.SCOPE_PLAYERS_READ)
+	playersWrite := routes.RequireScope(auth.SCOPE_PLAYERS_WRITE)
+	filesScope := routes.RequireScope(auth.SCOPE_FILES)
+	serverScope := routes.RequireScope(auth.SCOPE_SERVER)
+
+	r.GET("/", public, routes.Index)
+	r.GET("/load", read, routes.GetSystemLoad)
+	r.GET("/servers/:id", public, routes.GetServer)
+	r.POST("/servers", write, routes.CreateServer)
+	r.PUT("/servers/:id", write, routes.UpdateServer)
 
-	r.DELETE("/servers/:id", routes.DeleteServer)
-	r.POST("/servers/:id/data", routes.PostServerMessage)
-	r.POST("/server/create", routes.GenerateServer)
-	r.GET("/server/:id/status", routes.ServerStatus)
-	r.GET("/servers", routes.GetServers)
+	r.DELETE("/servers/:id", write, routes.DeleteServer)
+	r.POST("/servers/:id/data", console, routes.PostServerMessage)
+	r.POST("/servers/:id/start", write, routes.StartServer)
+	r.POST("/servers/:id/stop", write, routes.StopServer)
+	r.POST("/servers/:id/restart", write, routes.RestartServer)
+	r.POST("/servers/:id/kill", write, routes.KillServer)
+	r.PUT("/servers/:id/resources", write, routes.UpdateServerResources)
+	r.GET("/servers/:id/console", console, routes.ServerConsole)
+	r.POST("/servers/:id/console", console, routes.PostConsoleCommand)
+	r.POST("/servers/:id/command", console, routes.ServerCommand)
+	r.GET("/servers/:id/keys", admin, routes.GetSigningKeys)
+	r.GET("/servers/:id/pending", admin, routes.GetPendingMessages)
+	r.GET("/servers/:id/heartbeats", read, routes.GetHeartbeats)
+	r.POST("/servers/:id/keys/rotate", admin, routes.RotateSigningKey)
+	r.GET("/servers/:id/backups", read, routes.GetBackups)
+	r.POST("/servers/:id/backups", write, routes.CreateBackup)
+	r.GET("/servers/:id/backups/:backup", read, routes.GetBackup)
+	r.GET("/servers/:id/backups/:backup/download", write, routes.DownloadBackup)
+	r.DELETE("/servers/:id/backups/:backup", write, routes.DeleteBackup)
+	r.POST("/servers/:id/backups/:backup/restore", write, routes.RestoreBackup)
+	r.GET("/servers/:id/schedules", read, routes.GetScheduledTasks)
+	r.POST("/servers/:id/schedules", write, routes.CreateScheduledTask)
+	r.GET("/servers/:id/schedules/:task", read, routes.GetScheduledTask)
+	r.PUT("/servers/:id/schedules/:task", write, routes.UpdateScheduledTask)
+	r.DELETE("/servers/:id/schedules/:task", write, routes.DeleteScheduledTask)
+	r.GET("/servers/:id/schedules/:task/runs", read, routes.GetTaskRuns)
+	r.POST("/servers/:id/schedules/:task/run", write, routes.RunScheduledTask)
+	r.GET("/servers/:id/files", filesScope, routes.GetFiles)
+	r.GET("/servers/:id/files/content", filesScope, routes.ReadFile)
+	r.PUT("/servers/:id/files/content", filesScope, routes.WriteFile)
+	r.POST("/servers/:id/files/upload", filesScope, routes.UploadFile)
+	r.GET("/servers/:id/files/download", filesScope, routes.DownloadFile)
+	r.POST("/servers/:id/files/directory", filesScope, routes.CreateDirectory)
+	r.POST("/servers/:id/files/rename", filesScope, routes.RenameFile)
+	r.DELETE("/servers/:id/files", filesScope, routes.DeleteFile)
+	r.GET("/servers/:id/files/changes", filesScope, routes.GetFileChanges)
+	r.GET("/servers/:id/properties", read, routes.GetServerProperties)
+	r.PATCH("/servers/:id/properties", write, routes.PatchServerProperties)
+	r.GET("/servers/:id/plugins", read, routes.GetPlugins)
+	r.GET("/servers/:id/plugins/search", read, routes.SearchPlugins)
+	r.POST("/servers/:id/plugins", write, routes.InstallPlugin)
+	r.POST("/servers/:id/plugins/:plugin/update", write, routes.UpdatePlugin)
+	r.DELETE("/servers/:id/plugins/:plugin", write, routes.RemovePlugin)
+	r.GET("/plugins/catalogs", read, routes.GetPluginCatalogs)
+	r.POST("/server/create", write, routes.GenerateServer)
+	r.GET("/servers/:id/status", public, routes.ServerStatus)
+	// Old path, kept for existing clients
+	r.GET("/server/:id/status", public, routes.ServerStatus)
+	r.GET("/servers", public, routes.GetServers)
+	r.GET("/templates", read, routes.GetTemplates)
+	r.GET("/templates/:id", read, routes.GetTemplate)
+	r.POST("/templates", write, routes.CreateTemplate)
+	r.PUT("/templates/:id", write, routes.UpdateTemplate)
+	r.DELETE("/templates/:id", write, routes.DeleteTemplate)
+	r.GET("/jobs", read, routes.GetJobs)
+	r.GET("/jobs/:id", read, routes.GetJob)
+	r.GET("/players", playersRead, routes.GetPlayers)
+	r.GET("/players/:uuid", playersRead, routes.GetPlayer)
+	r.POST("/players", playersWrite, routes.RegisterPlayer)
+	r.PUT("/players/:uuid", playersWrite, routes.UpdatePlayer)
+	r.POST("/players/:uuid/login", playersWrite, routes.PlayerLogin)
+	r.POST("/players/:uuid/link-code", playersWrite, routes.CreateLinkCode)
+	r.POST("/servers/:id/players/:uuid/link-code", serverScope, routes.CreateLinkCode)
+	r.POST("/players/link", playersWrite, routes.RedeemLinkCode)
+	r.DELETE("/players/:uuid/link", playersWrite, routes.UnlinkPlayer)
+	r.POST("/players/:uuid/register", playersWrite, routes.RegisterPlayerPassword)
+	r.POST("/players/:uuid/authenticate", playersWrite, routes.LoginPlayerPassword)
+	r.PUT("/players/:uuid/password", playersWrite, routes.ChangePlayerPassword)
+	r.POST("/players/:uuid/session", playersWrite, routes.ResumePlayerSession)
+	r.PUT("/players/:uuid/server", playersWrite, routes.ConnectPlayer)
+	r.DELETE("/players/:uuid/session", playersWrite, routes.LogoutPlayer)
+	r.GET("/keys", admin, routes.GetApiKeys)
+	r.GET("/keys/events", admin, routes.GetEventSigningKey)
+	r.POST("/keys", admin, routes.CreateApiKey)
+	r.DELETE("/keys/:id", admin, routes.RevokeApiKey)
+
+	r.GET("/dispatcher/handlers", admin, routes.GetDispatcherHandlers)
+
+	server := &http.Server{
+		Addr:    ":" + strconv.Itoa(int(cfg.Port)),
+		Handler: r,
+	}
 
-	r.Run(":" + strconv.Itoa(int(cfg.Port)))
+	go func() {
+		err := server.ListenAndServe()
+
+		if err != nil && err != http.ErrServerClosed {
+			logger.Fatal(err.Error())
+			os.Exit(1)
+		}
+	}()
 
 	logger.Info("Server started")
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	logger.Info("Shutting down")
+
+	stopMonitors()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err = server.Shutdown(ctx)
+
+	if err != nil {
+		logger.Error("Error shutting down http server: " + err.Error())
+	}
+
+	err = channels.RequestDispatcher.Shutdown(ctx)
+
+	if err != nil {
+		logger.Error("Error shutting down request dispatcher: " + err.Error())
+	}
 }
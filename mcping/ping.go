@@ -0,0 +1,439 @@
+package mcping
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Protocol version sent in the handshake, servers answer status requests for any version
+const HANDSHAKE_PROTOCOL = 47
+
+// Responses larger than this are rejected instead of allocated
+const MAX_PACKET_SIZE = 1 << 20
+
+var ErrInvalidResponse = errors.New("invalid server list ping response")
+
+// Swapped out in tests
+var dial = net.DialTimeout
+
+type Status struct {
+	Motd          string        `json:"motd"`
+	Version       string        `json:"version"`
+	Protocol      int           `json:"protocol"`
+	OnlinePlayers int           `json:"online_players"`
+	MaxPlayers    int           `json:"max_players"`
+	Latency       time.Duration `json:"-"`
+	Legacy        bool          `json:"legacy"`
+}
+
+// Latency is sent as whole milliseconds, a Duration would marshal as nanoseconds
+func (s Status) MarshalJSON() ([]byte, error) {
+	type status Status
+
+	return json.Marshal(struct {
+		status
+		LatencyMs int64 `json:"latency_ms"`
+	}{status(s), s.Latency.Milliseconds()})
+}
+
+type statusResponse struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	} `json:"players"`
+	Description json.RawMessage `json:"description"`
+}
+
+// Probe tries the modern protocol first and falls back to the 1.6 legacy ping
+func Probe(address string, timeout time.Duration) (*Status, error) {
+
+	status, err := Ping(address, timeout)
+
+	if err == nil {
+		return status, nil
+	}
+
+	legacyStatus, legacyErr := PingLegacy(address, timeout)
+
+	if legacyErr == nil {
+		return legacyStatus, nil
+	}
+
+	return nil, err
+}
+
+// Ping runs the handshake, status request and ping/pong of the 1.7+ protocol
+func Ping(address string, timeout time.Duration) (*Status, error) {
+
+	host, port, err := splitAddress(address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dial("tcp", address, timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var handshake bytes.Buffer
+
+	writeVarInt(&handshake, 0x00)
+	writeVarInt(&handshake, HANDSHAKE_PROTOCOL)
+	writeString(&handshake, host)
+	binary.Write(&handshake, binary.BigEndian, port)
+	writeVarInt(&handshake, 1)
+
+	err = writePacket(conn, handshake.Bytes())
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = writePacket(conn, []byte{0x00})
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+
+	packet, err := readPacket(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	packetReader := bytes.NewReader(packet)
+
+	id, err := readVarInt(packetReader)
+
+	if err != nil || id != 0x00 {
+		return nil, ErrInvalidResponse
+	}
+
+	body, err := readString(packetReader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var response statusResponse
+
+	err = json.Unmarshal([]byte(body), &response)
+
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Motd:          parseDescription(response.Description),
+		Version:       response.Version.Name,
+		Protocol:      response.Version.Protocol,
+		OnlinePlayers: response.Players.Online,
+		MaxPlayers:    response.Players.Max,
+	}
+
+	var ping bytes.Buffer
+
+	sentAt := time.Now()
+
+	writeVarInt(&ping, 0x01)
+	binary.Write(&ping, binary.BigEndian, sentAt.UnixNano())
+
+	err = writePacket(conn, ping.Bytes())
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = readPacket(reader)
+
+	// Some servers close the connection instead of answering the ping, the status is still valid
+	if err == nil {
+		status.Latency = time.Since(sentAt)
+	}
+
+	return status, nil
+}
+
+// PingLegacy speaks the 1.6 protocol (0xFE 0x01 with the MC|PingHost plugin message)
+func PingLegacy(address string, timeout time.Duration) (*Status, error) {
+
+	host, port, err := splitAddress(address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dial("tcp", address, timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	hostUtf16 := utf16.Encode([]rune(host))
+
+	var request bytes.Buffer
+
+	request.Write([]byte{0xFE, 0x01, 0xFA})
+	writeLegacyString(&request, "MC|PingHost")
+	binary.Write(&request, binary.BigEndian, uint16(7+2*len(hostUtf16)))
+	request.WriteByte(74)
+	writeLegacyString(&request, host)
+	binary.Write(&request, binary.BigEndian, int32(port))
+
+	sentAt := time.Now()
+
+	_, err = conn.Write(request.Bytes())
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+
+	kick, err := reader.ReadByte()
+
+	if err != nil || kick != 0xFF {
+		return nil, ErrInvalidResponse
+	}
+
+	response, err := readLegacyString(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	latency := time.Since(sentAt)
+
+	// §1\0protocol\0version\0motd\0online\0max
+	fields := strings.Split(response, "\x00")
+
+	if len(fields) != 6 || fields[0] != "§1" {
+		return nil, ErrInvalidResponse
+	}
+
+	protocol, _ := strconv.Atoi(fields[1])
+	online, _ := strconv.Atoi(fields[4])
+	max, _ := strconv.Atoi(fields[5])
+
+	return &Status{
+		Motd:          fields[3],
+		Version:       fields[2],
+		Protocol:      protocol,
+		OnlinePlayers: online,
+		MaxPlayers:    max,
+		Latency:       latency,
+		Legacy:        true,
+	}, nil
+}
+
+// The description is either a plain string or a chat component with nested extra parts
+func parseDescription(raw json.RawMessage) string {
+
+	var text string
+
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+
+	var component chatComponent
+
+	if json.Unmarshal(raw, &component) != nil {
+		return ""
+	}
+
+	return component.String()
+}
+
+type chatComponent struct {
+	Text  string          `json:"text"`
+	Extra []chatComponent `json:"extra"`
+}
+
+func (c *chatComponent) UnmarshalJSON(data []byte) error {
+
+	var text string
+
+	if json.Unmarshal(data, &text) == nil {
+		c.Text = text
+		return nil
+	}
+
+	type plain chatComponent
+
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+func (c chatComponent) String() string {
+
+	var builder strings.Builder
+
+	builder.WriteString(c.Text)
+
+	for _, extra := range c.Extra {
+		builder.WriteString(extra.String())
+	}
+
+	return builder.String()
+}
+
+func splitAddress(address string) (string, uint16, error) {
+
+	host, portString, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	return host, uint16(port), nil
+}
+
+func writeVarInt(w *bytes.Buffer, value int32) {
+
+	unsigned := uint32(value)
+
+	for {
+		if unsigned&^0x7F == 0 {
+			w.WriteByte(byte(unsigned))
+			return
+		}
+
+		w.WriteByte(byte(unsigned&0x7F | 0x80))
+		unsigned >>= 7
+	}
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+
+	var value uint32
+
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+
+		if err != nil {
+			return 0, err
+		}
+
+		value |= uint32(b&0x7F) << (7 * i)
+
+		if b&0x80 == 0 {
+			return int32(value), nil
+		}
+	}
+
+	return 0, ErrInvalidResponse
+}
+
+func writeString(w *bytes.Buffer, value string) {
+	writeVarInt(w, int32(len(value)))
+	w.WriteString(value)
+}
+
+func readString(r *bytes.Reader) (string, error) {
+
+	length, err := readVarInt(r)
+
+	if err != nil {
+		return "", err
+	}
+
+	if length < 0 || int(length) > r.Len() {
+		return "", ErrInvalidResponse
+	}
+
+	buffer := make([]byte, length)
+
+	_, err = io.ReadFull(r, buffer)
+
+	return string(buffer), err
+}
+
+func writePacket(w io.Writer, data []byte) error {
+
+	var packet bytes.Buffer
+
+	writeVarInt(&packet, int32(len(data)))
+	packet.Write(data)
+
+	_, err := w.Write(packet.Bytes())
+
+	return err
+}
+
+func readPacket(r *bufio.Reader) ([]byte, error) {
+
+	length, err := readVarInt(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if length <= 0 || length > MAX_PACKET_SIZE {
+		return nil, ErrInvalidResponse
+	}
+
+	packet := make([]byte, length)
+
+	_, err = io.ReadFull(r, packet)
+
+	return packet, err
+}
+
+func writeLegacyString(w *bytes.Buffer, value string) {
+
+	encoded := utf16.Encode([]rune(value))
+
+	binary.Write(w, binary.BigEndian, uint16(len(encoded)))
+	binary.Write(w, binary.BigEndian, encoded)
+}
+
+func readLegacyString(r io.Reader) (string, error) {
+
+	var length uint16
+
+	err := binary.Read(r, binary.BigEndian, &length)
+
+	if err != nil {
+		return "", err
+	}
+
+	encoded := make([]uint16, length)
+
+	err = binary.Read(r, binary.BigEndian, encoded)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(utf16.Decode(encoded)), nil
+}
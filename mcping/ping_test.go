@@ -0,0 +1,341 @@
+package mcping
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVarInt(t *testing.T) {
+
+	tests := []struct {
+		value   int32
+		encoded []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{255, []byte{0xff, 0x01}},
+		{25565, []byte{0xdd, 0xc7, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2147483647, []byte{0xff, 0xff, 0xff, 0xff, 0x07}},
+		{-1, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+		{-2147483648, []byte{0x80, 0x80, 0x80, 0x80, 0x08}},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		writeVarInt(&buffer, test.value)
+
+		if !bytes.Equal(buffer.Bytes(), test.encoded) {
+			t.Errorf("%d encoded as %x, want %x", test.value, buffer.Bytes(), test.encoded)
+		}
+
+		decoded, err := readVarInt(bytes.NewReader(test.encoded))
+
+		if err != nil || decoded != test.value {
+			t.Errorf("%x decoded as %d (%v), want %d", test.encoded, decoded, err, test.value)
+		}
+	}
+
+	// Six bytes with the continuation bit would overflow an int32
+	_, err := readVarInt(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01}))
+
+	if err != ErrInvalidResponse {
+		t.Errorf("overlong varint: %v", err)
+	}
+
+	_, err = readVarInt(bytes.NewReader([]byte{0xff}))
+
+	if err == nil {
+		t.Error("truncated varint decoded")
+	}
+}
+
+// fakeDial answers each dial with the next server, run on the other end of a net.Pipe
+func fakeDial(t *testing.T, servers ...func(conn net.Conn)) {
+
+	previous := dial
+
+	dial = func(network string, address string, timeout time.Duration) (net.Conn, error) {
+
+		if len(servers) == 0 {
+			t.Fatal("unexpected dial to " + address)
+		}
+
+		client, server := net.Pipe()
+		handle := servers[0]
+		servers = servers[1:]
+
+		go func() {
+			defer server.Close()
+			handle(server)
+		}()
+
+		return client, nil
+	}
+
+	t.Cleanup(func() { dial = previous })
+}
+
+func packet(fields ...[]byte) []byte {
+
+	var buffer bytes.Buffer
+	writePacket(&buffer, bytes.Join(fields, nil))
+
+	return buffer.Bytes()
+}
+
+func varInt(value int32) []byte {
+
+	var buffer bytes.Buffer
+	writeVarInt(&buffer, value)
+
+	return buffer.Bytes()
+}
+
+func mcString(value string) []byte {
+
+	var buffer bytes.Buffer
+	writeString(&buffer, value)
+
+	return buffer.Bytes()
+}
+
+// What modernServer does after writing the status response
+type pingReply int
+
+const (
+	closeAfterStatus pingReply = iota
+	ignorePing
+	answerPing
+)
+
+// modernServer reads the handshake and status request, then writes response as is
+func modernServer(t *testing.T, response []byte, reply pingReply) func(conn net.Conn) {
+	return func(conn net.Conn) {
+
+		reader := bufio.NewReader(conn)
+
+		handshake, err := readPacket(reader)
+
+		if err != nil {
+			t.Errorf("reading handshake: %v", err)
+			return
+		}
+
+		expected := packet(varInt(0x00), varInt(HANDSHAKE_PROTOCOL), mcString("play.example"), []byte{0x63, 0xdd}, varInt(1))
+
+		if !bytes.Equal(packet(handshake), expected) {
+			t.Errorf("handshake %x, want %x", packet(handshake), expected)
+		}
+
+		request, err := readPacket(reader)
+
+		if err != nil || !bytes.Equal(request, []byte{0x00}) {
+			t.Errorf("status request %x: %v", request, err)
+			return
+		}
+
+		_, err = conn.Write(response)
+
+		if err != nil || reply == closeAfterStatus {
+			return
+		}
+
+		ping, err := readPacket(reader)
+
+		if err != nil || reply == ignorePing {
+			return
+		}
+
+		conn.Write(packet(ping))
+	}
+}
+
+func statusPacket(json string) []byte {
+	return packet(varInt(0x00), mcString(json))
+}
+
+func TestPing(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		response []byte
+		reply    pingReply
+		expected *Status
+		latency  bool
+	}{
+		{
+			name:     "plain description",
+			response: statusPacket(`{"version": {"name": "1.19.2", "protocol": 760}, "players": {"max": 20, "online": 3}, "description": "A Minecraft Server"}`),
+			reply:    answerPing,
+			expected: &Status{Motd: "A Minecraft Server", Version: "1.19.2", Protocol: 760, OnlinePlayers: 3, MaxPlayers: 20},
+			latency:  true,
+		},
+		{
+			name:     "chat component description",
+			response: statusPacket(`{"version": {"name": "Paper 1.19.2", "protocol": 760}, "players": {"max": 100, "online": 0}, "description": {"text": "Lisek ", "extra": [{"text": "World"}, " Reborn"]}}`),
+			reply:    answerPing,
+			expected: &Status{Motd: "Lisek World Reborn", Version: "Paper 1.19.2", Protocol: 760, MaxPlayers: 100},
+			latency:  true,
+		},
+		{
+			name:     "no pong",
+			reply:    ignorePing,
+			response: statusPacket(`{"version": {"name": "1.8.9", "protocol": 47}, "players": {"max": 10, "online": 1}, "description": "old"}`),
+			expected: &Status{Motd: "old", Version: "1.8.9", Protocol: 47, OnlinePlayers: 1, MaxPlayers: 10},
+		},
+		{name: "invalid json", response: statusPacket(`{"version": `)},
+		{name: "wrong packet id", response: packet(varInt(0x01), mcString(`{}`))},
+		{name: "string longer than the packet", response: packet(varInt(0x00), varInt(100), []byte("{}"))},
+		{name: "oversized packet", response: varInt(MAX_PACKET_SIZE + 1)},
+		{name: "empty packet", response: varInt(0)},
+		{name: "truncated packet", response: append(varInt(100), make([]byte, 10)...)},
+		{name: "closed", response: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			fakeDial(t, modernServer(t, test.response, test.reply))
+
+			status, err := Ping("play.example:25565", time.Second)
+
+			if test.expected == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", status)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (status.Latency > 0) != test.latency {
+				t.Errorf("latency %v", status.Latency)
+			}
+
+			status.Latency = 0
+
+			if *status != *test.expected {
+				t.Errorf("got %+v, want %+v", *status, *test.expected)
+			}
+		})
+	}
+}
+
+func legacyResponse(fields ...string) []byte {
+
+	var buffer bytes.Buffer
+
+	buffer.WriteByte(0xFF)
+	writeLegacyString(&buffer, strings.Join(fields, "\x00"))
+
+	return buffer.Bytes()
+}
+
+// legacyServer checks the 1.6 ping request and writes response
+func legacyServer(t *testing.T, response []byte) func(conn net.Conn) {
+	return func(conn net.Conn) {
+
+		var expected bytes.Buffer
+
+		expected.Write([]byte{0xFE, 0x01, 0xFA})
+		writeLegacyString(&expected, "MC|PingHost")
+		binary.Write(&expected, binary.BigEndian, uint16(7+2*len("play.example")))
+		expected.WriteByte(74)
+		writeLegacyString(&expected, "play.example")
+		binary.Write(&expected, binary.BigEndian, int32(25565))
+
+		request := make([]byte, expected.Len())
+
+		_, err := conn.Read(request)
+
+		if err != nil || !bytes.Equal(request, expected.Bytes()) {
+			t.Errorf("legacy request %x, want %x: %v", request, expected.Bytes(), err)
+			return
+		}
+
+		conn.Write(response)
+	}
+}
+
+func TestProbe(t *testing.T) {
+
+	legacy := legacyResponse("§1", "74", "1.6.4", "Legacy server", "2", "40")
+
+	tests := []struct {
+		name     string
+		servers  func(t *testing.T) []func(conn net.Conn)
+		expected *Status
+	}{
+		{
+			name: "modern",
+			servers: func(t *testing.T) []func(conn net.Conn) {
+				return []func(conn net.Conn){modernServer(t, statusPacket(`{"version": {"name": "1.19.2", "protocol": 760}, "description": "new"}`), ignorePing)}
+			},
+			expected: &Status{Motd: "new", Version: "1.19.2", Protocol: 760},
+		},
+		{
+			name: "legacy fallback",
+			servers: func(t *testing.T) []func(conn net.Conn) {
+				// A 1.6 server kicks the modern handshake
+				return []func(conn net.Conn){modernServer(t, []byte{0xFF}, closeAfterStatus), legacyServer(t, legacy)}
+			},
+			expected: &Status{Motd: "Legacy server", Version: "1.6.4", Protocol: 74, OnlinePlayers: 2, MaxPlayers: 40, Legacy: true},
+		},
+		{
+			name: "legacy with missing fields",
+			servers: func(t *testing.T) []func(conn net.Conn) {
+				return []func(conn net.Conn){func(conn net.Conn) {}, legacyServer(t, legacyResponse("§1", "74", "1.6.4"))}
+			},
+		},
+		{
+			name: "legacy without kick",
+			servers: func(t *testing.T) []func(conn net.Conn) {
+				return []func(conn net.Conn){func(conn net.Conn) {}, legacyServer(t, legacy[1:])}
+			},
+		},
+		{
+			name: "legacy truncated",
+			servers: func(t *testing.T) []func(conn net.Conn) {
+				return []func(conn net.Conn){func(conn net.Conn) {}, legacyServer(t, legacy[:10])}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			fakeDial(t, test.servers(t)...)
+
+			status, err := Probe("play.example:25565", time.Second)
+
+			if test.expected == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", status)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			status.Latency = 0
+
+			if *status != *test.expected {
+				t.Errorf("got %+v, want %+v", *status, *test.expected)
+			}
+		})
+	}
+}
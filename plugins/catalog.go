@@ -0,0 +1,136 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+)
+
+var ErrUnknownCatalog = errors.New("unknown plugin catalog")
+var ErrProjectNotFound = errors.New("project not found in the catalog")
+var ErrNoCompatibleVersion = errors.New("no version compatible with the server")
+
+type Project struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Hashes are the checksums the catalog publishes, by algorithm (sha1, sha256, sha512)
+type Version struct {
+	ID           string            `json:"id"`
+	ProjectID    string            `json:"project_id"`
+	Number       string            `json:"number"`
+	FileName     string            `json:"file_name"`
+	URL          string            `json:"url"`
+	Hashes       map[string]string `json:"hashes"`
+	GameVersions []string          `json:"game_versions"`
+	Loaders      []string          `json:"loaders"`
+}
+
+// Catalog is a source of plugins. Loader is the lowercased server type (paper, fabric, ...),
+// versions are returned newest first and only those matching loader and game version.
+type Catalog interface {
+	Name() string
+	Search(ctx context.Context, query string, loader string, gameVersion string) ([]Project, error)
+	Project(ctx context.Context, id string) (Project, error)
+	Versions(ctx context.Context, projectId string, loader string, gameVersion string) ([]Version, error)
+	Download(ctx context.Context, version Version) (io.ReadCloser, error)
+}
+
+var Catalogs = map[string]Catalog{}
+
+func RegisterCatalog(catalog Catalog) {
+	Catalogs[catalog.Name()] = catalog
+}
+
+func FindCatalog(name string) (Catalog, error) {
+
+	catalog, ok := Catalogs[name]
+
+	if !ok {
+		return nil, ErrUnknownCatalog
+	}
+
+	return catalog, nil
+}
+
+func CatalogNames() []string {
+
+	names := []string{}
+
+	for name := range Catalogs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func Init() error {
+
+	cfg := config.LoadedConfiguration.Plugins
+
+	if cfg.ModrinthUrl != "" {
+		RegisterCatalog(NewModrinthCatalog(cfg.ModrinthUrl))
+	}
+
+	if cfg.FixtureDir != "" {
+		catalog, err := NewFixtureCatalog(cfg.FixtureDir)
+
+		if err != nil {
+			return err
+		}
+
+		RegisterCatalog(catalog)
+	}
+
+	return nil
+}
+
+// Paper and its forks run bukkit plugins too, catalogs tag them either way
+func compatibleLoaders(loader string) []string {
+	switch loader {
+	case "paper", "purpur", "pufferfish":
+		return []string{loader, "paper", "spigot", "bukkit"}
+	case "spigot":
+		return []string{"spigot", "bukkit"}
+	case "quilt":
+		return []string{"quilt", "fabric"}
+	}
+
+	return []string{loader}
+}
+
+func matches(values []string, wanted []string) bool {
+
+	for _, value := range values {
+		for _, w := range wanted {
+			if strings.EqualFold(value, w) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// IsCompatible checks a version against the server, catalogs that don't filter
+// themselves use it. Versions without game versions or loaders match any.
+func IsCompatible(version Version, loader string, gameVersion string) bool {
+
+	if len(version.Loaders) > 0 && loader != "" && !matches(version.Loaders, compatibleLoaders(loader)) {
+		return false
+	}
+
+	if len(version.GameVersions) > 0 && gameVersion != "" && !matches(version.GameVersions, []string{gameVersion}) {
+		return false
+	}
+
+	return true
+}
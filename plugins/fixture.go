@@ -0,0 +1,118 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FixtureCatalog serves plugins from a local directory, for tests and offline setups.
+// The directory holds catalog.json and the jars it names:
+//
+//	{"projects": [{"id": "...", "name": "...", "description": "...",
+//	  "versions": [{"id": "...", "number": "...", "file_name": "x.jar", ...}]}]}
+//
+// Versions are listed newest first, like the other catalogs return them.
+type FixtureCatalog struct {
+	Directory string
+	projects  []fixtureProject
+}
+
+type fixtureProject struct {
+	Project
+	Versions []Version `json:"versions"`
+}
+
+func NewFixtureCatalog(directory string) (*FixtureCatalog, error) {
+
+	data, err := os.ReadFile(filepath.Join(directory, "catalog.json"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var index struct {
+		Projects []fixtureProject `json:"projects"`
+	}
+
+	err = json.Unmarshal(data, &index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range index.Projects {
+		for j := range index.Projects[i].Versions {
+			index.Projects[i].Versions[j].ProjectID = index.Projects[i].ID
+		}
+	}
+
+	return &FixtureCatalog{Directory: directory, projects: index.Projects}, nil
+}
+
+func (f *FixtureCatalog) Name() string {
+	return "fixture"
+}
+
+func (f *FixtureCatalog) find(id string) (fixtureProject, error) {
+
+	for _, project := range f.projects {
+		if project.ID == id {
+			return project, nil
+		}
+	}
+
+	return fixtureProject{}, ErrProjectNotFound
+}
+
+func (f *FixtureCatalog) Search(ctx context.Context, query string, loader string, gameVersion string) ([]Project, error) {
+
+	projects := []Project{}
+
+	for _, project := range f.projects {
+		if !strings.Contains(strings.ToLower(project.Name), strings.ToLower(query)) {
+			continue
+		}
+
+		versions, _ := f.Versions(ctx, project.ID, loader, gameVersion)
+
+		if len(versions) > 0 {
+			projects = append(projects, project.Project)
+		}
+	}
+
+	return projects, nil
+}
+
+func (f *FixtureCatalog) Project(ctx context.Context, id string) (Project, error) {
+
+	project, err := f.find(id)
+
+	return project.Project, err
+}
+
+func (f *FixtureCatalog) Versions(ctx context.Context, projectId string, loader string, gameVersion string) ([]Version, error) {
+
+	project, err := f.find(projectId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []Version{}
+
+	for _, version := range project.Versions {
+		if IsCompatible(version, loader, gameVersion) {
+			versions = append(versions, version)
+		}
+	}
+
+	return versions, nil
+}
+
+func (f *FixtureCatalog) Download(ctx context.Context, version Version) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(f.Directory, filepath.Base(version.FileName)))
+}
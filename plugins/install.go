@@ -0,0 +1,387 @@
+package plugins
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/docker"
+	"github.com/Lisek-World-Reborn/lisek-api/files"
+)
+
+const MAX_PLUGIN_SIZE = 256 << 20
+
+// Longest a download from a plain url may take, including the body
+const URL_DOWNLOAD_TIMEOUT = 5 * time.Minute
+
+var ErrChecksumMismatch = errors.New("downloaded file doesn't match its checksum")
+var ErrInvalidFileName = errors.New("plugin file name must be a .jar")
+var ErrAlreadyInstalled = errors.New("project is already installed, update it instead")
+var ErrNotFromCatalog = errors.New("plugins installed from a url can't be updated")
+var ErrPathInUse = errors.New("another installed plugin uses this file")
+var ErrBlockedAddress = errors.New("downloads from loopback, private or link-local addresses aren't allowed")
+
+// Where a server's files are, replaced in tests
+var serverRoot = files.Root
+
+// urlClient downloads plugins from urls the caller picked. It refuses to connect to
+// internal addresses, checked on the resolved ip so redirects and dns can't get around it,
+// and doesn't use proxies, which would connect on its behalf.
+var urlClient = &http.Client{
+	Timeout: URL_DOWNLOAD_TIMEOUT,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: publicOnly}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+func publicOnly(network string, address string, conn syscall.RawConn) error {
+
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return ErrBlockedAddress
+	}
+
+	return nil
+}
+
+// Either Catalog and Project (Version is an id or number, the newest compatible
+// one when empty) or URL with an optional Sha256
+type InstallRequest struct {
+	Catalog string `json:"catalog"`
+	Project string `json:"project"`
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	Sha256  string `json:"sha256"`
+}
+
+// Target is where a server keeps its jars and what catalogs know its type as
+type Target struct {
+	Loader      string `json:"loader"`
+	GameVersion string `json:"game_version"`
+	Directory   string `json:"directory"`
+}
+
+func ServerTarget(server db.Server) (Target, error) {
+
+	template, err := docker.ResolveTemplate(server)
+
+	if err != nil {
+		return Target{}, err
+	}
+
+	target := Target{
+		Loader:      strings.ToLower(template.ServerType),
+		GameVersion: template.Version,
+		Directory:   "plugins",
+	}
+
+	switch target.Loader {
+	case "fabric", "quilt", "forge", "neoforge":
+		target.Directory = "mods"
+	}
+
+	// The itzg image takes LATEST, catalogs only know real versions
+	if strings.EqualFold(target.GameVersion, "latest") {
+		target.GameVersion = ""
+	}
+
+	return target, nil
+}
+
+func Install(ctx context.Context, server db.Server, request InstallRequest) (db.InstalledPlugin, error) {
+
+	target, err := ServerTarget(server)
+
+	if err != nil {
+		return db.InstalledPlugin{}, err
+	}
+
+	if request.URL != "" {
+		return installFromUrl(ctx, server, target, request)
+	}
+
+	catalog, err := FindCatalog(request.Catalog)
+
+	if err != nil {
+		return db.InstalledPlugin{}, err
+	}
+
+	project, err := catalog.Project(ctx, request.Project)
+
+	if err != nil {
+		return db.InstalledPlugin{}, err
+	}
+
+	existing := db.InstalledPlugin{}
+	db.OpenedConnection.Where("server_id = ? AND catalog = ? AND project_id = ?", server.ID, catalog.Name(), project.ID).First(&existing)
+
+	if existing.ID != 0 {
+		return existing, ErrAlreadyInstalled
+	}
+
+	version, err := findVersion(ctx, catalog, project.ID, target, request.Version)
+
+	if err != nil {
+		return db.InstalledPlugin{}, err
+	}
+
+	data, err := catalog.Download(ctx, version)
+
+	if err != nil {
+		return db.InstalledPlugin{}, err
+	}
+
+	defer data.Close()
+
+	plugin := db.InstalledPlugin{
+		ServerID:  server.ID,
+		Catalog:   catalog.Name(),
+		ProjectID: project.ID,
+		Name:      project.Name,
+		Version:   version.Number,
+		VersionID: version.ID,
+		URL:       version.URL,
+	}
+
+	err = store(server, &plugin, path.Join(target.Directory, path.Base(version.FileName)), data, version.Hashes)
+
+	if err != nil {
+		return plugin, err
+	}
+
+	return plugin, db.OpenedConnection.Create(&plugin).Error
+}
+
+func installFromUrl(ctx context.Context, server db.Server, target Target, request InstallRequest) (db.InstalledPlugin, error) {
+
+	parsed, err := url.Parse(request.URL)
+
+	if err != nil {
+		return db.InstalledPlugin{}, err
+	}
+
+	fileName := path.Base(parsed.Path)
+
+	data, err := downloadUrl(ctx, urlClient, request.URL)
+
+	if err != nil {
+		return db.InstalledPlugin{}, err
+	}
+
+	defer data.Close()
+
+	hashes := map[string]string{}
+
+	if request.Sha256 != "" {
+		hashes["sha256"] = strings.ToLower(request.Sha256)
+	}
+
+	plugin := db.InstalledPlugin{
+		ServerID: server.ID,
+		Name:     strings.TrimSuffix(fileName, ".jar"),
+		URL:      request.URL,
+	}
+
+	err = store(server, &plugin, path.Join(target.Directory, fileName), data, hashes)
+
+	if err != nil {
+		return plugin, err
+	}
+
+	return plugin, db.OpenedConnection.Create(&plugin).Error
+}
+
+func findVersion(ctx context.Context, catalog Catalog, projectId string, target Target, wanted string) (Version, error) {
+
+	versions, err := catalog.Versions(ctx, projectId, target.Loader, target.GameVersion)
+
+	if err != nil {
+		return Version{}, err
+	}
+
+	for _, version := range versions {
+		if wanted == "" || version.ID == wanted || version.Number == wanted {
+			return version, nil
+		}
+	}
+
+	return Version{}, ErrNoCompatibleVersion
+}
+
+// store downloads next to the target and only moves the jar into place once its
+// checksums are verified, so the server never loads a broken or tampered file
+func store(server db.Server, plugin *db.InstalledPlugin, filePath string, data io.Reader, expected map[string]string) error {
+
+	fileName := path.Base(filePath)
+
+	if !strings.HasSuffix(fileName, ".jar") || strings.HasPrefix(fileName, ".") {
+		return ErrInvalidFileName
+	}
+
+	hashers := map[string]hash.Hash{"sha1": sha1.New(), "sha256": sha256.New(), "sha512": sha512.New()}
+	writers := []io.Writer{}
+
+	for _, hasher := range hashers {
+		writers = append(writers, hasher)
+	}
+
+	var collisions int64
+	err := db.OpenedConnection.Model(&db.InstalledPlugin{}).
+		Where("server_id = ? AND path = ? AND id <> ?", server.ID, "/"+filePath, plugin.ID).
+		Count(&collisions).Error
+
+	if err != nil {
+		return err
+	}
+
+	if collisions > 0 {
+		return ErrPathInUse
+	}
+
+	root, err := serverRoot(server)
+
+	if err != nil {
+		return err
+	}
+
+	download := path.Join(path.Dir(filePath), ".download-"+fileName)
+
+	size, err := files.Write(root, download, io.TeeReader(data, io.MultiWriter(writers...)), MAX_PLUGIN_SIZE)
+
+	if err != nil {
+		return err
+	}
+
+	for algorithm, value := range expected {
+		hasher, ok := hashers[algorithm]
+
+		if ok && !strings.EqualFold(hex.EncodeToString(hasher.Sum(nil)), value) {
+			files.Delete(root, download, false)
+			return ErrChecksumMismatch
+		}
+	}
+
+	err = files.Delete(root, filePath, false)
+
+	if err != nil && err != files.ErrNotFound {
+		return err
+	}
+
+	err = files.Rename(root, download, filePath)
+
+	if err != nil {
+		return err
+	}
+
+	plugin.Path = "/" + filePath
+	plugin.Size = size
+	plugin.Sha256 = hex.EncodeToString(hashers["sha256"].Sum(nil))
+
+	return nil
+}
+
+// Update installs the newest compatible version, it returns false when it's already installed
+func Update(ctx context.Context, server db.Server, plugin db.InstalledPlugin) (db.InstalledPlugin, bool, error) {
+
+	if plugin.Catalog == "" {
+		return plugin, false, ErrNotFromCatalog
+	}
+
+	catalog, err := FindCatalog(plugin.Catalog)
+
+	if err != nil {
+		return plugin, false, err
+	}
+
+	target, err := ServerTarget(server)
+
+	if err != nil {
+		return plugin, false, err
+	}
+
+	latest, err := findVersion(ctx, catalog, plugin.ProjectID, target, "")
+
+	if err != nil {
+		return plugin, false, err
+	}
+
+	if latest.ID == plugin.VersionID {
+		return plugin, false, nil
+	}
+
+	data, err := catalog.Download(ctx, latest)
+
+	if err != nil {
+		return plugin, false, err
+	}
+
+	defer data.Close()
+
+	previousPath := plugin.Path
+
+	err = store(server, &plugin, path.Join(target.Directory, path.Base(latest.FileName)), data, latest.Hashes)
+
+	if err != nil {
+		return plugin, false, err
+	}
+
+	// Two versions of one plugin in the directory would both be loaded
+	if previousPath != plugin.Path {
+		root, err := serverRoot(server)
+
+		if err != nil {
+			return plugin, false, err
+		}
+
+		err = files.Delete(root, previousPath, false)
+
+		if err != nil && err != files.ErrNotFound {
+			return plugin, false, err
+		}
+	}
+
+	plugin.Version = latest.Number
+	plugin.VersionID = latest.ID
+	plugin.URL = latest.URL
+
+	return plugin, true, db.OpenedConnection.Save(&plugin).Error
+}
+
+func Remove(server db.Server, plugin db.InstalledPlugin) error {
+
+	root, err := serverRoot(server)
+
+	if err != nil {
+		return err
+	}
+
+	err = files.Delete(root, plugin.Path, false)
+
+	if err != nil && err != files.ErrNotFound {
+		return err
+	}
+
+	return db.OpenedConnection.Delete(&plugin).Error
+}
@@ -0,0 +1,221 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/db/dbtest"
+)
+
+// setup gives the server an in-memory database, a temporary data directory and the
+// fixture catalog, paper 1.12.2 from the default template matches its essentials plugin
+func setup(t *testing.T) (db.Server, string) {
+
+	dbtest.Open(t, &db.InstalledPlugin{})
+
+	catalog, err := NewFixtureCatalog("../fixtures/plugins")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	previousRoot, previousCatalogs := serverRoot, Catalogs
+
+	serverRoot = func(db.Server) (string, error) { return root, nil }
+	Catalogs = map[string]Catalog{}
+	RegisterCatalog(catalog)
+
+	t.Cleanup(func() {
+		serverRoot, Catalogs = previousRoot, previousCatalogs
+	})
+
+	return db.Server{ID: 1, ContainerName: "test"}, root
+}
+
+func installedFiles(t *testing.T, root string) []string {
+
+	entries, err := os.ReadDir(filepath.Join(root, "plugins"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+func TestInstallUpdateRemove(t *testing.T) {
+
+	server, root := setup(t)
+	ctx := context.Background()
+
+	plugin, err := Install(ctx, server, InstallRequest{Catalog: "fixture", Project: "lisek-essentials", Version: "1.0.0"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plugin.ID == 0 || plugin.Path != "/plugins/LisekEssentials-1.0.0.jar" || plugin.Version != "1.0.0" ||
+		plugin.Sha256 != "47419bdc0d8c8da2cd7de6e49d768255a801a4cf184a589c64213f3e00b32f51" {
+		t.Errorf("installed %+v", plugin)
+	}
+
+	_, err = Install(ctx, server, InstallRequest{Catalog: "fixture", Project: "lisek-essentials"})
+
+	if err != ErrAlreadyInstalled {
+		t.Errorf("second install returned %v", err)
+	}
+
+	_, err = Install(ctx, server, InstallRequest{Catalog: "fixture", Project: "lisek-mod"})
+
+	if err != ErrNoCompatibleVersion {
+		t.Errorf("installing a fabric mod on paper returned %v", err)
+	}
+
+	plugin, updated, err := Update(ctx, server, plugin)
+
+	if err != nil || !updated || plugin.Version != "1.1.0" {
+		t.Fatalf("Update = %+v, %v, %v", plugin, updated, err)
+	}
+
+	// The old jar must be gone, the server would load both
+	if names := installedFiles(t, root); strings.Join(names, ",") != "LisekEssentials-1.1.0.jar" {
+		t.Errorf("plugins directory after update: %v", names)
+	}
+
+	_, updated, err = Update(ctx, server, plugin)
+
+	if err != nil || updated {
+		t.Errorf("updating the newest version = %v, %v", updated, err)
+	}
+
+	err = Remove(server, plugin)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := installedFiles(t, root); len(names) != 0 {
+		t.Errorf("plugins directory after remove: %v", names)
+	}
+
+	var count int64
+	db.OpenedConnection.Model(&db.InstalledPlugin{}).Count(&count)
+
+	if count != 0 {
+		t.Errorf("%d plugin rows left after remove", count)
+	}
+}
+
+// tamperedCatalog serves other bytes than the catalog's checksums describe
+type tamperedCatalog struct {
+	*FixtureCatalog
+}
+
+func (c tamperedCatalog) Download(ctx context.Context, version Version) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("not the plugin")), nil
+}
+
+func TestInstallChecksumMismatch(t *testing.T) {
+
+	server, root := setup(t)
+
+	RegisterCatalog(tamperedCatalog{Catalogs["fixture"].(*FixtureCatalog)})
+
+	_, err := Install(context.Background(), server, InstallRequest{Catalog: "fixture", Project: "lisek-essentials"})
+
+	if err != ErrChecksumMismatch {
+		t.Fatalf("Install returned %v", err)
+	}
+
+	if names := installedFiles(t, root); len(names) != 0 {
+		t.Errorf("plugins directory after a failed install: %v", names)
+	}
+}
+
+func TestInstallFromUrl(t *testing.T) {
+
+	server, root := setup(t)
+	ctx := context.Background()
+
+	files := httptest.NewServer(http.FileServer(http.Dir("../fixtures/plugins")))
+	defer files.Close()
+
+	// The test server listens on loopback, which the real client refuses
+	_, err := Install(ctx, server, InstallRequest{URL: files.URL + "/LisekEssentials-1.0.0.jar"})
+
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("download from loopback returned %v", err)
+	}
+
+	previousClient := urlClient
+	urlClient = files.Client()
+	defer func() { urlClient = previousClient }()
+
+	_, err = Install(ctx, server, InstallRequest{URL: files.URL + "/LisekEssentials-1.0.0.jar", Sha256: strings.Repeat("0", 64)})
+
+	if err != ErrChecksumMismatch {
+		t.Errorf("url install with a wrong checksum returned %v", err)
+	}
+
+	plugin, err := Install(ctx, server, InstallRequest{URL: files.URL + "/LisekEssentials-1.0.0.jar"})
+
+	if err != nil || plugin.Path != "/plugins/LisekEssentials-1.0.0.jar" {
+		t.Fatalf("url install = %+v, %v", plugin, err)
+	}
+
+	_, err = Install(ctx, server, InstallRequest{URL: files.URL + "/LisekEssentials-1.0.0.jar"})
+
+	if err != ErrPathInUse {
+		t.Errorf("installing over a url installed jar returned %v", err)
+	}
+
+	_, err = Install(ctx, server, InstallRequest{Catalog: "fixture", Project: "lisek-essentials", Version: "1.0.0"})
+
+	if err != ErrPathInUse {
+		t.Errorf("catalog install over a url installed jar returned %v", err)
+	}
+
+	if names := installedFiles(t, root); strings.Join(names, ",") != "LisekEssentials-1.0.0.jar" {
+		t.Errorf("plugins directory: %v", names)
+	}
+}
+
+func TestPublicOnly(t *testing.T) {
+
+	tests := map[string]bool{
+		"127.0.0.1:80":          false,
+		"10.1.2.3:443":          false,
+		"192.168.1.1:443":       false,
+		"169.254.169.254:80":    false,
+		"0.0.0.0:80":            false,
+		"[::1]:443":             false,
+		"[fe80::1]:443":         false,
+		"[fd00::1]:443":         false,
+		"[::ffff:127.0.0.1]:80": false,
+		"1.1.1.1:443":           true,
+		"[2606:4700::1111]:443": true,
+	}
+
+	for address, allowed := range tests {
+		err := publicOnly("tcp", address, nil)
+
+		if (err == nil) != allowed {
+			t.Errorf("publicOnly(%s) = %v", address, err)
+		}
+	}
+}
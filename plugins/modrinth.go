@@ -0,0 +1,233 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Modrinth asks api clients to identify themselves
+const USER_AGENT = "Lisek-World-Reborn/lisek-api"
+
+type ModrinthCatalog struct {
+	BaseUrl string
+	Client  *http.Client
+}
+
+type modrinthProject struct {
+	ID          string `json:"id"`
+	ProjectID   string `json:"project_id"`
+	Slug        string `json:"slug"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+type modrinthVersion struct {
+	ID            string   `json:"id"`
+	ProjectID     string   `json:"project_id"`
+	VersionNumber string   `json:"version_number"`
+	GameVersions  []string `json:"game_versions"`
+	Loaders       []string `json:"loaders"`
+	Files         []struct {
+		URL      string            `json:"url"`
+		Filename string            `json:"filename"`
+		Primary  bool              `json:"primary"`
+		Hashes   map[string]string `json:"hashes"`
+	} `json:"files"`
+}
+
+func NewModrinthCatalog(baseUrl string) *ModrinthCatalog {
+	return &ModrinthCatalog{BaseUrl: strings.TrimSuffix(baseUrl, "/"), Client: http.DefaultClient}
+}
+
+func (m *ModrinthCatalog) Name() string {
+	return "modrinth"
+}
+
+func (m *ModrinthCatalog) get(ctx context.Context, path string, query url.Values, target interface{}) error {
+
+	address := m.BaseUrl + path
+
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("User-Agent", USER_AGENT)
+
+	response, err := m.Client.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return ErrProjectNotFound
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("modrinth responded %s", response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
+
+func jsonList(values []string) string {
+	body, _ := json.Marshal(values)
+
+	return string(body)
+}
+
+func (m *ModrinthCatalog) Search(ctx context.Context, query string, loader string, gameVersion string) ([]Project, error) {
+
+	// Facets in the same list are OR'ed, the lists AND'ed
+	facets := [][]string{}
+
+	if loader != "" {
+		categories := []string{}
+
+		for _, compatible := range compatibleLoaders(loader) {
+			categories = append(categories, "categories:"+compatible)
+		}
+
+		facets = append(facets, categories)
+	}
+
+	if gameVersion != "" {
+		facets = append(facets, []string{"versions:" + gameVersion})
+	}
+
+	values := url.Values{"query": {query}, "limit": {"20"}}
+
+	if len(facets) > 0 {
+		body, _ := json.Marshal(facets)
+		values.Set("facets", string(body))
+	}
+
+	var result struct {
+		Hits []modrinthProject `json:"hits"`
+	}
+
+	err := m.get(ctx, "/search", values, &result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	projects := []Project{}
+
+	for _, hit := range result.Hits {
+		projects = append(projects, Project{ID: hit.ProjectID, Name: hit.Title, Description: hit.Description})
+	}
+
+	return projects, nil
+}
+
+func (m *ModrinthCatalog) Project(ctx context.Context, id string) (Project, error) {
+
+	var project modrinthProject
+
+	err := m.get(ctx, "/project/"+url.PathEscape(id), nil, &project)
+
+	if err != nil {
+		return Project{}, err
+	}
+
+	return Project{ID: project.ID, Name: project.Title, Description: project.Description}, nil
+}
+
+func (m *ModrinthCatalog) Versions(ctx context.Context, projectId string, loader string, gameVersion string) ([]Version, error) {
+
+	values := url.Values{}
+
+	if loader != "" {
+		values.Set("loaders", jsonList(compatibleLoaders(loader)))
+	}
+
+	if gameVersion != "" {
+		values.Set("game_versions", jsonList([]string{gameVersion}))
+	}
+
+	var result []modrinthVersion
+
+	err := m.get(ctx, "/project/"+url.PathEscape(projectId)+"/version", values, &result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []Version{}
+
+	for _, v := range result {
+		if len(v.Files) == 0 {
+			continue
+		}
+
+		// The primary file is the jar, others are sources or api jars
+		file := v.Files[0]
+
+		for _, f := range v.Files {
+			if f.Primary {
+				file = f
+			}
+		}
+
+		versions = append(versions, Version{
+			ID:           v.ID,
+			ProjectID:    v.ProjectID,
+			Number:       v.VersionNumber,
+			FileName:     file.Filename,
+			URL:          file.URL,
+			Hashes:       file.Hashes,
+			GameVersions: v.GameVersions,
+			Loaders:      v.Loaders,
+		})
+	}
+
+	return versions, nil
+}
+
+func (m *ModrinthCatalog) Download(ctx context.Context, version Version) (io.ReadCloser, error) {
+	return downloadUrl(ctx, m.Client, version.URL)
+}
+
+func downloadUrl(ctx context.Context, client *http.Client, address string) (io.ReadCloser, error) {
+
+	parsed, err := url.Parse(address)
+
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("only http and https urls can be downloaded")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("User-Agent", USER_AGENT)
+
+	response, err := client.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("download responded %s", response.Status)
+	}
+
+	return response.Body, nil
+}
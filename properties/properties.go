@@ -0,0 +1,260 @@
+package properties
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// File is a java .properties file that keeps its comments, blank lines, ordering and
+// unknown keys when written back. Only the lines of changed keys are rewritten.
+type File struct {
+	lines []line
+}
+
+// line is one logical line, which can span several physical ones through trailing backslashes
+type line struct {
+	raw   []string
+	key   string
+	value string
+	entry bool
+}
+
+func Parse(data string) *File {
+
+	file := &File{}
+	physical := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+
+	// A trailing newline doesn't start another line
+	if len(physical) > 0 && physical[len(physical)-1] == "" {
+		physical = physical[:len(physical)-1]
+	}
+
+	for i := 0; i < len(physical); i++ {
+		current := line{raw: []string{physical[i]}}
+		trimmed := strings.TrimLeft(physical[i], " \t\f")
+
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == '!' {
+			file.lines = append(file.lines, current)
+			continue
+		}
+
+		logical := trimmed
+
+		for continues(logical) && i+1 < len(physical) {
+			i++
+			current.raw = append(current.raw, physical[i])
+			logical = logical[:len(logical)-1] + strings.TrimLeft(physical[i], " \t\f")
+		}
+
+		current.key, current.value = splitEntry(logical)
+		current.entry = true
+		file.lines = append(file.lines, current)
+	}
+
+	return file
+}
+
+// An odd number of trailing backslashes continues the line
+func continues(text string) bool {
+
+	count := 0
+
+	for i := len(text) - 1; i >= 0 && text[i] == '\\'; i-- {
+		count++
+	}
+
+	return count%2 == 1
+}
+
+func splitEntry(text string) (string, string) {
+
+	end := len(text)
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+			continue
+		}
+
+		if text[i] == '=' || text[i] == ':' || text[i] == ' ' || text[i] == '\t' || text[i] == '\f' {
+			end = i
+			break
+		}
+	}
+
+	key := text[:end]
+	rest := strings.TrimLeft(text[end:], " \t\f")
+
+	if strings.HasPrefix(rest, "=") || strings.HasPrefix(rest, ":") {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+
+	return unescape(key), unescape(rest)
+}
+
+func unescape(text string) string {
+
+	var builder strings.Builder
+	var pending []uint16
+
+	flush := func() {
+		if len(pending) > 0 {
+			builder.WriteString(string(utf16.Decode(pending)))
+			pending = nil
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' || i+1 == len(text) {
+			flush()
+			builder.WriteByte(text[i])
+			continue
+		}
+
+		i++
+
+		switch text[i] {
+		case 't':
+			flush()
+			builder.WriteByte('\t')
+		case 'n':
+			flush()
+			builder.WriteByte('\n')
+		case 'r':
+			flush()
+			builder.WriteByte('\r')
+		case 'f':
+			flush()
+			builder.WriteByte('\f')
+		case 'u':
+			code, err := strconv.ParseUint(text[i+1:min(i+5, len(text))], 16, 16)
+
+			if err != nil || i+5 > len(text) {
+				flush()
+				builder.WriteByte('u')
+				continue
+			}
+
+			// Collected so surrogate pairs decode into one rune
+			pending = append(pending, uint16(code))
+			i += 4
+		default:
+			flush()
+			builder.WriteByte(text[i])
+		}
+	}
+
+	flush()
+
+	return builder.String()
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// escape writes like java's Properties.store, which is what the server reads with
+// ISO-8859-1, so everything outside of ascii becomes \uXXXX
+func escape(text string, isKey bool) string {
+
+	var builder strings.Builder
+
+	for i, r := range text {
+		switch {
+		case r == ' ' && (isKey || i == 0):
+			builder.WriteString(`\ `)
+		case r == '\\' || r == '=' || r == ':' || r == '#' || r == '!':
+			builder.WriteByte('\\')
+			builder.WriteRune(r)
+		case r == '\t':
+			builder.WriteString(`\t`)
+		case r == '\n':
+			builder.WriteString(`\n`)
+		case r == '\r':
+			builder.WriteString(`\r`)
+		case r == '\f':
+			builder.WriteString(`\f`)
+		case r < 0x20 || r > 0x7e:
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&builder, `\u%04X`, unit)
+			}
+		default:
+			builder.WriteRune(r)
+		}
+	}
+
+	return builder.String()
+}
+
+func (f *File) Get(key string) (string, bool) {
+
+	value, found := "", false
+
+	// Like java, the last occurrence wins
+	for _, l := range f.lines {
+		if l.entry && l.key == key {
+			value, found = l.value, true
+		}
+	}
+
+	return value, found
+}
+
+// Set rewrites every line of the key, or appends it if the file doesn't have it yet
+func (f *File) Set(key string, value string) {
+
+	found := false
+
+	for i, l := range f.lines {
+		if !l.entry || l.key != key {
+			continue
+		}
+
+		found = true
+		f.lines[i].value = value
+		f.lines[i].raw = []string{escape(key, true) + "=" + escape(value, false)}
+	}
+
+	if !found {
+		f.lines = append(f.lines, line{
+			raw:   []string{escape(key, true) + "=" + escape(value, false)},
+			key:   key,
+			value: value,
+			entry: true,
+		})
+	}
+}
+
+// Values returns every key with its last value
+func (f *File) Values() map[string]string {
+
+	values := map[string]string{}
+
+	for _, l := range f.lines {
+		if l.entry {
+			values[l.key] = l.value
+		}
+	}
+
+	return values
+}
+
+func (f *File) String() string {
+
+	var builder strings.Builder
+
+	for _, l := range f.lines {
+		for _, raw := range l.raw {
+			builder.WriteString(raw)
+			builder.WriteByte('\n')
+		}
+	}
+
+	return builder.String()
+}
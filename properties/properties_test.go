@@ -0,0 +1,138 @@
+package properties
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		data  string
+		key   string
+		value string
+	}{
+		{name: "plain", data: "motd=A Minecraft Server\n", key: "motd", value: "A Minecraft Server"},
+		{name: "colon and spaces", data: "motd : hello\n", key: "motd", value: "hello"},
+		{name: "space separator", data: "motd hello world\n", key: "motd", value: "hello world"},
+		{name: "empty value", data: "level-seed=\n", key: "level-seed", value: ""},
+		{name: "crlf", data: "motd=hello\r\nmax-players=20\r\n", key: "max-players", value: "20"},
+		{name: "continuation", data: "motd=first \\\n    second\n", key: "motd", value: "first second"},
+		{name: "escaped backslash isn't a continuation", data: "motd=path\\\\\nmax-players=5\n", key: "motd", value: "path\\"},
+		{name: "unicode escape", data: "motd=\\u00A7aGreen\n", key: "motd", value: "§aGreen"},
+		{name: "surrogate pair", data: "motd=\\uD83E\\uDD8A\n", key: "motd", value: "🦊"},
+		{name: "broken unicode escape", data: "motd=\\u12\n", key: "motd", value: "u12"},
+		{name: "escaped separator in key", data: "a\\=b=c\n", key: "a=b", value: "c"},
+		{name: "last occurrence wins", data: "motd=one\nmotd=two\n", key: "motd", value: "two"},
+	}
+
+	for _, test := range tests {
+		value, ok := Parse(test.data).Get(test.key)
+
+		if !ok || value != test.value {
+			t.Errorf("%s: Get(%q) = %q, %v, want %q", test.name, test.key, value, ok, test.value)
+		}
+	}
+}
+
+func TestCommentsAreNotEntries(t *testing.T) {
+
+	file := Parse("#motd=commented\n! max-players=5\n   # indented\n")
+
+	if len(file.Values()) != 0 {
+		t.Errorf("comments parsed as entries: %v", file.Values())
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+
+	data := "#Minecraft server properties\n" +
+		"#Mon Oct 10 12:00:00 UTC 2022\n" +
+		"\n" +
+		"motd=first \\\n" +
+		"    second\n" +
+		"! legacy comment\n" +
+		"custom-plugin-key=\\u00E9t\\u00E9\n" +
+		"max-players=20\n"
+
+	file := Parse(data)
+
+	if file.String() != data {
+		t.Fatalf("unchanged file was rewritten:\n%s", file.String())
+	}
+
+	file.Set("max-players", "50")
+
+	want := "#Minecraft server properties\n" +
+		"#Mon Oct 10 12:00:00 UTC 2022\n" +
+		"\n" +
+		"motd=first \\\n" +
+		"    second\n" +
+		"! legacy comment\n" +
+		"custom-plugin-key=\\u00E9t\\u00E9\n" +
+		"max-players=50\n"
+
+	if file.String() != want {
+		t.Errorf("only the changed line should be rewritten, got:\n%s", file.String())
+	}
+}
+
+func TestSetEscapes(t *testing.T) {
+
+	tests := []struct {
+		key   string
+		value string
+		line  string
+	}{
+		{key: "motd", value: "§6Gold: #1!", line: "motd=\\u00A76Gold\\: \\#1\\!\n"},
+		{key: "motd", value: " leading space", line: "motd=\\ leading space\n"},
+		{key: "motd", value: "🦊", line: "motd=\\uD83E\\uDD8A\n"},
+		{key: "motd", value: "two\nlines", line: "motd=two\\nlines\n"},
+		{key: "odd key", value: "x", line: "odd\\ key=x\n"},
+	}
+
+	for _, test := range tests {
+		file := Parse("")
+		file.Set(test.key, test.value)
+
+		if file.String() != test.line {
+			t.Errorf("Set(%q, %q) wrote %q, want %q", test.key, test.value, file.String(), test.line)
+		}
+
+		// What was written has to read back as the same value
+		value, _ := Parse(file.String()).Get(test.key)
+
+		if value != test.value {
+			t.Errorf("Set(%q, %q) read back as %q", test.key, test.value, value)
+		}
+	}
+}
+
+func TestSetReplacesContinuedLine(t *testing.T) {
+
+	file := Parse("motd=first \\\n  second\nmax-players=20\n")
+	file.Set("motd", "third")
+
+	want := "motd=third\nmax-players=20\n"
+
+	if file.String() != want {
+		t.Errorf("got %q, want %q", file.String(), want)
+	}
+}
+
+func TestApplyRefusesManagedKeys(t *testing.T) {
+
+	file := Parse("server-port=25565\n")
+
+	for _, key := range Managed {
+		err := Apply(file, map[string]interface{}{key: "1"}, "1.12.2")
+
+		if err == nil {
+			t.Errorf("Apply accepted managed key %s", key)
+		}
+	}
+
+	if file.String() != "server-port=25565\n" {
+		t.Errorf("refused changes modified the file: %q", file.String())
+	}
+}
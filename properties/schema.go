@@ -0,0 +1,300 @@
+package properties
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	TYPE_BOOL   = "bool"
+	TYPE_INT    = "int"
+	TYPE_STRING = "string"
+	TYPE_ENUM   = "enum"
+)
+
+// Definition describes a property the api exposes as a typed field. Since is the first
+// Minecraft version that knows the key, Values are the names of enum properties in
+// the order of their numeric ids.
+type Definition struct {
+	Type   string   `json:"type"`
+	Min    int      `json:"min,omitempty"`
+	Max    int      `json:"max,omitempty"`
+	Values []string `json:"values,omitempty"`
+	Since  string   `json:"since,omitempty"`
+}
+
+// Before 1.14 difficulty and gamemode are written as numeric ids
+const NAMED_ENUMS_SINCE = "1.14"
+
+var Definitions = map[string]Definition{
+	"motd":                              {Type: TYPE_STRING, Max: 256},
+	"max-players":                       {Type: TYPE_INT, Min: 0, Max: 100000},
+	"difficulty":                        {Type: TYPE_ENUM, Values: []string{"peaceful", "easy", "normal", "hard"}},
+	"gamemode":                          {Type: TYPE_ENUM, Values: []string{"survival", "creative", "adventure", "spectator"}},
+	"hardcore":                          {Type: TYPE_BOOL},
+	"pvp":                               {Type: TYPE_BOOL},
+	"force-gamemode":                    {Type: TYPE_BOOL},
+	"view-distance":                     {Type: TYPE_INT, Min: 3, Max: 32},
+	"simulation-distance":               {Type: TYPE_INT, Min: 3, Max: 32, Since: "1.18"},
+	"white-list":                        {Type: TYPE_BOOL},
+	"enforce-whitelist":                 {Type: TYPE_BOOL, Since: "1.13"},
+	"spawn-protection":                  {Type: TYPE_INT, Min: 0, Max: 29999984},
+	"allow-flight":                      {Type: TYPE_BOOL},
+	"allow-nether":                      {Type: TYPE_BOOL},
+	"spawn-monsters":                    {Type: TYPE_BOOL},
+	"spawn-animals":                     {Type: TYPE_BOOL},
+	"spawn-npcs":                        {Type: TYPE_BOOL},
+	"generate-structures":               {Type: TYPE_BOOL},
+	"enable-command-block":              {Type: TYPE_BOOL},
+	"level-name":                        {Type: TYPE_STRING, Max: 128},
+	"level-seed":                        {Type: TYPE_STRING, Max: 128},
+	"level-type":                        {Type: TYPE_STRING, Max: 64},
+	"max-world-size":                    {Type: TYPE_INT, Min: 1, Max: 29999984},
+	"player-idle-timeout":               {Type: TYPE_INT, Min: 0, Max: 1000000},
+	"op-permission-level":               {Type: TYPE_INT, Min: 1, Max: 4},
+	"function-permission-level":         {Type: TYPE_INT, Min: 1, Max: 4, Since: "1.14"},
+	"resource-pack":                     {Type: TYPE_STRING, Max: 1024},
+	"resource-pack-sha1":                {Type: TYPE_STRING, Max: 40},
+	"require-resource-pack":             {Type: TYPE_BOOL, Since: "1.17"},
+	"prevent-proxy-connections":         {Type: TYPE_BOOL, Since: "1.11"},
+	"entity-broadcast-range-percentage": {Type: TYPE_INT, Min: 10, Max: 1000, Since: "1.16"},
+	"sync-chunk-writes":                 {Type: TYPE_BOOL, Since: "1.16"},
+	"hide-online-players":               {Type: TYPE_BOOL, Since: "1.18"},
+	"enforce-secure-profile":            {Type: TYPE_BOOL, Since: "1.19"},
+}
+
+// Managed by the api and the container, changing them through the editor would break
+// the port mapping, rcon or the offline mode login
+var Managed = []string{"server-port", "server-ip", "online-mode", "enable-rcon", "rcon.port", "rcon.password", "query.port", "enable-query"}
+
+var ErrManaged = errors.New("property is managed by the api")
+
+// ParseVersion reads versions like 1.12.2, anything else (LATEST, snapshots) counts as newest
+func ParseVersion(version string) []int {
+
+	parts := strings.Split(version, ".")
+	parsed := []int{}
+
+	for _, part := range parts {
+		number, err := strconv.Atoi(part)
+
+		if err != nil {
+			return nil
+		}
+
+		parsed = append(parsed, number)
+	}
+
+	return parsed
+}
+
+// AtLeast tells if version is the same as or newer than minimum, unknown versions are newest
+func AtLeast(version string, minimum string) bool {
+
+	current := ParseVersion(version)
+
+	if current == nil {
+		return true
+	}
+
+	required := ParseVersion(minimum)
+
+	for i := 0; i < len(required); i++ {
+		part := 0
+
+		if i < len(current) {
+			part = current[i]
+		}
+
+		if part != required[i] {
+			return part > required[i]
+		}
+	}
+
+	return true
+}
+
+// Supported returns the definitions known to the version
+func Supported(version string) map[string]Definition {
+
+	supported := map[string]Definition{}
+
+	for key, definition := range Definitions {
+		if definition.Since == "" || AtLeast(version, definition.Since) {
+			supported[key] = definition
+		}
+	}
+
+	return supported
+}
+
+func isManaged(key string) bool {
+	for _, managed := range Managed {
+		if managed == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Decode turns the raw value into the typed one, values the server wouldn't accept
+// either are returned as they are
+func (d Definition) Decode(raw string) interface{} {
+
+	switch d.Type {
+	case TYPE_BOOL:
+		value, err := strconv.ParseBool(raw)
+
+		if err != nil {
+			return raw
+		}
+
+		return value
+	case TYPE_INT:
+		value, err := strconv.Atoi(raw)
+
+		if err != nil {
+			return raw
+		}
+
+		return value
+	case TYPE_ENUM:
+		id, err := strconv.Atoi(raw)
+
+		if err == nil && id >= 0 && id < len(d.Values) {
+			return d.Values[id]
+		}
+
+		return strings.ToLower(raw)
+	}
+
+	return raw
+}
+
+// Encode validates a value from a json body and returns it as the version writes it
+func (d Definition) Encode(key string, value interface{}, version string) (string, error) {
+
+	switch d.Type {
+	case TYPE_BOOL:
+		flag, ok := value.(bool)
+
+		if !ok {
+			return "", fmt.Errorf("%s must be a boolean", key)
+		}
+
+		return strconv.FormatBool(flag), nil
+	case TYPE_INT:
+		number, ok := value.(float64)
+
+		if !ok || number != float64(int(number)) {
+			return "", fmt.Errorf("%s must be an integer", key)
+		}
+
+		if int(number) < d.Min || (d.Max != 0 && int(number) > d.Max) {
+			return "", fmt.Errorf("%s must be between %d and %d", key, d.Min, d.Max)
+		}
+
+		return strconv.Itoa(int(number)), nil
+	case TYPE_ENUM:
+		name, ok := value.(string)
+
+		if !ok {
+			return "", fmt.Errorf("%s must be one of %s", key, strings.Join(d.Values, ", "))
+		}
+
+		for id, candidate := range d.Values {
+			if candidate != strings.ToLower(name) {
+				continue
+			}
+
+			if !AtLeast(version, NAMED_ENUMS_SINCE) {
+				return strconv.Itoa(id), nil
+			}
+
+			return candidate, nil
+		}
+
+		return "", fmt.Errorf("%s must be one of %s", key, strings.Join(d.Values, ", "))
+	}
+
+	text, ok := value.(string)
+
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+
+	if d.Max != 0 && len(text) > d.Max {
+		return "", fmt.Errorf("%s can be at most %d characters", key, d.Max)
+	}
+
+	return text, nil
+}
+
+// Apply validates every change against the version before touching the file
+func Apply(file *File, changes map[string]interface{}, version string) error {
+
+	supported := Supported(version)
+	encoded := map[string]string{}
+
+	for key, value := range changes {
+		if isManaged(key) {
+			return fmt.Errorf("%s: %w", key, ErrManaged)
+		}
+
+		definition, ok := supported[key]
+
+		if !ok {
+			return fmt.Errorf("%s isn't a supported property on %s", key, version)
+		}
+
+		raw, err := definition.Encode(key, value, version)
+
+		if err != nil {
+			return err
+		}
+
+		encoded[key] = raw
+	}
+
+	// Sorted so keys new to the file are appended in a stable order
+	keys := make([]string, 0, len(encoded))
+
+	for key := range encoded {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		file.Set(key, encoded[key])
+	}
+
+	return nil
+}
+
+// Typed splits the file into the typed properties the version supports and everything else
+func Typed(file *File, version string) (map[string]interface{}, map[string]string) {
+
+	supported := Supported(version)
+	typed := map[string]interface{}{}
+	other := map[string]string{}
+
+	for key, raw := range file.Values() {
+		if key == "rcon.password" {
+			continue
+		}
+
+		if definition, ok := supported[key]; ok {
+			typed[key] = definition.Decode(raw)
+			continue
+		}
+
+		other[key] = raw
+	}
+
+	return typed, other
+}
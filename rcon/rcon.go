@@ -0,0 +1,188 @@
+package rcon
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	PACKET_RESPONSE = 0
+	PACKET_COMMAND  = 2
+	PACKET_AUTH     = 3
+
+	// Minecraft splits responses into packets with at most this many characters
+	MAX_RESPONSE_BODY = 4096
+	// Largest packet the client accepts: a body of characters taking up to three bytes
+	// in UTF-8, plus id, type and two terminators
+	MAX_PACKET_SIZE = MAX_RESPONSE_BODY*3 + 10
+)
+
+const DEFAULT_PORT = 25575
+
+var ErrAuthFailed = errors.New("rcon authentication failed")
+var ErrPacketTooLarge = errors.New("rcon packet too large")
+
+type Client struct {
+	conn    net.Conn
+	mu      sync.Mutex
+	lastId  int32
+	timeout time.Duration
+}
+
+func Dial(address string, password string, timeout time.Duration) (*Client, error) {
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{
+		conn:    conn,
+		timeout: timeout,
+	}
+
+	err = client.authenticate(password)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) Command(command string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, err := c.send(PACKET_COMMAND, command)
+
+	if err != nil {
+		return "", err
+	}
+
+	// Responses don't tell how many fragments follow. Packets are answered in order, so the
+	// answer to an empty packet sent right after the command marks the end of its response.
+	terminator, err := c.send(PACKET_RESPONSE, "")
+
+	if err != nil {
+		return "", err
+	}
+
+	var response bytes.Buffer
+
+	for {
+		packetId, _, body, err := c.read()
+
+		if err != nil {
+			return "", err
+		}
+
+		if packetId == terminator {
+			return response.String(), nil
+		}
+
+		// Leftovers of earlier commands are skipped
+		if packetId == id {
+			response.WriteString(body)
+		}
+	}
+}
+
+func (c *Client) authenticate(password string) error {
+
+	id, err := c.send(PACKET_AUTH, password)
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		packetId, packetType, _, err := c.read()
+
+		if err != nil {
+			return err
+		}
+
+		// Some servers send an empty response value before the auth response
+		if packetType != PACKET_COMMAND {
+			continue
+		}
+
+		if packetId == -1 || packetId != id {
+			return ErrAuthFailed
+		}
+
+		return nil
+	}
+}
+
+func (c *Client) send(packetType int32, body string) (int32, error) {
+
+	c.lastId++
+	id := c.lastId
+
+	var packet bytes.Buffer
+
+	binary.Write(&packet, binary.LittleEndian, int32(len(body)+10))
+	binary.Write(&packet, binary.LittleEndian, id)
+	binary.Write(&packet, binary.LittleEndian, packetType)
+	packet.WriteString(body)
+	packet.Write([]byte{0, 0})
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+
+	_, err := c.conn.Write(packet.Bytes())
+
+	return id, err
+}
+
+func (c *Client) read() (int32, int32, string, error) {
+
+	c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+
+	var size int32
+
+	err := binary.Read(c.conn, binary.LittleEndian, &size)
+
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	if size < 10 || size > MAX_PACKET_SIZE {
+		return 0, 0, "", ErrPacketTooLarge
+	}
+
+	packet := make([]byte, size)
+
+	_, err = io.ReadFull(c.conn, packet)
+
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	id := int32(binary.LittleEndian.Uint32(packet[0:4]))
+	packetType := int32(binary.LittleEndian.Uint32(packet[4:8]))
+	body := string(bytes.TrimRight(packet[8:], "\x00"))
+
+	return id, packetType, body, nil
+}
+
+func GeneratePassword() string {
+	buffer := make([]byte, 16)
+	rand.Read(buffer)
+
+	return hex.EncodeToString(buffer)
+}
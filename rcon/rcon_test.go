@@ -0,0 +1,269 @@
+package rcon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const PASSWORD = "secret"
+
+type packet struct {
+	id         int32
+	packetType int32
+	body       string
+}
+
+func (p packet) bytes() []byte {
+
+	var buffer bytes.Buffer
+
+	binary.Write(&buffer, binary.LittleEndian, int32(len(p.body)+10))
+	binary.Write(&buffer, binary.LittleEndian, p.id)
+	binary.Write(&buffer, binary.LittleEndian, p.packetType)
+	buffer.WriteString(p.body)
+	buffer.Write([]byte{0, 0})
+
+	return buffer.Bytes()
+}
+
+// fakeServer accepts one connection and writes whatever respond returns for each packet.
+// Like minecraft it answers auth with an empty response value first.
+func fakeServer(t *testing.T, respond func(request packet) [][]byte) string {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		for {
+			var size int32
+
+			if binary.Read(conn, binary.LittleEndian, &size) != nil {
+				return
+			}
+
+			raw := make([]byte, size)
+
+			if _, err := io.ReadFull(conn, raw); err != nil {
+				return
+			}
+
+			request := packet{
+				id:         int32(binary.LittleEndian.Uint32(raw[0:4])),
+				packetType: int32(binary.LittleEndian.Uint32(raw[4:8])),
+				body:       string(bytes.TrimRight(raw[8:], "\x00")),
+			}
+
+			for _, response := range respond(request) {
+				conn.Write(response)
+			}
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// minecraft answers like a server with the password, splitting output into
+// MAX_RESPONSE_BODY sized fragments
+func minecraft(output map[string]string) func(request packet) [][]byte {
+	return func(request packet) [][]byte {
+
+		switch request.packetType {
+		case PACKET_AUTH:
+			id := request.id
+
+			if request.body != PASSWORD {
+				id = -1
+			}
+
+			return [][]byte{packet{request.id, PACKET_RESPONSE, ""}.bytes(), packet{id, PACKET_COMMAND, ""}.bytes()}
+		case PACKET_COMMAND:
+			text := output[request.body]
+			fragments := [][]byte{}
+
+			for len(text) > MAX_RESPONSE_BODY {
+				fragments = append(fragments, packet{request.id, PACKET_RESPONSE, text[:MAX_RESPONSE_BODY]}.bytes())
+				text = text[MAX_RESPONSE_BODY:]
+			}
+
+			return append(fragments, packet{request.id, PACKET_RESPONSE, text}.bytes())
+		default:
+			return [][]byte{packet{request.id, PACKET_RESPONSE, "Unknown request 0"}.bytes()}
+		}
+	}
+}
+
+func TestDial(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		password string
+		expected error
+	}{
+		{"right password", PASSWORD, nil},
+		{"wrong password", "guess", ErrAuthFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			address := fakeServer(t, minecraft(nil))
+
+			client, err := Dial(address, test.password, time.Second)
+
+			if err != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, err)
+			}
+
+			if client != nil {
+				client.Close()
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+
+	long := strings.Repeat("There are 200 of a max of 200 players online: ", 300)
+
+	tests := []struct {
+		name    string
+		command string
+		output  string
+	}{
+		{"single packet", "list", "There are 0 of a max of 20 players online: "},
+		{"empty", "save-all flush", ""},
+		{"exactly one full packet", "help 1", strings.Repeat("a", MAX_RESPONSE_BODY)},
+		{"multiple packets", "list uuids", long},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			address := fakeServer(t, minecraft(map[string]string{test.command: test.output}))
+
+			client, err := Dial(address, PASSWORD, time.Second)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer client.Close()
+
+			response, err := client.Command(test.command)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if response != test.output {
+				t.Errorf("got %d characters, want %d", len(response), len(test.output))
+			}
+		})
+	}
+}
+
+func TestCommandSkipsStaleResponses(t *testing.T) {
+
+	respond := minecraft(map[string]string{"list": "players"})
+
+	address := fakeServer(t, func(request packet) [][]byte {
+
+		responses := respond(request)
+
+		// A late fragment of an earlier command arrives before the answer
+		if request.packetType == PACKET_COMMAND {
+			responses = append([][]byte{packet{request.id - 1, PACKET_RESPONSE, "stale"}.bytes()}, responses...)
+		}
+
+		return responses
+	})
+
+	client, err := Dial(address, PASSWORD, time.Second)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	response, err := client.Command("list")
+
+	if err != nil || response != "players" {
+		t.Fatalf("got %q (%v), want the answer without the stale fragment", response, err)
+	}
+}
+
+func TestPacketSizeLimit(t *testing.T) {
+
+	oversized := func(size int32) []byte {
+
+		var buffer bytes.Buffer
+		binary.Write(&buffer, binary.LittleEndian, size)
+
+		return buffer.Bytes()
+	}
+
+	tests := []struct {
+		name     string
+		response []byte
+		expected error
+	}{
+		{"largest allowed packet", packet{2, PACKET_RESPONSE, strings.Repeat("é", MAX_PACKET_SIZE/2-5)}.bytes(), nil},
+		{"too large", oversized(MAX_PACKET_SIZE + 1), ErrPacketTooLarge},
+		{"negative size", oversized(-1), ErrPacketTooLarge},
+		{"smaller than the header", oversized(9), ErrPacketTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			respond := minecraft(nil)
+
+			address := fakeServer(t, func(request packet) [][]byte {
+
+				if request.packetType == PACKET_COMMAND {
+					return [][]byte{test.response, packet{request.id + 1, PACKET_RESPONSE, ""}.bytes()}
+				}
+
+				if request.packetType == PACKET_RESPONSE {
+					return nil
+				}
+
+				return respond(request)
+			})
+
+			client, err := Dial(address, PASSWORD, time.Second)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer client.Close()
+
+			_, err = client.Command("list")
+
+			if err != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package routes
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/auth"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+type ApiKeyBody struct {
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	ServerID uint     `json:"server_id"`
+	// Go duration like 720h, empty for keys that don't expire
+	ExpiresIn string `json:"expires_in"`
+}
+
+// The only route a browser opens as a websocket
+const CONSOLE_ROUTE = "/servers/:id/console"
+
+// Keys are sent as "Authorization: Bearer <key>" (or the bare key). Browsers can't set
+// headers on websocket connections, so ?token= is accepted for the console upgrade only,
+// query strings end up in access logs.
+func requestToken(c *gin.Context) string {
+
+	header := c.GetHeader("Authorization")
+
+	if header != "" {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+
+	if c.FullPath() == CONSOLE_ROUTE && websocket.IsWebSocketUpgrade(c.Request) {
+		return c.Query("token")
+	}
+
+	return ""
+}
+
+// Server bound keys (issued to containers) only work on their own /servers/:id routes
+func isServerRoute(c *gin.Context) bool {
+	return strings.HasPrefix(c.FullPath(), "/servers/:id") || strings.HasPrefix(c.FullPath(), "/server/:id")
+}
+
+func isBoundElsewhere(c *gin.Context, key db.ApiKey) bool {
+	return key.ServerID != 0 && (!isServerRoute(c) || c.Param("id") != strconv.Itoa(int(key.ServerID)))
+}
+
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key, err := auth.Authenticate(requestToken(c))
+
+		if err != nil {
+			c.AbortWithStatusJSON(401, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		if !auth.HasScope(key, scope) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "missing scope " + scope})
+			return
+		}
+
+		if isBoundElsewhere(c, key) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "key is bound to another server"})
+			return
+		}
+
+		c.Set("api_key", key)
+		c.Next()
+	}
+}
+
+// AllowPublic lets anonymous callers through to the public view of a route. Callers
+// presenting a key with the scope get the full view, an invalid key is still rejected.
+func AllowPublic(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		token := requestToken(c)
+
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		key, err := auth.Authenticate(token)
+
+		if err != nil {
+			c.AbortWithStatusJSON(401, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		if auth.HasScope(key, scope) && !isBoundElsewhere(c, key) {
+			c.Set("api_key", key)
+		}
+
+		c.Next()
+	}
+}
+
+// isAuthenticated tells handlers behind AllowPublic which view to render
+func isAuthenticated(c *gin.Context) bool {
+	_, ok := c.Get("api_key")
+
+	return ok
+}
+
+// callerHasScope checks the key RequireScope let through for a further scope
+func callerHasScope(c *gin.Context, scope string) bool {
+
+	value, ok := c.Get("api_key")
+
+	return ok && auth.HasScope(value.(db.ApiKey), scope)
+}
+
+func GetApiKeys(c *gin.Context) {
+	keys := []db.ApiKey{}
+	db.OpenedConnection.Order("id").Find(&keys)
+	c.JSON(200, keys)
+}
+
+func CreateApiKey(c *gin.Context) {
+
+	var body ApiKeyBody
+
+	if c.BindJSON(&body) != nil || body.Name == "" || len(body.Scopes) == 0 {
+		c.JSON(400, gin.H{"error": "name and scopes are required"})
+		return
+	}
+
+	for _, scope := range body.Scopes {
+		if !auth.IsValidScope(scope) {
+			c.JSON(400, gin.H{"error": "unknown scope " + scope})
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+
+	if body.ExpiresIn != "" {
+		duration, err := time.ParseDuration(body.ExpiresIn)
+
+		if err != nil || duration <= 0 {
+			c.JSON(400, gin.H{"error": "invalid expires_in"})
+			return
+		}
+
+		expiration := time.Now().Add(duration)
+		expiresAt = &expiration
+	}
+
+	key, plain, err := auth.CreateKey(body.Name, body.Scopes, body.ServerID, expiresAt)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The plain key is never stored, this is the only time it can be read
+	c.JSON(200, gin.H{"key": plain, "api_key": key})
+}
+
+func RevokeApiKey(c *gin.Context) {
+	key := db.ApiKey{}
+	db.OpenedConnection.First(&key, c.Param("id"))
+
+	if key.ID == 0 {
+		c.JSON(404, gin.H{"error": "api key not found"})
+		return
+	}
+
+	db.OpenedConnection.Model(&key).Update("revoked", true)
+	c.JSON(200, gin.H{"status": "ok"})
+}
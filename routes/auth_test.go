@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestToken(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		route     string
+		url       string
+		header    string
+		websocket bool
+		expected  string
+	}{
+		{"header", "/servers/:id", "/servers/1", "Bearer key", false, "key"},
+		{"bare header", "/servers/:id", "/servers/1", "key", false, "key"},
+		{"query on console upgrade", CONSOLE_ROUTE, "/servers/1/console?token=key", "", true, "key"},
+		{"header wins on console upgrade", CONSOLE_ROUTE, "/servers/1/console?token=other", "Bearer key", true, "key"},
+		{"query on plain console request", CONSOLE_ROUTE, "/servers/1/console?token=key", "", false, ""},
+		{"query elsewhere", "/servers/:id", "/servers/1?token=key", "", true, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			token := ""
+			r := gin.New()
+			r.GET(test.route, func(c *gin.Context) {
+				token = requestToken(c)
+			})
+
+			request := httptest.NewRequest("GET", test.url, nil)
+
+			if test.header != "" {
+				request.Header.Set("Authorization", test.header)
+			}
+
+			if test.websocket {
+				request.Header.Set("Connection", "Upgrade")
+				request.Header.Set("Upgrade", "websocket")
+			}
+
+			r.ServeHTTP(httptest.NewRecorder(), request)
+
+			if token != test.expected {
+				t.Fatalf("expected token %q, got %q", test.expected, token)
+			}
+		})
+	}
+}
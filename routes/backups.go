@@ -0,0 +1,177 @@
+package routes
+
+import (
+	"context"
+	"io"
+	"path"
+	"strconv"
+
+	"github.com/Lisek-World-Reborn/lisek-api/backups"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/gin-gonic/gin"
+)
+
+func GetBackups(c *gin.Context) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return
+	}
+
+	list := []db.Backup{}
+	db.OpenedConnection.Where("server_id = ?", server.ID).Order("created_at DESC").Find(&list)
+
+	c.JSON(200, list)
+}
+
+func GetBackup(c *gin.Context) {
+
+	_, backup, ok := findBackup(c)
+
+	if !ok {
+		return
+	}
+
+	c.JSON(200, backup)
+}
+
+func CreateBackup(c *gin.Context) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return
+	}
+
+	backup, job, err := backups.StartBackup(server)
+
+	if err == backups.ErrOperationRunning {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(202, gin.H{"backup": backup, "job": job})
+}
+
+func DownloadBackup(c *gin.Context) {
+
+	_, backup, ok := findBackup(c)
+
+	if !ok {
+		return
+	}
+
+	if backup.Status != db.BACKUP_READY {
+		c.JSON(409, gin.H{"error": backups.ErrBackupNotReady.Error()})
+		return
+	}
+
+	data, err := backups.BackupStorage.Get(context.Background(), backup.Object)
+
+	if err == backups.ErrObjectNotFound {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	defer data.Close()
+
+	c.Header("Content-Type", "application/zstd")
+	c.Header("Content-Disposition", "attachment; filename=\""+path.Base(backup.Object)+"\"")
+
+	if backup.Size > 0 {
+		c.Header("Content-Length", strconv.FormatInt(backup.Size, 10))
+	}
+
+	c.Status(200)
+	io.Copy(c.Writer, data)
+}
+
+func DeleteBackup(c *gin.Context) {
+
+	_, backup, ok := findBackup(c)
+
+	if !ok {
+		return
+	}
+
+	if backup.Status == db.BACKUP_CREATING {
+		c.JSON(409, gin.H{"error": backups.ErrOperationRunning.Error()})
+		return
+	}
+
+	err := backups.DeleteBackup(context.Background(), backup)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+func RestoreBackup(c *gin.Context) {
+
+	server, backup, ok := findBackup(c)
+
+	if !ok {
+		return
+	}
+
+	job, err := backups.StartRestore(server, backup)
+
+	if err == backups.ErrServerRunning || err == backups.ErrOperationRunning || err == backups.ErrBackupNotReady {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(202, gin.H{"job": job})
+}
+
+func findServer(c *gin.Context) (db.Server, bool) {
+
+	server := db.Server{}
+	db.OpenedConnection.First(&server, c.Param("id"))
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return server, false
+	}
+
+	return server, true
+}
+
+// Backups are only found under the server they belong to
+func findBackup(c *gin.Context) (db.Server, db.Backup, bool) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return server, db.Backup{}, false
+	}
+
+	backup := db.Backup{}
+	db.OpenedConnection.Where("server_id = ?", server.ID).First(&backup, c.Param("backup"))
+
+	if backup.ID == 0 {
+		c.JSON(404, gin.H{"error": "backup not found"})
+		return server, backup, false
+	}
+
+	return server, backup, true
+}
@@ -0,0 +1,261 @@
+package routes
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/docker"
+	"github.com/Lisek-World-Reborn/lisek-api/logger"
+	"github.com/Lisek-World-Reborn/lisek-api/rcon"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+type ConsoleMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+type ConsoleCommand struct {
+	Command string `json:"command"`
+}
+
+var consoleUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Clients authenticate with an api key, so the origin doesn't matter
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+func consoleLogOptions(c *gin.Context) docker.LogOptions {
+	return docker.LogOptions{
+		Follow:     true,
+		Tail:       c.DefaultQuery("tail", "100"),
+		Timestamps: c.Query("timestamps") == "true",
+	}
+}
+
+func ServerConsole(c *gin.Context) {
+
+	server := db.Server{}
+	db.OpenedConnection.First(&server, c.Param("id"))
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		streamConsoleWebSocket(c, server)
+	} else {
+		streamConsoleEvents(c, server)
+	}
+}
+
+func streamConsoleWebSocket(c *gin.Context, server db.Server) {
+
+	conn, err := consoleUpgrader.Upgrade(c.Writer, c.Request, nil)
+
+	if err != nil {
+		logger.Error("Error upgrading console connection: " + err.Error())
+		return
+	}
+
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var writeMutex sync.Mutex
+
+	send := func(message ConsoleMessage) error {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+		return conn.WriteJSON(message)
+	}
+
+	logs, err := docker.ServerLogs(ctx, server, consoleLogOptions(c))
+
+	if err != nil {
+		send(ConsoleMessage{Type: "error", Data: err.Error()})
+		return
+	}
+
+	defer logs.Close()
+
+	go func() {
+		defer cancel()
+
+		scanner := bufio.NewScanner(logs)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			if send(ConsoleMessage{Type: "log", Data: scanner.Text()}) != nil {
+				return
+			}
+		}
+
+		send(ConsoleMessage{Type: "closed", Data: "log stream ended"})
+	}()
+
+	go func() {
+		<-ctx.Done()
+		// Unblocks ReadJSON below once the log stream is gone
+		logs.Close()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	for {
+		var command ConsoleCommand
+
+		err := conn.ReadJSON(&command)
+
+		if err != nil {
+			return
+		}
+
+		command.Command = strings.TrimSpace(command.Command)
+
+		if command.Command == "" {
+			continue
+		}
+
+		logger.Info("Console command for server " + server.Name + ": " + command.Command)
+
+		output, err := docker.ExecConsoleCommand(ctx, server, command.Command)
+
+		if err != nil {
+			send(ConsoleMessage{Type: "error", Data: err.Error()})
+			continue
+		}
+
+		send(ConsoleMessage{Type: "output", Data: output})
+	}
+}
+
+func streamConsoleEvents(c *gin.Context, server db.Server) {
+
+	logs, err := docker.ServerLogs(c.Request.Context(), server, consoleLogOptions(c))
+
+	if err == docker.ErrContainerNotFound {
+		c.JSON(404, gin.H{"error": "container not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	defer logs.Close()
+
+	lines := make(chan string)
+
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(logs)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	}()
+
+	c.Stream(func(w io.Writer) bool {
+		line, ok := <-lines
+
+		if !ok {
+			c.SSEvent("closed", "log stream ended")
+			return false
+		}
+
+		c.SSEvent("log", line)
+		return true
+	})
+}
+
+// Command endpoint for clients on the SSE fallback
+func PostConsoleCommand(c *gin.Context) {
+
+	server := db.Server{}
+	db.OpenedConnection.First(&server, c.Param("id"))
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
+	}
+
+	var command ConsoleCommand
+
+	if c.BindJSON(&command) != nil || strings.TrimSpace(command.Command) == "" {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+
+	output, err := docker.ExecConsoleCommand(c.Request.Context(), server, strings.TrimSpace(command.Command))
+
+	if err == docker.ErrContainerNotFound {
+		c.JSON(404, gin.H{"error": "container not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error(), "output": output})
+		return
+	}
+
+	c.JSON(200, gin.H{"output": output})
+}
+
+func ServerCommand(c *gin.Context) {
+
+	server := db.Server{}
+	db.OpenedConnection.First(&server, c.Param("id"))
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
+	}
+
+	var command ConsoleCommand
+
+	if c.BindJSON(&command) != nil || strings.TrimSpace(command.Command) == "" {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+
+	output, err := docker.RconCommand(server, strings.TrimSpace(command.Command))
+
+	if err == docker.ErrNoRconCredentials {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err == rcon.ErrAuthFailed {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(504, gin.H{"error": "rcon unreachable: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"output": output})
+}
@@ -0,0 +1,278 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/files"
+	"github.com/Lisek-World-Reborn/lisek-api/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type RenameBody struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Every route takes the path relative to the server directory as ?path=
+func GetFiles(c *gin.Context) {
+
+	_, root, ok := findServerRoot(c)
+
+	if !ok {
+		return
+	}
+
+	entries, err := files.List(root, c.DefaultQuery("path", "/"))
+
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	c.JSON(200, entries)
+}
+
+func ReadFile(c *gin.Context) {
+
+	_, root, ok := findServerRoot(c)
+
+	if !ok {
+		return
+	}
+
+	content, err := files.Read(root, c.Query("path"))
+
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"path": c.Query("path"), "size": len(content), "content": string(content)})
+}
+
+// WriteFile replaces the file with the raw request body
+func WriteFile(c *gin.Context) {
+
+	server, root, ok := findServerRoot(c)
+
+	if !ok {
+		return
+	}
+
+	size, err := files.Write(root, c.Query("path"), c.Request.Body, files.MAX_EDIT_SIZE)
+
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	auditFileChange(c, server, "write", c.Query("path"), "", size)
+	c.JSON(200, gin.H{"status": "ok", "size": size})
+}
+
+// UploadFile stores the multipart field "file" in the directory ?path=
+func UploadFile(c *gin.Context) {
+
+	server, root, ok := findServerRoot(c)
+
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, files.MAX_UPLOAD_SIZE+1<<20)
+
+	header, err := c.FormFile("file")
+
+	if err != nil {
+		c.JSON(400, gin.H{"error": "missing or too large file field"})
+		return
+	}
+
+	upload, err := header.Open()
+
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	defer upload.Close()
+
+	target := path.Join("/", c.DefaultQuery("path", "/"), path.Base(header.Filename))
+
+	size, err := files.Write(root, target, upload, files.MAX_UPLOAD_SIZE)
+
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	auditFileChange(c, server, "upload", target, "", size)
+	c.JSON(200, gin.H{"status": "ok", "path": target, "size": size})
+}
+
+func DownloadFile(c *gin.Context) {
+
+	_, root, ok := findServerRoot(c)
+
+	if !ok {
+		return
+	}
+
+	file, info, err := files.Open(root, c.Query("path"))
+
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	defer file.Close()
+
+	c.Header("Content-Disposition", "attachment; filename=\""+info.Name()+"\"")
+	c.Header("Content-Length", strconv.FormatInt(info.Size(), 10))
+	c.Status(200)
+	io.Copy(c.Writer, file)
+}
+
+func CreateDirectory(c *gin.Context) {
+
+	server, root, ok := findServerRoot(c)
+
+	if !ok {
+		return
+	}
+
+	err := files.Mkdir(root, c.Query("path"))
+
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	auditFileChange(c, server, "mkdir", c.Query("path"), "", 0)
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+func RenameFile(c *gin.Context) {
+
+	server, root, ok := findServerRoot(c)
+
+	if !ok {
+		return
+	}
+
+	var body RenameBody
+
+	if c.BindJSON(&body) != nil || body.From == "" || body.To == "" {
+		c.JSON(400, gin.H{"error": "from and to are required"})
+		return
+	}
+
+	err := files.Rename(root, body.From, body.To)
+
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	auditFileChange(c, server, "rename", body.From, body.To, 0)
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+// DeleteFile removes directories with their content only with ?recursive=true
+func DeleteFile(c *gin.Context) {
+
+	server, root, ok := findServerRoot(c)
+
+	if !ok {
+		return
+	}
+
+	err := files.Delete(root, c.Query("path"), c.Query("recursive") == "true")
+
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	auditFileChange(c, server, "delete", c.Query("path"), "", 0)
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+func GetFileChanges(c *gin.Context) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return
+	}
+
+	changes := []db.FileChange{}
+	db.OpenedConnection.Where("server_id = ?", server.ID).Order("created_at DESC").Limit(200).Find(&changes)
+
+	c.JSON(200, changes)
+}
+
+func auditFileChange(c *gin.Context, server db.Server, action string, filePath string, target string, size int64) {
+
+	change := db.FileChange{
+		ServerID: server.ID,
+		Action:   action,
+		Path:     filePath,
+		Target:   target,
+		Size:     size,
+		IP:       c.ClientIP(),
+	}
+
+	if value, ok := c.Get("api_key"); ok {
+		key := value.(db.ApiKey)
+		change.ApiKeyID = key.ID
+		change.ApiKey = key.Name
+	}
+
+	err := db.OpenedConnection.Create(&change).Error
+
+	if err != nil {
+		logger.Error("Error recording file change of server " + server.Name + ": " + err.Error())
+	}
+}
+
+func fileError(c *gin.Context, err error) {
+
+	switch {
+	case errors.Is(err, files.ErrNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, files.ErrTooLarge):
+		c.JSON(413, gin.H{"error": err.Error()})
+	case errors.Is(err, files.ErrExists):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case errors.Is(err, files.ErrInvalidPath), errors.Is(err, files.ErrOutsideRoot),
+		errors.Is(err, files.ErrRootPath), errors.Is(err, files.ErrIsDirectory), errors.Is(err, files.ErrDanglingLink):
+		c.JSON(400, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// findServerRoot is findServer for routes that work inside the server's data directory
+func findServerRoot(c *gin.Context) (db.Server, string, bool) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return server, "", false
+	}
+
+	root, err := files.Root(server)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return server, "", false
+	}
+
+	return server, root, true
+}
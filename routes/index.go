@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
 	"github.com/gin-gonic/gin"
 	"github.com/mackerelio/go-osstat/cpu"
 	"github.com/mackerelio/go-osstat/memory"
@@ -49,3 +50,8 @@ func GetSystemLoad(c *gin.Context) {
 		"notes": notes,
 	})
 }
+
+func GetDispatcherHandlers(c *gin.Context) {
+
+	c.JSON(200, channels.RequestDispatcher.Stats())
+}
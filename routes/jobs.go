@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"strconv"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/gin-gonic/gin"
+)
+
+func GetJob(c *gin.Context) {
+	job := db.Job{}
+	db.OpenedConnection.First(&job, c.Param("id"))
+
+	if job.ID == 0 {
+		c.JSON(404, gin.H{"error": "job not found"})
+		return
+	}
+
+	c.JSON(200, job)
+}
+
+func GetJobs(c *gin.Context) {
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(400, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	query := db.OpenedConnection.Order("id desc").Limit(limit)
+
+	if serverId := c.Query("server_id"); serverId != "" {
+		query = query.Where("server_id = ?", serverId)
+	}
+
+	if phase := c.Query("phase"); phase != "" {
+		query = query.Where("phase = ?", phase)
+	}
+
+	jobs := []db.Job{}
+	query.Find(&jobs)
+
+	c.JSON(200, jobs)
+}
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/gin-gonic/gin"
+)
+
+func GetSigningKeys(c *gin.Context) {
+
+	keys := []db.SigningKey{}
+	db.OpenedConnection.Where("server_id = ?", c.Param("id")).Order("created_at desc").Find(&keys)
+
+	c.JSON(200, keys)
+}
+
+// The new key is returned once with its secret, the server container has to be
+// recreated (or the plugin reconfigured) before the grace period of the old keys ends
+func RotateSigningKey(c *gin.Context) {
+
+	server := db.Server{}
+	db.OpenedConnection.First(&server, c.Param("id"))
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
+	}
+
+	grace, err := time.ParseDuration(c.DefaultQuery("grace", "24h"))
+
+	if err != nil || grace < 0 {
+		c.JSON(400, gin.H{"error": "invalid grace period"})
+		return
+	}
+
+	key, err := channels.RotateSigningKey(server.ID, grace)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"key_id": key.KeyID, "secret": key.Secret, "created_at": key.CreatedAt})
+}
+
+// The proxy verifies api events like players:authenticated with this key
+func GetEventSigningKey(c *gin.Context) {
+
+	key, err := channels.ActiveSigningKey(channels.EVENTS_SERVER_ID)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"key_id": key.KeyID, "secret": key.Secret, "created_at": key.CreatedAt})
+}
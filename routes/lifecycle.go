@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/docker"
+	"github.com/gin-gonic/gin"
+)
+
+func StartServer(c *gin.Context) {
+	runLifecycleAction(c, func(server *db.Server) error {
+		return docker.StartServer(server)
+	})
+}
+
+func StopServer(c *gin.Context) {
+
+	timeout, ok := stopTimeout(c)
+
+	if !ok {
+		return
+	}
+
+	runLifecycleAction(c, func(server *db.Server) error {
+		return docker.StopServer(server, timeout)
+	})
+}
+
+func RestartServer(c *gin.Context) {
+
+	timeout, ok := stopTimeout(c)
+
+	if !ok {
+		return
+	}
+
+	runLifecycleAction(c, func(server *db.Server) error {
+		return docker.RestartServer(server, timeout)
+	})
+}
+
+func KillServer(c *gin.Context) {
+
+	signal := c.DefaultQuery("signal", "SIGKILL")
+
+	runLifecycleAction(c, func(server *db.Server) error {
+		return docker.KillServer(server, signal)
+	})
+}
+
+func runLifecycleAction(c *gin.Context, action func(server *db.Server) error) {
+
+	server := db.Server{}
+	db.OpenedConnection.First(&server, c.Param("id"))
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
+	}
+
+	err := action(&server)
+
+	if err == docker.ErrContainerNotFound {
+		c.JSON(404, gin.H{"error": "container not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "ok", "state": server.State})
+}
+
+// Graceful stop timeout in seconds, docker's default is used when not set
+func stopTimeout(c *gin.Context) (*time.Duration, bool) {
+
+	value := c.Query("timeout")
+
+	if value == "" {
+		return nil, true
+	}
+
+	seconds, err := strconv.Atoi(value)
+
+	if err != nil || seconds < 0 {
+		c.JSON(400, gin.H{"error": "invalid timeout"})
+		return nil, false
+	}
+
+	timeout := time.Duration(seconds) * time.Second
+
+	return &timeout, true
+}
@@ -0,0 +1,160 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type LinkBody struct {
+	Code      string `json:"code"`
+	DiscordID uint64 `json:"discord_id,string"`
+}
+
+// CreateLinkCode is called by the game server when a player runs /link. It's also routed
+// under /servers/:id so the server's own key can be used, a server can then only create
+// codes for players that are logged in on it.
+func CreateLinkCode(c *gin.Context) {
+
+	user, ok := findPlayer(c)
+
+	if !ok {
+		return
+	}
+
+	if serverId := c.Param("id"); serverId != "" {
+		session := db.PlayerSession{}
+		db.OpenedConnection.
+			Where("user_id = ? AND server_id = ? AND revoked = ? AND expires_at > ?", user.ID, serverId, false, time.Now()).
+			First(&session)
+
+		if session.ID == 0 {
+			c.JSON(403, gin.H{"error": "player has no session on this server"})
+			return
+		}
+	}
+
+	code, err := channels.CreateLinkCode(context.Background(), user.UUID)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":       code,
+		"expires_at": time.Now().Add(channels.LINK_CODE_TTL),
+	})
+}
+
+// RedeemLinkCode is called by the discord bot with the code the player sent it
+func RedeemLinkCode(c *gin.Context) {
+
+	var body LinkBody
+
+	if c.BindJSON(&body) != nil || body.Code == "" || body.DiscordID == 0 {
+		c.JSON(400, gin.H{"error": "code and discord_id are required"})
+		return
+	}
+
+	taken := db.User{}
+	db.OpenedConnection.Table("users").Where("discord_id = ?", body.DiscordID).First(&taken)
+
+	// Checked before redeeming so the code isn't burned
+	if taken.ID != 0 {
+		c.JSON(409, gin.H{"error": "discord account is already linked to " + taken.Username})
+		return
+	}
+
+	uuid, err := channels.RedeemLinkCode(context.Background(), strings.ToUpper(strings.TrimSpace(body.Code)))
+
+	if err == channels.ErrInvalidLinkCode {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := db.FindUserByUUID(uuid)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "player not found"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	previous := user.DiscordID
+	user.DiscordID = body.DiscordID
+
+	err = db.OpenedConnection.Table("users").Where("id = ?", user.ID).Update("discord_id", user.DiscordID).Error
+
+	// Another redeem for the same account won the race since the check above
+	if db.IsUniqueViolation(err) {
+		c.JSON(409, gin.H{"error": "discord account is already linked to another player"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if previous != 0 {
+		channels.PublishLinkEvent("players:unlinked", channels.LinkEvent{
+			UUID:      user.UUID,
+			Username:  user.Username,
+			DiscordID: previous,
+		})
+	}
+
+	channels.PublishLinkEvent("players:linked", channels.LinkEvent{
+		UUID:      user.UUID,
+		Username:  user.Username,
+		DiscordID: user.DiscordID,
+	})
+
+	c.JSON(200, user)
+}
+
+func UnlinkPlayer(c *gin.Context) {
+
+	user, ok := findPlayer(c)
+
+	if !ok {
+		return
+	}
+
+	if user.DiscordID == 0 {
+		c.JSON(404, gin.H{"error": "player has no linked discord account"})
+		return
+	}
+
+	err := db.OpenedConnection.Table("users").Where("id = ?", user.ID).Update("discord_id", 0).Error
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	channels.PublishLinkEvent("players:unlinked", channels.LinkEvent{
+		UUID:      user.UUID,
+		Username:  user.Username,
+		DiscordID: user.DiscordID,
+	})
+
+	user.DiscordID = 0
+	c.JSON(200, user)
+}
@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"strconv"
+
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/gin-gonic/gin"
+)
+
+func GetPendingMessages(c *gin.Context) {
+
+	if !channels.UseStreams() {
+		c.JSON(409, gin.H{"error": "messaging mode is not streams"})
+		return
+	}
+
+	server := db.Server{}
+	db.OpenedConnection.First(&server, c.Param("id"))
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
+	}
+
+	report, err := channels.GetPendingReport(c.Request.Context(), server.ID)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, report)
+}
+
+func GetHeartbeats(c *gin.Context) {
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "60"))
+
+	if err != nil || limit < 1 || limit > 1000 {
+		c.JSON(400, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	heartbeats := []db.Heartbeat{}
+	db.OpenedConnection.Where("server_id = ?", c.Param("id")).Order("created_at desc").Limit(limit).Find(&heartbeats)
+
+	c.JSON(200, heartbeats)
+}
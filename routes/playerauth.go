@@ -0,0 +1,237 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/Lisek-World-Reborn/lisek-api/auth"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/gin-gonic/gin"
+)
+
+// ip is the player's address as seen by the proxy, not the caller's. server_id is the
+// server the proxy is connecting the player to, 0 when it isn't known yet.
+type PlayerAuthBody struct {
+	Password string `json:"password"`
+	IP       string `json:"ip"`
+	ServerID uint   `json:"server_id"`
+}
+
+type PlayerPasswordBody struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+	IP          string `json:"ip"`
+}
+
+type PlayerSessionBody struct {
+	Token    string `json:"token"`
+	IP       string `json:"ip"`
+	ServerID uint   `json:"server_id"`
+}
+
+type PlayerConnectBody struct {
+	ServerID uint `json:"server_id"`
+}
+
+func RegisterPlayerPassword(c *gin.Context) {
+
+	user, ok := findPlayer(c)
+
+	if !ok {
+		return
+	}
+
+	var body PlayerAuthBody
+
+	if c.BindJSON(&body) != nil || body.IP == "" {
+		c.JSON(400, gin.H{"error": "password and ip are required"})
+		return
+	}
+
+	if !serverExists(c, body.ServerID) {
+		return
+	}
+
+	token, session, err := auth.RegisterPlayer(user, body.Password, body.IP, body.ServerID)
+
+	if err != nil {
+		playerAuthError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"token": token, "expires_at": session.ExpiresAt})
+}
+
+func LoginPlayerPassword(c *gin.Context) {
+
+	user, ok := findPlayer(c)
+
+	if !ok {
+		return
+	}
+
+	var body PlayerAuthBody
+
+	if c.BindJSON(&body) != nil || body.IP == "" {
+		c.JSON(400, gin.H{"error": "password and ip are required"})
+		return
+	}
+
+	if !serverExists(c, body.ServerID) {
+		return
+	}
+
+	token, session, err := auth.LoginPlayer(context.Background(), user, body.Password, body.IP, body.ServerID)
+
+	if err != nil {
+		playerAuthError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"token": token, "expires_at": session.ExpiresAt})
+}
+
+func ChangePlayerPassword(c *gin.Context) {
+
+	user, ok := findPlayer(c)
+
+	if !ok {
+		return
+	}
+
+	var body PlayerPasswordBody
+
+	if c.BindJSON(&body) != nil || body.IP == "" {
+		c.JSON(400, gin.H{"error": "old_password, new_password and ip are required"})
+		return
+	}
+
+	err := auth.ChangePlayerPassword(context.Background(), user, body.OldPassword, body.NewPassword, body.IP)
+
+	if err != nil {
+		playerAuthError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+func ResumePlayerSession(c *gin.Context) {
+
+	user, ok := findPlayer(c)
+
+	if !ok {
+		return
+	}
+
+	var body PlayerSessionBody
+
+	if c.BindJSON(&body) != nil || body.Token == "" || body.IP == "" {
+		c.JSON(400, gin.H{"error": "token and ip are required"})
+		return
+	}
+
+	if !serverExists(c, body.ServerID) {
+		return
+	}
+
+	session, err := auth.ResumeSession(user, body.Token, body.IP, body.ServerID)
+
+	if err != nil {
+		playerAuthError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "ok", "expires_at": session.ExpiresAt})
+}
+
+// ConnectPlayer is called by the proxy when it moves a logged in player to another server
+func ConnectPlayer(c *gin.Context) {
+
+	user, ok := findPlayer(c)
+
+	if !ok {
+		return
+	}
+
+	var body PlayerConnectBody
+
+	if c.BindJSON(&body) != nil || body.ServerID == 0 {
+		c.JSON(400, gin.H{"error": "server_id is required"})
+		return
+	}
+
+	if !serverExists(c, body.ServerID) {
+		return
+	}
+
+	err := auth.ConnectPlayer(user, body.ServerID)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+func LogoutPlayer(c *gin.Context) {
+
+	user, ok := findPlayer(c)
+
+	if !ok {
+		return
+	}
+
+	err := auth.RevokePlayerSessions(user)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+// serverExists accepts 0 for callers that don't know the player's server
+func serverExists(c *gin.Context, serverId uint) bool {
+
+	if serverId == 0 {
+		return true
+	}
+
+	server := db.Server{}
+	db.OpenedConnection.Select("id").First(&server, serverId)
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return false
+	}
+
+	return true
+}
+
+func playerAuthError(c *gin.Context, err error) {
+
+	var lockout *auth.LockoutError
+
+	if errors.As(err, &lockout) {
+		c.Header("Retry-After", strconv.Itoa(int(lockout.RetryAfter.Seconds())))
+		c.JSON(429, gin.H{"error": err.Error(), "retry_after": int(lockout.RetryAfter.Seconds())})
+		return
+	}
+
+	switch err {
+	case auth.ErrWeakPassword:
+		c.JSON(400, gin.H{"error": err.Error()})
+	case auth.ErrAlreadyRegistered:
+		c.JSON(409, gin.H{"error": err.Error()})
+	case auth.ErrNotRegistered:
+		c.JSON(404, gin.H{"error": err.Error()})
+	case auth.ErrWrongPassword, auth.ErrInvalidSession:
+		c.JSON(401, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
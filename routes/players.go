@@ -0,0 +1,300 @@
+package routes
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_PAGE_SIZE = 50
+	MAX_PAGE_SIZE     = 200
+)
+
+type PlayerBody struct {
+	UUID      string `json:"uuid"`
+	Username  string `json:"username"`
+	DiscordID uint64 `json:"discord_id,string"`
+	Gender    string `json:"gender"`
+}
+
+// Fields left out of the body are not changed
+type PlayerUpdateBody struct {
+	Username  *string `json:"username"`
+	DiscordID *uint64 `json:"discord_id,string"`
+	Gender    *string `json:"gender"`
+	Registred *bool   `json:"registred"`
+}
+
+type PlayerLoginBody struct {
+	IP string `json:"ip"`
+}
+
+type PlayerPage struct {
+	Players []db.User `json:"players"`
+	Total   int64     `json:"total"`
+	Page    int       `json:"page"`
+	PerPage int       `json:"per_page"`
+}
+
+// GetPlayers searches players. Filters: q (username prefix), username, discord_id, registred.
+func GetPlayers(c *gin.Context) {
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+
+	if err != nil || page < 1 {
+		c.JSON(400, gin.H{"error": "invalid page"})
+		return
+	}
+
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(DEFAULT_PAGE_SIZE)))
+
+	if err != nil || perPage < 1 || perPage > MAX_PAGE_SIZE {
+		c.JSON(400, gin.H{"error": "per_page must be between 1 and " + strconv.Itoa(MAX_PAGE_SIZE)})
+		return
+	}
+
+	query := db.OpenedConnection.Table("users")
+
+	if q := c.Query("q"); q != "" {
+		// Escape LIKE wildcards, usernames may contain _
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q)
+		query = query.Where("username ILIKE ?", escaped+"%")
+	}
+
+	if username := c.Query("username"); username != "" {
+		query = query.Where("LOWER(username) = LOWER(?)", username)
+	}
+
+	if discordId := c.Query("discord_id"); discordId != "" {
+		id, err := strconv.ParseUint(discordId, 10, 64)
+
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid discord_id"})
+			return
+		}
+
+		query = query.Where("discord_id = ?", id)
+	}
+
+	if registred := c.Query("registred"); registred != "" {
+		value, err := strconv.ParseBool(registred)
+
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid registred"})
+			return
+		}
+
+		query = query.Where("registred = ?", value)
+	}
+
+	response := PlayerPage{
+		Players: []db.User{},
+		Page:    page,
+		PerPage: perPage,
+	}
+
+	err = query.Count(&response.Total).Error
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = query.Order("id").Offset((page - 1) * perPage).Limit(perPage).Find(&response.Players).Error
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, response)
+}
+
+func GetPlayer(c *gin.Context) {
+
+	user, ok := findPlayer(c)
+
+	if !ok {
+		return
+	}
+
+	c.JSON(200, user)
+}
+
+func RegisterPlayer(c *gin.Context) {
+
+	var body PlayerBody
+
+	if c.BindJSON(&body) != nil || body.UUID == "" || body.Username == "" {
+		c.JSON(400, gin.H{"error": "uuid and username are required"})
+		return
+	}
+
+	uuid, err := db.NormalizeUUID(body.UUID)
+
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing := db.User{}
+	db.OpenedConnection.Table("users").Where("uuid = ?", uuid).First(&existing)
+
+	if existing.ID != 0 {
+		c.JSON(409, gin.H{"error": "player already exists", "player": existing})
+		return
+	}
+
+	if body.DiscordID != 0 {
+		taken := db.User{}
+		db.OpenedConnection.Table("users").Where("discord_id = ?", body.DiscordID).First(&taken)
+
+		if taken.ID != 0 {
+			c.JSON(409, gin.H{"error": "discord account is already linked to " + taken.Username})
+			return
+		}
+	}
+
+	user := db.User{
+		UUID:      uuid,
+		Username:  body.Username,
+		DiscordID: body.DiscordID,
+		Gender:    body.Gender,
+		CreatedAt: time.Now(),
+	}
+
+	err = db.OpenedConnection.Table("users").Create(&user).Error
+
+	// Another request created the player or linked the account since the checks above
+	if db.IsUniqueViolation(err) {
+		c.JSON(409, gin.H{"error": "player or discord account already exists"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, user)
+}
+
+func UpdatePlayer(c *gin.Context) {
+
+	user, ok := findPlayer(c)
+
+	if !ok {
+		return
+	}
+
+	var body PlayerUpdateBody
+
+	if c.BindJSON(&body) != nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+
+	if body.Username != nil {
+		if *body.Username == "" {
+			c.JSON(400, gin.H{"error": "username can't be empty"})
+			return
+		}
+
+		updates["username"] = *body.Username
+	}
+
+	if body.DiscordID != nil {
+		updates["discord_id"] = *body.DiscordID
+	}
+
+	if body.Gender != nil {
+		updates["gender"] = *body.Gender
+	}
+
+	if body.Registred != nil {
+		updates["registred"] = *body.Registred
+	}
+
+	if len(updates) == 0 {
+		c.JSON(200, user)
+		return
+	}
+
+	err := db.OpenedConnection.Table("users").Where("id = ?", user.ID).Updates(updates).Error
+
+	if db.IsUniqueViolation(err) {
+		c.JSON(409, gin.H{"error": "discord account is already linked to another player"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	db.OpenedConnection.Table("users").First(&user, user.ID)
+	c.JSON(200, user)
+}
+
+// PlayerLogin is called by the proxy when a player joins
+func PlayerLogin(c *gin.Context) {
+
+	user, ok := findPlayer(c)
+
+	if !ok {
+		return
+	}
+
+	var body PlayerLoginBody
+
+	if c.BindJSON(&body) != nil || body.IP == "" {
+		c.JSON(400, gin.H{"error": "ip is required"})
+		return
+	}
+
+	now := time.Now()
+
+	err := db.OpenedConnection.Table("users").Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"last_ip_address": body.IP,
+		"last_login_at":   now,
+		"logins":          gorm.Expr("logins + 1"),
+	}).Error
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	db.OpenedConnection.Table("users").First(&user, user.ID)
+	c.JSON(200, user)
+}
+
+func findPlayer(c *gin.Context) (db.User, bool) {
+
+	user, err := db.FindUserByUUID(c.Param("uuid"))
+
+	if err == db.ErrInvalidUUID {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return user, false
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "player not found"})
+		return user, false
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return user, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/db/dbtest"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRegisterPlayerConflicts(t *testing.T) {
+
+	dbtest.Open(t, &db.User{})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/players", RegisterPlayer)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "new player", body: `{"uuid": "069a79f444e94726a5befca90e38aaf5", "username": "Notch", "discord_id": "80351110224678912"}`, status: 200},
+		{name: "same uuid", body: `{"uuid": "069a79f4-44e9-4726-a5be-fca90e38aaf5", "username": "Notch"}`, status: 409},
+		{name: "linked discord account", body: `{"uuid": "853c80ef3c3749fdaa49938b674adae6", "username": "jeb_", "discord_id": "80351110224678912"}`, status: 409},
+		{name: "unlinked player", body: `{"uuid": "853c80ef3c3749fdaa49938b674adae6", "username": "jeb_"}`, status: 200},
+	}
+
+	for _, test := range tests {
+		status, response := serve(r, http.MethodPost, "/players", test.body)
+
+		if status != test.status {
+			t.Errorf("%s: status %d, want %d: %v", test.name, status, test.status, response)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package routes
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Lisek-World-Reborn/lisek-api/auth"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/files"
+	"github.com/Lisek-World-Reborn/lisek-api/plugins"
+	"github.com/gin-gonic/gin"
+)
+
+func GetPluginCatalogs(c *gin.Context) {
+	c.JSON(200, plugins.CatalogNames())
+}
+
+func GetPlugins(c *gin.Context) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return
+	}
+
+	installed := []db.InstalledPlugin{}
+	db.OpenedConnection.Where("server_id = ?", server.ID).Order("name").Find(&installed)
+
+	c.JSON(200, installed)
+}
+
+// SearchPlugins searches ?catalog= for ?q=, only projects with versions for the server's
+// type and Minecraft version are returned
+func SearchPlugins(c *gin.Context) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return
+	}
+
+	catalog, err := plugins.FindCatalog(c.Query("catalog"))
+
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	target, err := plugins.ServerTarget(server)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	projects, err := catalog.Search(context.Background(), c.Query("q"), target.Loader, target.GameVersion)
+
+	if err != nil {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"target": target, "projects": projects})
+}
+
+// InstallPlugin takes effect on the next restart
+func InstallPlugin(c *gin.Context) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return
+	}
+
+	var body plugins.InstallRequest
+
+	if c.BindJSON(&body) != nil || (body.URL == "" && (body.Catalog == "" || body.Project == "")) {
+		c.JSON(400, gin.H{"error": "either catalog and project or url are required"})
+		return
+	}
+
+	// The api downloads whatever the url points at, so only admins pick arbitrary urls
+	if body.URL != "" && !callerHasScope(c, auth.SCOPE_ADMIN) {
+		c.JSON(403, gin.H{"error": "installing from a url needs the " + auth.SCOPE_ADMIN + " scope"})
+		return
+	}
+
+	plugin, err := plugins.Install(context.Background(), server, body)
+
+	if err != nil {
+		pluginError(c, err)
+		return
+	}
+
+	auditFileChange(c, server, "plugin-install", plugin.Path, "", plugin.Size)
+	c.JSON(200, plugin)
+}
+
+func UpdatePlugin(c *gin.Context) {
+
+	server, plugin, ok := findPlugin(c)
+
+	if !ok {
+		return
+	}
+
+	plugin, updated, err := plugins.Update(context.Background(), server, plugin)
+
+	if err != nil {
+		pluginError(c, err)
+		return
+	}
+
+	if updated {
+		auditFileChange(c, server, "plugin-update", plugin.Path, "", plugin.Size)
+	}
+
+	c.JSON(200, gin.H{"updated": updated, "plugin": plugin})
+}
+
+func RemovePlugin(c *gin.Context) {
+
+	server, plugin, ok := findPlugin(c)
+
+	if !ok {
+		return
+	}
+
+	err := plugins.Remove(server, plugin)
+
+	if err != nil {
+		pluginError(c, err)
+		return
+	}
+
+	auditFileChange(c, server, "plugin-remove", plugin.Path, "", 0)
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+func findPlugin(c *gin.Context) (db.Server, db.InstalledPlugin, bool) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return server, db.InstalledPlugin{}, false
+	}
+
+	plugin := db.InstalledPlugin{}
+	db.OpenedConnection.Where("server_id = ?", server.ID).First(&plugin, c.Param("plugin"))
+
+	if plugin.ID == 0 {
+		c.JSON(404, gin.H{"error": "plugin not found"})
+		return server, plugin, false
+	}
+
+	return server, plugin, true
+}
+
+func pluginError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, plugins.ErrUnknownCatalog), errors.Is(err, plugins.ErrInvalidFileName), errors.Is(err, plugins.ErrNotFromCatalog),
+		errors.Is(err, plugins.ErrBlockedAddress):
+		c.JSON(400, gin.H{"error": err.Error()})
+	case errors.Is(err, plugins.ErrProjectNotFound), errors.Is(err, plugins.ErrNoCompatibleVersion):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, plugins.ErrAlreadyInstalled), errors.Is(err, plugins.ErrPathInUse):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case errors.Is(err, plugins.ErrChecksumMismatch):
+		c.JSON(422, gin.H{"error": err.Error()})
+	case errors.Is(err, files.ErrTooLarge), errors.Is(err, files.ErrInvalidPath), errors.Is(err, files.ErrOutsideRoot):
+		fileError(c, err)
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
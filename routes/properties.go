@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Lisek-World-Reborn/lisek-api/docker"
+	"github.com/Lisek-World-Reborn/lisek-api/files"
+	"github.com/Lisek-World-Reborn/lisek-api/properties"
+	"github.com/gin-gonic/gin"
+)
+
+const PROPERTIES_FILE = "server.properties"
+
+// The file is written by the server on its first start
+func GetServerProperties(c *gin.Context) {
+
+	server, root, ok := findServerRoot(c)
+
+	if !ok {
+		return
+	}
+
+	template, err := docker.ResolveTemplate(server)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	content, err := files.Read(root, PROPERTIES_FILE)
+
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	typed, other := properties.Typed(properties.Parse(string(content)), template.Version)
+
+	c.JSON(200, gin.H{
+		"version":     template.Version,
+		"properties":  typed,
+		"other":       other,
+		"definitions": properties.Supported(template.Version),
+	})
+}
+
+// PatchServerProperties changes only the keys in the body, ?restart=true applies them right away
+func PatchServerProperties(c *gin.Context) {
+
+	server, root, ok := findServerRoot(c)
+
+	if !ok {
+		return
+	}
+
+	var changes map[string]interface{}
+
+	if c.BindJSON(&changes) != nil || len(changes) == 0 {
+		c.JSON(400, gin.H{"error": "body must be an object of properties"})
+		return
+	}
+
+	template, err := docker.ResolveTemplate(server)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	content, err := files.Read(root, PROPERTIES_FILE)
+
+	if err != nil && !errors.Is(err, files.ErrNotFound) {
+		fileError(c, err)
+		return
+	}
+
+	file := properties.Parse(string(content))
+
+	err = properties.Apply(file, changes, template.Version)
+
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	size, err := files.Write(root, PROPERTIES_FILE, strings.NewReader(file.String()), files.MAX_EDIT_SIZE)
+
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	auditFileChange(c, server, "properties", "/"+PROPERTIES_FILE, "", size)
+
+	typed, other := properties.Typed(file, template.Version)
+	restarted := false
+
+	if c.Query("restart") == "true" {
+		err = docker.RestartServer(&server, nil)
+
+		if err != nil && err != docker.ErrContainerNotFound {
+			c.JSON(500, gin.H{"error": "properties saved, restart failed: " + err.Error()})
+			return
+		}
+
+		restarted = err == nil
+	}
+
+	c.JSON(200, gin.H{
+		"version":    template.Version,
+		"properties": typed,
+		"other":      other,
+		"restarted":  restarted,
+	})
+}
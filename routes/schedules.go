@@ -0,0 +1,202 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduledTaskBody struct {
+	Name     string `json:"name"`
+	Cron     string `json:"cron"`
+	Type     string `json:"type"`
+	Payload  string `json:"payload"`
+	Warnings []int  `json:"warnings"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+func GetScheduledTasks(c *gin.Context) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return
+	}
+
+	tasks := []db.ScheduledTask{}
+	db.OpenedConnection.Where("server_id = ?", server.ID).Order("id").Find(&tasks)
+
+	c.JSON(200, tasks)
+}
+
+func GetScheduledTask(c *gin.Context) {
+
+	task, ok := findScheduledTask(c)
+
+	if !ok {
+		return
+	}
+
+	c.JSON(200, task)
+}
+
+func CreateScheduledTask(c *gin.Context) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return
+	}
+
+	var body ScheduledTaskBody
+
+	if c.BindJSON(&body) != nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+
+	task := db.ScheduledTask{
+		ServerID: server.ID,
+		Enabled:  true,
+	}
+
+	if !applyScheduledTaskBody(c, &task, body) {
+		return
+	}
+
+	err := db.OpenedConnection.Create(&task).Error
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, task)
+}
+
+func UpdateScheduledTask(c *gin.Context) {
+
+	task, ok := findScheduledTask(c)
+
+	if !ok {
+		return
+	}
+
+	var body ScheduledTaskBody
+
+	if c.BindJSON(&body) != nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+
+	if !applyScheduledTaskBody(c, &task, body) {
+		return
+	}
+
+	err := db.OpenedConnection.Save(&task).Error
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, task)
+}
+
+func DeleteScheduledTask(c *gin.Context) {
+
+	task, ok := findScheduledTask(c)
+
+	if !ok {
+		return
+	}
+
+	db.OpenedConnection.Delete(&task)
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+func GetTaskRuns(c *gin.Context) {
+
+	task, ok := findScheduledTask(c)
+
+	if !ok {
+		return
+	}
+
+	runs := []db.TaskRun{}
+	db.OpenedConnection.Where("task_id = ?", task.ID).Order("started_at DESC").Limit(100).Find(&runs)
+
+	c.JSON(200, runs)
+}
+
+// RunScheduledTask starts the task right away, its outcome lands in the run history
+func RunScheduledTask(c *gin.Context) {
+
+	task, ok := findScheduledTask(c)
+
+	if !ok {
+		return
+	}
+
+	c.JSON(202, scheduler.RunNow(task))
+}
+
+// Fields missing from the body keep their value, the next run is recomputed from the cron
+func applyScheduledTaskBody(c *gin.Context, task *db.ScheduledTask, body ScheduledTaskBody) bool {
+
+	if body.Name != "" {
+		task.Name = body.Name
+	}
+
+	if body.Cron != "" {
+		task.Cron = body.Cron
+	}
+
+	if body.Type != "" {
+		task.Type = body.Type
+	}
+
+	if body.Payload != "" {
+		task.Payload = body.Payload
+	}
+
+	if body.Warnings != nil {
+		task.Warnings = body.Warnings
+	}
+
+	if body.Enabled != nil {
+		task.Enabled = *body.Enabled
+	}
+
+	err := scheduler.ValidateTask(*task)
+
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return false
+	}
+
+	task.NextRunAt, _ = scheduler.NextRun(task.Cron, time.Now())
+
+	return true
+}
+
+func findScheduledTask(c *gin.Context) (db.ScheduledTask, bool) {
+
+	server, ok := findServer(c)
+
+	if !ok {
+		return db.ScheduledTask{}, false
+	}
+
+	task := db.ScheduledTask{}
+	db.OpenedConnection.Where("server_id = ?", server.ID).First(&task, c.Param("task"))
+
+	if task.ID == 0 {
+		c.JSON(404, gin.H{"error": "task not found"})
+		return task, false
+	}
+
+	return task, true
+}
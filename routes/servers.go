@@ -2,21 +2,37 @@ package routes
 
 import (
 	"context"
+	"regexp"
 	"strconv"
-	"strings"
 	"time"
 
+	"github.com/Lisek-World-Reborn/lisek-api/auth"
 	"github.com/Lisek-World-Reborn/lisek-api/channels"
-	"github.com/Lisek-World-Reborn/lisek-api/config"
 	"github.com/Lisek-World-Reborn/lisek-api/db"
 	"github.com/Lisek-World-Reborn/lisek-api/docker"
 	"github.com/Lisek-World-Reborn/lisek-api/logger"
-	"github.com/docker/docker/api/types"
+	"github.com/Lisek-World-Reborn/lisek-api/rcon"
 	"github.com/gin-gonic/gin"
 )
 
+// The base name ends up in the container name and with that in host paths
+var baseNamePattern = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
 type ServerBody struct {
-	BaseName string `json:"base_name"`
+	BaseName   string               `json:"base_name"`
+	TemplateID uint                 `json:"template_id"`
+	Overrides  db.TemplateOverrides `json:"overrides"`
+	Limits     db.ResourceLimits    `json:"limits"`
+}
+
+// Everything PUT /servers/:id may change, the id, container name and port are fixed
+// at creation and limits have their own route. Missing fields are left as they are.
+type UpdateServerBody struct {
+	Name       *string               `json:"name"`
+	IP         *string               `json:"ip"`
+	Region     *string               `json:"region"`
+	TemplateID *uint                 `json:"template_id"`
+	Overrides  *db.TemplateOverrides `json:"overrides"`
 }
 
 type ServerResponse struct {
@@ -30,86 +46,212 @@ type ServerResponse struct {
 	CreatedAt     time.Time `json:"created_at"`
 	ContainerName string    `json:"container_name"`
 	Port          int       `json:"port"`
+	Liveness      string    `json:"liveness"`
+	LastPing      time.Time `json:"last_ping"`
+}
+
+// What anonymous callers see, without internal fields like the container name and ip
+type PublicServer struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status,omitempty"`
+	State     string    `json:"state"`
+	Region    string    `json:"region"`
+	Port      int       `json:"port"`
+	Liveness  string    `json:"liveness"`
+	LastPing  time.Time `json:"last_ping"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func publicServer(server db.Server) PublicServer {
+	return PublicServer{
+		ID:        server.ID,
+		Name:      server.Name,
+		State:     server.State,
+		Region:    server.Region,
+		Port:      server.Port,
+		Liveness:  channels.Liveness(server),
+		LastPing:  server.LastPing,
+		CreatedAt: server.CreatedAt,
+	}
 }
 
 func GetServer(c *gin.Context) {
 	server := db.Server{}
 	db.OpenedConnection.First(&server, c.Param("id"))
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
+	}
+
+	if !isAuthenticated(c) {
+		c.JSON(200, publicServer(server))
+		return
+	}
+
 	c.JSON(200, server)
 }
 
 func CreateServer(c *gin.Context) {
 
-	if c.GetHeader("Authorization") != config.LoadedConfiguration.Secret {
-		c.JSON(401, gin.H{"error": "unauthorized"})
+	server := db.Server{}
+
+	if c.BindJSON(&server) != nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
 		return
 	}
-	server := db.Server{}
-	c.BindJSON(&server)
+
+	// Ids are always assigned by the database
+	server.ID = 0
+
+	err := docker.ValidateContainerName(server.ContainerName)
+
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
 	db.OpenedConnection.Create(&server)
 	c.JSON(200, server)
 }
 
 func UpdateServer(c *gin.Context) {
 
-	if c.GetHeader("Authorization") != config.LoadedConfiguration.Secret {
-		c.JSON(401, gin.H{"error": "unauthorized"})
-		return
-	}
 	server := db.Server{}
 	db.OpenedConnection.First(&server, c.Param("id"))
-	c.BindJSON(&server)
-	db.OpenedConnection.Save(&server)
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
+	}
+
+	var body UpdateServerBody
+
+	if c.BindJSON(&body) != nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+
+	if body.Name != nil {
+		server.Name = *body.Name
+	}
+
+	if body.IP != nil {
+		server.IP = *body.IP
+	}
+
+	if body.Region != nil {
+		server.Region = *body.Region
+	}
+
+	if body.TemplateID != nil {
+		if *body.TemplateID != 0 {
+			template := db.ServerTemplate{}
+			db.OpenedConnection.First(&template, *body.TemplateID)
+
+			if template.ID == 0 {
+				c.JSON(400, gin.H{"error": "template not found"})
+				return
+			}
+		}
+
+		server.TemplateID = *body.TemplateID
+	}
+
+	if body.Overrides != nil {
+		if !allowImageOverride(c, server.Overrides.Image, body.Overrides.Image) {
+			return
+		}
+
+		server.Overrides = *body.Overrides
+	}
+
+	err := db.OpenedConnection.Model(&server).Select("name", "ip", "region", "template_id", "overrides").Updates(&server).Error
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(200, server)
 }
 
 func DeleteServer(c *gin.Context) {
 
-	if c.GetHeader("Authorization") != config.LoadedConfiguration.Secret {
-		c.JSON(401, gin.H{"error": "unauthorized"})
+	dataMode := c.DefaultQuery("data", docker.DATA_KEEP)
+
+	if !docker.IsValidDataMode(dataMode) {
+		c.JSON(400, gin.H{"error": "data must be one of keep, archive, purge"})
 		return
 	}
+
 	server := db.Server{}
 	db.OpenedConnection.First(&server, c.Param("id"))
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
+	}
+
+	err := docker.RemoveServer(server, dataMode)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
 	db.OpenedConnection.Delete(&server)
 	c.JSON(200, gin.H{"status": "ok"})
 }
 
+const MAX_RESPONSE_TIMEOUT = 30 * time.Second
+
 func PostServerMessage(c *gin.Context) {
+
 	server := db.Server{}
 	db.OpenedConnection.First(&server, c.Param("id"))
 
-	message := channels.MinecraftRequest{
-		UUID:      c.Param("uuid"),
-		Target:    c.Param("target"),
-		Arguments: strings.Split(c.Param("arguments"), ","),
-		Hash:      c.Param("hash"),
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
 	}
 
-	converted := strconv.Itoa(int(server.ID))
-
-	result, err := message.SendToServer(converted)
+	var message channels.MinecraftRequest
 
-	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+	if c.BindJSON(&message) != nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
 		return
 	}
 
-	if !result {
-		c.JSON(500, gin.H{"error": "invalid request"})
+	timeout, err := time.ParseDuration(c.DefaultQuery("timeout", "5s"))
+
+	if err != nil || timeout <= 0 || timeout > MAX_RESPONSE_TIMEOUT {
+		c.JSON(400, gin.H{"error": "invalid timeout"})
 		return
 	}
 
-	c.JSON(200, gin.H{"status": "ok"})
-}
+	response, err := message.SendToServerAndWait(server.ID, timeout)
 
-func GenerateServer(c *gin.Context) {
+	if err == channels.ErrResponseTimeout {
+		c.JSON(504, gin.H{"error": err.Error()})
+		return
+	}
 
-	if c.GetHeader("Authorization") != config.LoadedConfiguration.Secret {
-		c.JSON(401, gin.H{"error": "unauthorized"})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
+	c.JSON(200, gin.H{"status": "ok", "response": response})
+}
+
+// Provisioning and pinging need docker and a running server, tests replace them
+var provisionServer = docker.CreateServer
+var probeServer = docker.ProbeServer
+
+func GenerateServer(c *gin.Context) {
+
 	var body ServerBody
 
 	if c.BindJSON(&body) != nil {
@@ -117,18 +259,29 @@ func GenerateServer(c *gin.Context) {
 		return
 	}
 
-	var latestServer db.Server
-
-	db.OpenedConnection.Last(&latestServer)
+	if !baseNamePattern.MatchString(body.BaseName) {
+		c.JSON(400, gin.H{"error": "base_name must be 1 to 32 characters of a-z, 0-9 and -"})
+		return
+	}
 
-	lastId := 0
+	if err := docker.ValidateLimits(body.Limits); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
-	if latestServer.ID > 1 {
-		lastId = int(latestServer.ID)
-		logger.Info("Last server was not null!")
+	if !allowImageOverride(c, "", body.Overrides.Image) {
+		return
 	}
 
-	logger.Info("Generating server with port " + strconv.Itoa(25565+lastId))
+	if body.TemplateID != 0 {
+		template := db.ServerTemplate{}
+		db.OpenedConnection.First(&template, body.TemplateID)
+
+		if template.ID == 0 {
+			c.JSON(400, gin.H{"error": "template not found"})
+			return
+		}
+	}
 
 	server := db.Server{
 		Name:          body.BaseName,
@@ -136,37 +289,141 @@ func GenerateServer(c *gin.Context) {
 		Region:        "eu",
 		CreatedAt:     time.Now(),
 		ContainerName: "server-" + body.BaseName + "-" + strconv.Itoa(int(time.Now().Unix())),
-		Port:          25565 + lastId,
+		TemplateID:    body.TemplateID,
+		Overrides:     body.Overrides,
+		Limits:        body.Limits,
+		RconPassword:  rcon.GeneratePassword(),
 	}
 
-	db.OpenedConnection.Create(&server)
+	err := db.OpenedConnection.Create(&server).Error
+
+	// Without an id the port and signing key below would be handed to server 0
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
 
-	go docker.CreateServer(server)
+	port, err := docker.AllocatePort(server.ID)
 
-	c.JSON(200, server)
+	if err != nil {
+		db.OpenedConnection.Delete(&server)
+		c.JSON(503, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Info("Generating server with port " + strconv.Itoa(port))
+
+	server.Port = port
+	err = db.OpenedConnection.Save(&server).Error
+
+	if err != nil {
+		discardServer(server)
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = channels.RotateSigningKey(server.ID, 0)
+
+	if err != nil {
+		discardServer(server)
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := db.CreateJob("provision", server.ID)
+
+	if err != nil {
+		discardServer(server)
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The provisioning goroutine updates the job while the response is written
+	response := *job
+
+	go provisionServer(server, job)
+
+	c.JSON(202, gin.H{"server": server, "job": response})
+}
+
+// Like template images, only admins pick what image a server runs
+func allowImageOverride(c *gin.Context, previous string, image string) bool {
+
+	if image == "" || image == previous || image == docker.SERVER_IMAGE || callerHasScope(c, auth.SCOPE_ADMIN) {
+		return true
+	}
+
+	c.JSON(403, gin.H{"error": "custom images need the " + auth.SCOPE_ADMIN + " scope"})
+
+	return false
+}
+
+// discardServer undoes GenerateServer when it fails before provisioning starts
+func discardServer(server db.Server) {
+
+	err := docker.ReleaseServerPorts(server.ID)
+
+	if err != nil {
+		logger.Error("Error releasing ports of discarded server: " + err.Error())
+	}
+
+	db.OpenedConnection.Where("server_id = ?", server.ID).Delete(&db.SigningKey{})
+	db.OpenedConnection.Delete(&server)
 }
 
 func ServerStatus(c *gin.Context) {
 	server := db.Server{}
 	db.OpenedConnection.First(&server, c.Param("id"))
 
-	containers, err := docker.DockerClient.ContainerList(context.Background(), types.ContainerListOptions{
-		All: true,
-	})
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
+	}
+
+	container, err := docker.ContainerRuntime.InspectContainer(context.Background(), server.ContainerName)
+
+	if err == docker.ErrContainerNotFound {
+		c.JSON(200, gin.H{"status": "offline"})
+		return
+	}
 
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	for _, container := range containers {
-		if container.Names[0] == "/"+server.ContainerName {
-			c.JSON(200, gin.H{"status": "online", "health": container.Status, "state": container.State})
-			return
+	if container.State != "running" {
+		c.JSON(200, gin.H{"status": "offline", "health": container.Status, "state": container.State})
+		return
+	}
+
+	// A running container only means the JVM process exists, the game port tells if it's serving
+	probe := probeServer(server)
+
+	if probe.Error != nil {
+		response := gin.H{
+			"status":    "unreachable",
+			"health":    container.Status,
+			"state":     container.State,
+			"probed_at": probe.ProbedAt,
+		}
+
+		// Dial errors contain the internal address
+		if isAuthenticated(c) {
+			response["ping_error"] = probe.Error.Error()
 		}
+
+		c.JSON(200, response)
+		return
 	}
 
-	c.JSON(200, gin.H{"status": "offline"})
+	c.JSON(200, gin.H{
+		"status":    "online",
+		"health":    container.Status,
+		"state":     container.State,
+		"ping":      probe.Status,
+		"probed_at": probe.ProbedAt,
+	})
 }
 
 func GetServers(c *gin.Context) {
@@ -174,19 +431,23 @@ func GetServers(c *gin.Context) {
 	db.OpenedConnection.Find(&servers)
 
 	response := []ServerResponse{}
+	public := []PublicServer{}
 
-	for _, server := range servers {
-		containers, err := docker.DockerClient.ContainerList(context.Background(), types.ContainerListOptions{
-			All: true,
-		})
+	containers, err := docker.ContainerRuntime.ListContainers(context.Background())
 
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
-		}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
 
+	for _, server := range servers {
 		for _, container := range containers {
-			if container.Names[0] == "/"+server.ContainerName {
+			if container.Name == server.ContainerName {
+				view := publicServer(server)
+				view.Status = "online"
+				view.State = container.State
+				public = append(public, view)
+
 				response = append(response, ServerResponse{
 					ID:            server.ID,
 					Name:          server.Name,
@@ -198,10 +459,82 @@ func GetServers(c *gin.Context) {
 					CreatedAt:     server.CreatedAt,
 					ContainerName: server.ContainerName,
 					Port:          server.Port,
+					Liveness:      channels.Liveness(server),
+					LastPing:      server.LastPing,
 				})
 			}
 		}
 	}
 
+	if !isAuthenticated(c) {
+		c.JSON(200, public)
+		return
+	}
+
 	c.JSON(200, response)
 }
+
+func UpdateServerResources(c *gin.Context) {
+
+	server := db.Server{}
+	db.OpenedConnection.First(&server, c.Param("id"))
+
+	if server.ID == 0 {
+		c.JSON(404, gin.H{"error": "server not found"})
+		return
+	}
+
+	var limits db.ResourceLimits
+
+	if c.BindJSON(&limits) != nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+
+	err := docker.ValidateLimits(limits)
+
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	previous, err := docker.ServerResources(server)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	server.Limits = limits
+
+	resources, err := docker.ServerResources(server)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = docker.ApplyServerResources(context.Background(), server, previous, resources)
+
+	if err == docker.ErrLimitRemoval {
+		c.JSON(409, gin.H{"error": err.Error() + ", recreate the server instead"})
+		return
+	}
+
+	if err != nil && err != docker.ErrContainerNotFound {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Without a container the limits are applied when it's created
+	applied := err == nil
+
+	err = db.OpenedConnection.Save(&server).Error
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "ok", "limits": server.Limits, "applied": applied})
+}
@@ -0,0 +1,321 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/Lisek-World-Reborn/lisek-api/config"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/db/dbtest"
+	"github.com/Lisek-World-Reborn/lisek-api/docker"
+	"github.com/Lisek-World-Reborn/lisek-api/mcping"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v9"
+)
+
+func setupMessageRoute(t *testing.T) *gin.Engine {
+
+	dbtest.Open(t, &db.Server{}, &db.SigningKey{})
+	if err := db.OpenedConnection.Create(&db.Server{ID: 1, Name: "lobby", ContainerName: "lobby"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	previous := channels.RedisConnection
+	channels.RedisConnection = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+
+	t.Cleanup(func() {
+		channels.RedisConnection.Close()
+		channels.RedisConnection = previous
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/servers/:id/data", PostServerMessage)
+
+	return r
+}
+
+// answerRequests replies to every request of server 1 like the plugin does, until the test ends
+func answerRequests(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	pubsub := channels.RedisConnection.Subscribe(ctx, "servers:1:request")
+
+	_, err := pubsub.Receive(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+
+		defer pubsub.Close()
+
+		for msg := range pubsub.Channel() {
+			var request channels.MinecraftRequest
+			json.Unmarshal([]byte(msg.Payload), &request)
+
+			response, _ := json.Marshal(channels.MinecraftResponse{ID: request.ID, Success: true, Data: json.RawMessage(`"pong"`)})
+			channels.RedisConnection.Publish(ctx, "servers:1:response", response)
+		}
+	}()
+}
+
+func TestPostServerMessage(t *testing.T) {
+
+	r := setupMessageRoute(t)
+
+	tests := []struct {
+		name     string
+		url      string
+		body     string
+		answered bool
+		status   int
+	}{
+		{name: "unknown server", url: "/servers/2/data", body: `{"target": "ping"}`, status: 404},
+		{name: "invalid body", url: "/servers/1/data", body: `{`, status: 400},
+		{name: "invalid timeout", url: "/servers/1/data?timeout=soon", body: `{"target": "ping"}`, status: 400},
+		{name: "timeout too long", url: "/servers/1/data?timeout=1h", body: `{"target": "ping"}`, status: 400},
+		{name: "no answer", url: "/servers/1/data?timeout=200ms", body: `{"target": "ping"}`, status: 504},
+		{name: "answered", url: "/servers/1/data?timeout=2s", body: `{"target": "ping"}`, answered: true, status: 200},
+	}
+
+	for _, test := range tests {
+		if test.answered {
+			answerRequests(t)
+		}
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, test.url, strings.NewReader(test.body)))
+
+		if recorder.Code != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.name, recorder.Code, test.status, recorder.Body.String())
+			continue
+		}
+
+		if test.status != 200 {
+			continue
+		}
+
+		var body struct {
+			Response channels.MinecraftResponse `json:"response"`
+		}
+
+		json.Unmarshal(recorder.Body.Bytes(), &body)
+
+		if !body.Response.Success || string(body.Response.Data) != `"pong"` {
+			t.Errorf("%s: response %s", test.name, recorder.Body.String())
+		}
+	}
+}
+
+func serve(r *gin.Engine, method string, url string, body string) (int, map[string]interface{}) {
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(method, url, strings.NewReader(body)))
+
+	response := map[string]interface{}{}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+
+	return recorder.Code, response
+}
+
+// setupRuntime swaps in a fake container runtime and a port range of two ports
+func setupRuntime(t *testing.T) *docker.FakeRuntime {
+
+	runtime := docker.NewFakeRuntime()
+	previousRuntime, previousPorts := docker.ContainerRuntime, config.LoadedConfiguration.Ports
+
+	docker.ContainerRuntime = runtime
+	config.LoadedConfiguration.Ports.Start = 30000
+	config.LoadedConfiguration.Ports.End = 30001
+	config.LoadedConfiguration.Ports.Reserved = nil
+
+	t.Cleanup(func() {
+		docker.ContainerRuntime, config.LoadedConfiguration.Ports = previousRuntime, previousPorts
+	})
+
+	return runtime
+}
+
+func TestGenerateServer(t *testing.T) {
+
+	dbtest.Open(t, &db.Server{}, &db.ServerTemplate{}, &db.PortLease{}, &db.SigningKey{}, &db.Job{})
+	setupRuntime(t)
+
+	db.OpenedConnection.Create(&db.ServerTemplate{ID: 3, Name: "modded"})
+
+	// Provisioning runs in the background against docker, here it's only recorded
+	provisioned := make(chan db.Server, 8)
+	previousProvision := provisionServer
+	provisionServer = func(server db.Server, job *db.Job) { provisioned <- server }
+	t.Cleanup(func() { provisionServer = previousProvision })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/servers", GenerateServer)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		port   int
+	}{
+		{name: "invalid body", body: `{`, status: 400},
+		{name: "invalid base name", body: `{"base_name": "Lobby!"}`, status: 400},
+		{name: "base name too long", body: `{"base_name": "` + strings.Repeat("a", 33) + `"}`, status: 400},
+		{name: "negative limits", body: `{"base_name": "lobby", "limits": {"memory_mb": -1}}`, status: 400},
+		{name: "unknown template", body: `{"base_name": "lobby", "template_id": 9}`, status: 400},
+		{name: "created", body: `{"base_name": "lobby"}`, status: 202, port: 30000},
+		{name: "created from a template", body: `{"base_name": "modded", "template_id": 3, "overrides": {"version": "1.19.2"}}`, status: 202, port: 30001},
+		{name: "ports exhausted", body: `{"base_name": "third"}`, status: 503},
+	}
+
+	for _, test := range tests {
+		status, response := serve(r, http.MethodPost, "/servers", test.body)
+
+		if status != test.status {
+			t.Errorf("%s: status %d, want %d: %v", test.name, status, test.status, response)
+			continue
+		}
+
+		if status != 202 {
+			continue
+		}
+
+		var server db.Server
+
+		select {
+		case server = <-provisioned:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: provisioning didn't start", test.name)
+		}
+		job, _ := response["job"].(map[string]interface{})
+
+		if server.ID == 0 || server.Port != test.port || job["server_id"] != float64(server.ID) {
+			t.Errorf("%s: provisioned %+v with job %v", test.name, server, job)
+		}
+
+		var leases, keys int64
+		db.OpenedConnection.Model(&db.PortLease{}).Where("port = ? AND server_id = ?", test.port, server.ID).Count(&leases)
+		db.OpenedConnection.Model(&db.SigningKey{}).Where("server_id = ?", server.ID).Count(&keys)
+
+		if leases != 1 || keys != 1 {
+			t.Errorf("%s: %d port leases and %d signing keys", test.name, leases, keys)
+		}
+	}
+
+	// The failed request must not leave a server behind
+	var servers int64
+	db.OpenedConnection.Model(&db.Server{}).Count(&servers)
+
+	if servers != 2 || len(provisioned) != 0 {
+		t.Errorf("%d servers and %d more provisioned, want the 2 created", servers, len(provisioned))
+	}
+}
+
+func TestGenerateServerCreateFails(t *testing.T) {
+
+	// Without a servers table the insert fails
+	dbtest.Open(t, &db.PortLease{}, &db.SigningKey{}, &db.Job{})
+	setupRuntime(t)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/servers", GenerateServer)
+
+	status, response := serve(r, http.MethodPost, "/servers", `{"base_name": "lobby"}`)
+
+	if status != 500 {
+		t.Fatalf("status %d, want 500: %v", status, response)
+	}
+
+	var leases, keys int64
+	db.OpenedConnection.Model(&db.PortLease{}).Count(&leases)
+	db.OpenedConnection.Model(&db.SigningKey{}).Count(&keys)
+
+	if leases != 0 || keys != 0 {
+		t.Errorf("%d port leases and %d signing keys left for a server that wasn't created", leases, keys)
+	}
+}
+
+func TestServerStatus(t *testing.T) {
+
+	dbtest.Open(t, &db.Server{})
+	runtime := setupRuntime(t)
+
+	db.OpenedConnection.Create(&db.Server{ID: 1, Name: "running", ContainerName: "running"})
+	db.OpenedConnection.Create(&db.Server{ID: 2, Name: "stopped", ContainerName: "stopped"})
+	db.OpenedConnection.Create(&db.Server{ID: 3, Name: "missing", ContainerName: "missing"})
+
+	for _, name := range []string{"running", "stopped"} {
+		id, _ := runtime.CreateContainer(context.Background(), docker.ContainerSpec{Name: name})
+
+		if name == "running" {
+			runtime.StartContainer(context.Background(), id)
+		}
+	}
+
+	var probe docker.ProbeResult
+	previousProbe := probeServer
+	probeServer = func(server db.Server) docker.ProbeResult { return probe }
+	t.Cleanup(func() { probeServer = previousProbe })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/servers/:id/status", ServerStatus)
+	// Stands in for AllowPublic letting a valid key through
+	r.GET("/authenticated/servers/:id/status", func(c *gin.Context) { c.Set("api_key", db.ApiKey{}) }, ServerStatus)
+
+	online := docker.ProbeResult{Status: &mcping.Status{OnlinePlayers: 3, Latency: 12 * time.Millisecond}, ProbedAt: time.Now()}
+	unreachable := docker.ProbeResult{Error: errors.New("dial tcp 172.18.0.5:25565: connection refused"), ProbedAt: time.Now()}
+
+	tests := []struct {
+		name      string
+		url       string
+		probe     docker.ProbeResult
+		status    int
+		state     string
+		pingError bool
+	}{
+		{name: "unknown server", url: "/servers/9/status", status: 404},
+		{name: "no container", url: "/servers/3/status", status: 200, state: "offline"},
+		{name: "stopped container", url: "/servers/2/status", status: 200, state: "offline"},
+		{name: "online", url: "/servers/1/status", probe: online, status: 200, state: "online"},
+		{name: "unreachable", url: "/servers/1/status", probe: unreachable, status: 200, state: "unreachable"},
+		{name: "unreachable, authenticated", url: "/authenticated/servers/1/status", probe: unreachable, status: 200, state: "unreachable", pingError: true},
+	}
+
+	for _, test := range tests {
+		probe = test.probe
+		status, response := serve(r, http.MethodGet, test.url, "")
+
+		if status != test.status || (test.state != "" && response["status"] != test.state) {
+			t.Errorf("%s: %d %v, want %d %s", test.name, status, response, test.status, test.state)
+			continue
+		}
+
+		// The dial error names the internal address, only key holders see it
+		if _, ok := response["ping_error"]; ok != test.pingError {
+			t.Errorf("%s: ping_error in %v", test.name, response)
+		}
+
+		if test.state == "online" {
+			ping, _ := response["ping"].(map[string]interface{})
+
+			if ping["online_players"] != float64(3) || ping["latency_ms"] != float64(12) {
+				t.Errorf("%s: ping %v", test.name, ping)
+			}
+		}
+	}
+}
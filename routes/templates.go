@@ -0,0 +1,171 @@
+package routes
+
+import (
+	"github.com/Lisek-World-Reborn/lisek-api/auth"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/docker"
+	"github.com/gin-gonic/gin"
+)
+
+func GetTemplates(c *gin.Context) {
+	templates := []db.ServerTemplate{}
+	db.OpenedConnection.Order("id").Find(&templates)
+	c.JSON(200, templates)
+}
+
+func GetTemplate(c *gin.Context) {
+	template := db.ServerTemplate{}
+	db.OpenedConnection.First(&template, c.Param("id"))
+
+	if template.ID == 0 {
+		c.JSON(404, gin.H{"error": "template not found"})
+		return
+	}
+
+	c.JSON(200, template)
+}
+
+func CreateTemplate(c *gin.Context) {
+
+	template := db.ServerTemplate{}
+
+	if c.BindJSON(&template) != nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+
+	template.ID = 0
+
+	if !validateTemplate(c, db.ServerTemplate{}, template) {
+		return
+	}
+
+	err := db.OpenedConnection.Create(&template).Error
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, template)
+}
+
+// UpdateTemplate replaces the template, fields missing from the body are cleared
+func UpdateTemplate(c *gin.Context) {
+
+	previous := db.ServerTemplate{}
+	db.OpenedConnection.First(&previous, c.Param("id"))
+
+	if previous.ID == 0 {
+		c.JSON(404, gin.H{"error": "template not found"})
+		return
+	}
+
+	// Binding onto the stored template would merge into its env map instead of replacing it
+	template := db.ServerTemplate{}
+
+	if c.BindJSON(&template) != nil {
+		c.JSON(400, gin.H{"error": "invalid body"})
+		return
+	}
+
+	template.ID = previous.ID
+	template.CreatedAt = previous.CreatedAt
+
+	if !validateTemplate(c, previous, template) {
+		return
+	}
+
+	err := db.OpenedConnection.Save(&template).Error
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, template)
+}
+
+func DeleteTemplate(c *gin.Context) {
+
+	template := db.ServerTemplate{}
+	db.OpenedConnection.First(&template, c.Param("id"))
+
+	if template.ID == 0 {
+		c.JSON(404, gin.H{"error": "template not found"})
+		return
+	}
+
+	var usedBy int64
+	db.OpenedConnection.Model(&db.Server{}).Where("template_id = ?", template.ID).Count(&usedBy)
+
+	if usedBy > 0 {
+		c.JSON(409, gin.H{"error": "template is used by existing servers"})
+		return
+	}
+
+	db.OpenedConnection.Delete(&template)
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+// customizesHost is true when the template gets another image or other mounts than before,
+// both decide what runs on the host with which of its files
+func customizesHost(previous db.ServerTemplate, template db.ServerTemplate) bool {
+
+	if template.Image != previous.Image && template.Image != docker.SERVER_IMAGE {
+		return true
+	}
+
+	if len(template.Mounts) != len(previous.Mounts) {
+		return true
+	}
+
+	for i, mount := range template.Mounts {
+		if mount != previous.Mounts[i] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateTemplate(c *gin.Context, previous db.ServerTemplate, template db.ServerTemplate) bool {
+
+	if template.Name == "" || template.Image == "" {
+		c.JSON(400, gin.H{"error": "name and image are required"})
+		return false
+	}
+
+	for key := range template.Env {
+		if key == "" {
+			c.JSON(400, gin.H{"error": "env keys can't be empty"})
+			return false
+		}
+	}
+
+	if customizesHost(previous, template) && !callerHasScope(c, auth.SCOPE_ADMIN) {
+		c.JSON(403, gin.H{"error": "mounts and custom images need the " + auth.SCOPE_ADMIN + " scope"})
+		return false
+	}
+
+	for _, mount := range template.Mounts {
+		if mount.Source == "" || mount.Target == "" || mount.Target == "/data" {
+			c.JSON(400, gin.H{"error": "mounts need a source and a target other than /data"})
+			return false
+		}
+
+		if err := docker.ValidateMountSource(mount.Source); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+
+	err := docker.ValidateLimits(template.Limits)
+
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Lisek-World-Reborn/lisek-api/auth"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/db/dbtest"
+	"github.com/Lisek-World-Reborn/lisek-api/docker"
+	"github.com/gin-gonic/gin"
+)
+
+// withScopes stands in for RequireScope letting a key with the scopes through
+func withScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("api_key", db.ApiKey{Scopes: scopes})
+	}
+}
+
+func TestCreateTemplateHostAccess(t *testing.T) {
+
+	dbtest.Open(t, &db.ServerTemplate{})
+
+	previousData, previousLocal := docker.DATA_DIR, docker.LOCAL_DATA_DIR
+	docker.DATA_DIR, docker.LOCAL_DATA_DIR = "/srv/lisek", t.TempDir()
+	t.Cleanup(func() { docker.DATA_DIR, docker.LOCAL_DATA_DIR = previousData, previousLocal })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/templates", withScopes(auth.SCOPE_SERVERS_WRITE), CreateTemplate)
+	r.POST("/admin/templates", withScopes(auth.SCOPE_ADMIN), CreateTemplate)
+
+	tests := []struct {
+		name   string
+		url    string
+		body   string
+		status int
+	}{
+		{name: "default image", url: "/templates", body: `{"name": "a", "image": "` + docker.SERVER_IMAGE + `"}`, status: 200},
+		{name: "custom image", url: "/templates", body: `{"name": "b", "image": "evil/image"}`, status: 403},
+		{name: "mount", url: "/templates", body: `{"name": "c", "image": "` + docker.SERVER_IMAGE + `", "mounts": [{"source": "/srv/lisek/mounts/maps", "target": "/maps"}]}`, status: 403},
+		{name: "custom image by an admin", url: "/admin/templates", body: `{"name": "d", "image": "other/image"}`, status: 200},
+		{name: "mount by an admin", url: "/admin/templates", body: `{"name": "e", "image": "` + docker.SERVER_IMAGE + `", "mounts": [{"source": "/srv/lisek/mounts/maps", "target": "/maps"}]}`, status: 200},
+		{name: "docker socket by an admin", url: "/admin/templates", body: `{"name": "f", "image": "` + docker.SERVER_IMAGE + `", "mounts": [{"source": "/var/run/docker.sock", "target": "/sock"}]}`, status: 400},
+		{name: "host root by an admin", url: "/admin/templates", body: `{"name": "g", "image": "` + docker.SERVER_IMAGE + `", "mounts": [{"source": "/", "target": "/host"}]}`, status: 400},
+	}
+
+	for _, test := range tests {
+		status, response := serve(r, http.MethodPost, test.url, test.body)
+
+		if status != test.status {
+			t.Errorf("%s: status %d, want %d: %v", test.name, status, test.status, response)
+		}
+	}
+}
+
+func TestUpdateTemplateReplacesEnv(t *testing.T) {
+
+	dbtest.Open(t, &db.ServerTemplate{})
+
+	template := db.ServerTemplate{Name: "modded", Image: docker.SERVER_IMAGE, Env: map[string]string{"MOTD": "hi", "TZ": "UTC"}}
+	db.OpenedConnection.Create(&template)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PUT("/templates/:id", withScopes(auth.SCOPE_SERVERS_WRITE), UpdateTemplate)
+
+	status, response := serve(r, http.MethodPut, "/templates/"+strconv.Itoa(int(template.ID)),
+		`{"name": "modded", "image": "`+docker.SERVER_IMAGE+`", "env": {"TZ": "Europe/Warsaw"}}`)
+
+	if status != 200 {
+		t.Fatalf("status %d: %v", status, response)
+	}
+
+	stored := db.ServerTemplate{}
+	db.OpenedConnection.First(&stored, template.ID)
+
+	if len(stored.Env) != 1 || stored.Env["TZ"] != "Europe/Warsaw" {
+		t.Errorf("env after update %v, want only the new TZ", stored.Env)
+	}
+
+	if !stored.CreatedAt.Equal(template.CreatedAt) {
+		t.Errorf("created_at changed from %s to %s", template.CreatedAt, stored.CreatedAt)
+	}
+}
@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/go-redis/redis/v9"
+)
+
+const (
+	LEADER_KEY   = "scheduler:leader"
+	LEADER_LEASE = 30 * time.Second
+)
+
+// Extends the lease only while it's still ours, a replica that stalled past the lease
+// mustn't take it back from the new leader
+var renewLeaderScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseLeaderScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// instanceId identifies this replica as the holder of the leader key
+var instanceId = channels.GenerateRequestId()
+
+// acquireLeadership takes or renews the lease, only the leader fires tasks
+func acquireLeadership(ctx context.Context) (bool, error) {
+
+	renewed, err := renewLeaderScript.Run(ctx, channels.RedisConnection, []string{LEADER_KEY}, instanceId, LEADER_LEASE.Milliseconds()).Int()
+
+	if err != nil {
+		return false, err
+	}
+
+	if renewed == 1 {
+		return true, nil
+	}
+
+	return channels.RedisConnection.SetNX(ctx, LEADER_KEY, instanceId, LEADER_LEASE).Result()
+}
+
+func releaseLeadership() {
+	releaseLeaderScript.Run(context.Background(), channels.RedisConnection, []string{LEADER_KEY}, instanceId)
+}
@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+)
+
+func TestLeadership(t *testing.T) {
+
+	server := miniredis.RunT(t)
+	previousRedis, previousInstance := channels.RedisConnection, instanceId
+
+	channels.RedisConnection = redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	t.Cleanup(func() {
+		channels.RedisConnection.Close()
+		channels.RedisConnection, instanceId = previousRedis, previousInstance
+	})
+
+	ctx := context.Background()
+
+	// acquireAs runs acquireLeadership as the given replica
+	acquireAs := func(replica string) bool {
+
+		instanceId = replica
+
+		leader, err := acquireLeadership(ctx)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return leader
+	}
+
+	if !acquireAs("a") {
+		t.Fatal("first replica didn't get the free lease")
+	}
+
+	if acquireAs("b") {
+		t.Fatal("second replica took a held lease")
+	}
+
+	// Renewing resets the lease
+	server.FastForward(LEADER_LEASE / 2)
+
+	if !acquireAs("a") {
+		t.Fatal("leader couldn't renew its lease")
+	}
+
+	if ttl := server.TTL(LEADER_KEY); ttl != LEADER_LEASE {
+		t.Errorf("lease ttl %v after renewing, want %v", ttl, LEADER_LEASE)
+	}
+
+	// The leader stalls past its lease, another replica takes over
+	server.FastForward(LEADER_LEASE + time.Second)
+
+	if !acquireAs("b") {
+		t.Fatal("second replica didn't get the expired lease")
+	}
+
+	if acquireAs("a") {
+		t.Fatal("stalled replica took the lease back")
+	}
+
+	if holder, _ := server.Get(LEADER_KEY); holder != "b" {
+		t.Errorf("lease held by %q, want b", holder)
+	}
+
+	// Only the holder releases the lease
+	instanceId = "a"
+	releaseLeadership()
+
+	if !server.Exists(LEADER_KEY) {
+		t.Fatal("a replica released a lease it doesn't hold")
+	}
+
+	instanceId = "b"
+	releaseLeadership()
+
+	if server.Exists(LEADER_KEY) {
+		t.Fatal("the leader's release kept the lease")
+	}
+
+	if !acquireAs("a") {
+		t.Error("released lease couldn't be taken")
+	}
+}
@@ -0,0 +1,318 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/backups"
+	"github.com/Lisek-World-Reborn/lisek-api/channels"
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/docker"
+	"github.com/Lisek-World-Reborn/lisek-api/logger"
+	"github.com/robfig/cron/v3"
+)
+
+// Restart warnings can start at most this long before the restart
+const MAX_WARNING = time.Hour
+
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Swapped out in tests, claimed tasks are handed to it
+var runTask = Run
+
+func NextRun(expression string, after time.Time) (time.Time, error) {
+
+	schedule, err := cronParser.Parse(expression)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return schedule.Next(after), nil
+}
+
+func ValidateTask(task db.ScheduledTask) error {
+
+	_, err := cronParser.Parse(task.Cron)
+
+	if err != nil {
+		return fmt.Errorf("invalid cron expression: %w", err)
+	}
+
+	switch task.Type {
+	case db.TASK_RESTART, db.TASK_BACKUP:
+	case db.TASK_COMMAND, db.TASK_BROADCAST:
+		if task.Payload == "" {
+			return errors.New(task.Type + " tasks need a payload")
+		}
+	default:
+		return errors.New("unknown task type " + task.Type)
+	}
+
+	for _, warning := range task.Warnings {
+		if warning <= 0 || time.Duration(warning)*time.Second > MAX_WARNING {
+			return fmt.Errorf("warnings must be between 1 and %d seconds", int(MAX_WARNING.Seconds()))
+		}
+	}
+
+	return nil
+}
+
+// Start fires due tasks every interval while this replica holds the leader lease
+func Start(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer releaseLeadership()
+
+	leader := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		isLeader, err := acquireLeadership(ctx)
+
+		if err != nil {
+			logger.Error("Error acquiring scheduler leadership: " + err.Error())
+			continue
+		}
+
+		if isLeader != leader {
+			leader = isLeader
+
+			if leader {
+				logger.Info("This replica is now running scheduled tasks")
+			}
+		}
+
+		if leader {
+			fireDueTasks(time.Now())
+		}
+	}
+}
+
+func fireDueTasks(now time.Time) {
+
+	tasks := []db.ScheduledTask{}
+	db.OpenedConnection.Where("enabled = ? AND next_run_at <= ?", true, now.Add(MAX_WARNING)).Find(&tasks)
+
+	for _, task := range tasks {
+
+		if now.Before(task.NextRunAt.Add(-task.LeadTime())) {
+			continue
+		}
+
+		// Runs missed while no replica was leading fire once, not once per missed slot
+		after := task.NextRunAt
+
+		if now.After(after) {
+			after = now
+		}
+
+		next, err := NextRun(task.Cron, after)
+
+		if err != nil {
+			logger.Error("Invalid cron expression of task " + task.Name + ": " + err.Error())
+			continue
+		}
+
+		// Claimed by moving NextRunAt, guarded on the old value so the task fires once
+		// even if leadership changed hands in between
+		result := db.OpenedConnection.Model(&db.ScheduledTask{}).
+			Where("id = ? AND next_run_at = ?", task.ID, task.NextRunAt).
+			Updates(map[string]interface{}{"next_run_at": next, "last_run_at": now})
+
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		go runTask(task, task.NextRunAt)
+	}
+}
+
+// RunNow starts the task outside of its schedule and returns its run right away,
+// restarts still send their warnings first
+func RunNow(task db.ScheduledTask) db.TaskRun {
+
+	run := startRun(task)
+
+	go finishRun(task, run, time.Now().Add(task.LeadTime()))
+
+	return run
+}
+
+// Run executes the task for the slot at and records the outcome in its history
+func Run(task db.ScheduledTask, at time.Time) db.TaskRun {
+	return finishRun(task, startRun(task), at)
+}
+
+func startRun(task db.ScheduledTask) db.TaskRun {
+
+	run := db.TaskRun{
+		TaskID:    task.ID,
+		ServerID:  task.ServerID,
+		StartedAt: time.Now(),
+	}
+
+	db.OpenedConnection.Create(&run)
+
+	return run
+}
+
+func finishRun(task db.ScheduledTask, run db.TaskRun, at time.Time) db.TaskRun {
+
+	ctx, cancel := context.WithTimeout(context.Background(), backups.OPERATION_TIMEOUT+task.LeadTime())
+	defer cancel()
+
+	output, err := execute(ctx, task, at)
+
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Output = output
+	run.Status = db.RUN_SUCCEEDED
+
+	if err != nil {
+		logger.Error("Scheduled task " + task.Name + " failed: " + err.Error())
+
+		run.Status = db.RUN_FAILED
+		run.Error = err.Error()
+	}
+
+	db.OpenedConnection.Save(&run)
+
+	return run
+}
+
+func execute(ctx context.Context, task db.ScheduledTask, at time.Time) (string, error) {
+
+	server := db.Server{}
+	db.OpenedConnection.First(&server, task.ServerID)
+
+	if server.ID == 0 {
+		return "", errors.New("server not found")
+	}
+
+	switch task.Type {
+	case db.TASK_RESTART:
+		return "", restart(ctx, server, task.Warnings, at)
+	case db.TASK_BACKUP:
+		return backup(ctx, server)
+	case db.TASK_COMMAND:
+		return docker.ExecConsoleCommand(ctx, server, task.Payload)
+	case db.TASK_BROADCAST:
+		return "", broadcast(server, task.Payload)
+	}
+
+	return "", errors.New("unknown task type " + task.Type)
+}
+
+func broadcast(server db.Server, message string) error {
+
+	_, err := channels.MinecraftRequest{
+		Target:    "broadcast",
+		Arguments: []string{message},
+	}.SendToServer(server.ID)
+
+	return err
+}
+
+func waitUntil(ctx context.Context, at time.Time) error {
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func formatCountdown(seconds int) string {
+
+	if seconds >= 60 && seconds%60 == 0 {
+		if seconds == 60 {
+			return "1 minute"
+		}
+
+		return fmt.Sprintf("%d minutes", seconds/60)
+	}
+
+	if seconds == 1 {
+		return "1 second"
+	}
+
+	return fmt.Sprintf("%d seconds", seconds)
+}
+
+func restart(ctx context.Context, server db.Server, warnings []int, at time.Time) error {
+
+	countdown := append([]int{}, warnings...)
+	sort.Sort(sort.Reverse(sort.IntSlice(countdown)))
+
+	for _, warning := range countdown {
+		err := waitUntil(ctx, at.Add(-time.Duration(warning)*time.Second))
+
+		if err != nil {
+			return err
+		}
+
+		// A missed warning shouldn't cancel the restart
+		err = broadcast(server, "Server restarts in "+formatCountdown(warning))
+
+		if err != nil {
+			logger.Error("Error sending restart warning to " + server.Name + ": " + err.Error())
+		}
+	}
+
+	err := waitUntil(ctx, at)
+
+	if err != nil {
+		return err
+	}
+
+	return docker.RestartServer(&server, nil)
+}
+
+// backup waits for the backup job, so the run's outcome is the backup's
+func backup(ctx context.Context, server db.Server) (string, error) {
+
+	created, job, err := backups.StartBackup(server)
+
+	if err != nil {
+		return "", err
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+
+		// The backup goroutine owns job, a fresh copy is read instead
+		current := db.Job{}
+		db.OpenedConnection.First(&current, job.ID)
+
+		if !current.IsFinished() {
+			continue
+		}
+
+		if current.Phase == db.JOB_FAILED {
+			return "", errors.New(current.Error)
+		}
+
+		return "created backup " + created.Object, nil
+	}
+}
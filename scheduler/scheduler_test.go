@@ -0,0 +1,182 @@
+package scheduler
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Lisek-World-Reborn/lisek-api/db"
+	"github.com/Lisek-World-Reborn/lisek-api/db/dbtest"
+)
+
+func TestNextRun(t *testing.T) {
+
+	after := time.Date(2026, 10, 17, 12, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expression string
+		expected   time.Time
+		invalid    bool
+	}{
+		{expression: "*/15 * * * *", expected: time.Date(2026, 10, 17, 12, 15, 0, 0, time.UTC)},
+		{expression: "0 4 * * *", expected: time.Date(2026, 10, 18, 4, 0, 0, 0, time.UTC)},
+		{expression: "30 3 * * 0", expected: time.Date(2026, 10, 18, 3, 30, 0, 0, time.UTC)},
+		{expression: "0 0 1 1 *", expected: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{expression: "@hourly", expected: time.Date(2026, 10, 17, 13, 0, 0, 0, time.UTC)},
+		{expression: "@daily", expected: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{expression: "61 * * * *", invalid: true},
+		{expression: "* * * *", invalid: true},
+		{expression: "0 * * * * *", invalid: true},
+		{expression: "", invalid: true},
+	}
+
+	for _, test := range tests {
+		next, err := NextRun(test.expression, after)
+
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%q parsed, next run %v", test.expression, next)
+			}
+
+			continue
+		}
+
+		if err != nil || !next.Equal(test.expected) {
+			t.Errorf("%q: next run %v (%v), want %v", test.expression, next, err, test.expected)
+		}
+	}
+}
+
+func TestValidateTask(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		task  db.ScheduledTask
+		valid bool
+	}{
+		{"restart", db.ScheduledTask{Cron: "0 4 * * *", Type: db.TASK_RESTART, Warnings: []int{600, 60, 10}}, true},
+		{"backup", db.ScheduledTask{Cron: "@daily", Type: db.TASK_BACKUP}, true},
+		{"command", db.ScheduledTask{Cron: "*/5 * * * *", Type: db.TASK_COMMAND, Payload: "save-all"}, true},
+		{"command without payload", db.ScheduledTask{Cron: "*/5 * * * *", Type: db.TASK_COMMAND}, false},
+		{"broadcast without payload", db.ScheduledTask{Cron: "*/5 * * * *", Type: db.TASK_BROADCAST}, false},
+		{"unknown type", db.ScheduledTask{Cron: "@daily", Type: "reboot"}, false},
+		{"invalid cron", db.ScheduledTask{Cron: "every day", Type: db.TASK_BACKUP}, false},
+		{"negative warning", db.ScheduledTask{Cron: "@daily", Type: db.TASK_RESTART, Warnings: []int{-1}}, false},
+		{"warning over an hour", db.ScheduledTask{Cron: "@daily", Type: db.TASK_RESTART, Warnings: []int{3601}}, false},
+	}
+
+	for _, test := range tests {
+		err := ValidateTask(test.task)
+
+		if (err == nil) != test.valid {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
+
+type firedTask struct {
+	name string
+	at   time.Time
+}
+
+// recordRuns replaces running tasks with recording them
+func recordRuns(t *testing.T) chan firedTask {
+
+	fired := make(chan firedTask, 16)
+	previous := runTask
+
+	runTask = func(task db.ScheduledTask, at time.Time) db.TaskRun {
+		fired <- firedTask{task.Name, at}
+		return db.TaskRun{}
+	}
+
+	t.Cleanup(func() { runTask = previous })
+
+	return fired
+}
+
+// collect waits for the expected number of runs and makes sure no more follow
+func collect(t *testing.T, fired chan firedTask, expected int) []firedTask {
+
+	runs := []firedTask{}
+
+	for len(runs) < expected {
+		select {
+		case run := <-fired:
+			runs = append(runs, run)
+		case <-time.After(time.Second):
+			t.Fatalf("%d tasks fired, want %d", len(runs), expected)
+		}
+	}
+
+	select {
+	case run := <-fired:
+		t.Fatalf("unexpected run of %s", run.name)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].name < runs[j].name })
+
+	return runs
+}
+
+func TestFireDueTasks(t *testing.T) {
+
+	dbtest.Open(t, &db.ScheduledTask{})
+	fired := recordRuns(t)
+
+	now := time.Date(2026, 10, 17, 12, 0, 30, 0, time.UTC)
+	minute := func(offset int) time.Time { return now.Truncate(time.Minute).Add(time.Duration(offset) * time.Minute) }
+
+	tasks := []db.ScheduledTask{
+		{Name: "due", Cron: "* * * * *", Type: db.TASK_COMMAND, Payload: "save-all", Enabled: true, NextRunAt: minute(0)},
+		{Name: "future", Cron: "*/10 * * * *", Type: db.TASK_COMMAND, Payload: "save-all", Enabled: true, NextRunAt: minute(10)},
+		{Name: "disabled", Cron: "* * * * *", Type: db.TASK_COMMAND, Payload: "save-all", Enabled: false, NextRunAt: minute(0)},
+		{Name: "missed", Cron: "0 * * * *", Type: db.TASK_BACKUP, Enabled: true, NextRunAt: minute(-180)},
+		{Name: "warned restart", Cron: "5 * * * *", Type: db.TASK_RESTART, Warnings: []int{600}, Enabled: true, NextRunAt: minute(5)},
+		{Name: "later restart", Cron: "5 * * * *", Type: db.TASK_RESTART, Warnings: []int{60}, Enabled: true, NextRunAt: minute(5)},
+	}
+
+	for i := range tasks {
+		err := db.OpenedConnection.Create(&tasks[i]).Error
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fireDueTasks(now)
+
+	runs := collect(t, fired, 3)
+
+	expected := []firedTask{{"due", minute(0)}, {"missed", minute(-180)}, {"warned restart", minute(5)}}
+
+	for i, run := range runs {
+		if run.name != expected[i].name || !run.at.Equal(expected[i].at) {
+			t.Errorf("fired %s for %v, want %s for %v", run.name, run.at, expected[i].name, expected[i].at)
+		}
+	}
+
+	// Claiming moved the slots, missed runs fire once and continue from now
+	nextRuns := map[string]time.Time{
+		"due":            minute(1),
+		"future":         minute(10),
+		"disabled":       minute(0),
+		"missed":         minute(60),
+		"warned restart": minute(65),
+		"later restart":  minute(5),
+	}
+
+	for name, expected := range nextRuns {
+		task := db.ScheduledTask{}
+		db.OpenedConnection.Where("name = ?", name).First(&task)
+
+		if !task.NextRunAt.Equal(expected) {
+			t.Errorf("%s: next run %v, want %v", name, task.NextRunAt, expected)
+		}
+	}
+
+	// A second tick in the same minute finds everything claimed
+	fireDueTasks(now)
+	collect(t, fired, 0)
+}